@@ -0,0 +1,590 @@
+// ycachectl 通过节点接口与管理接口诊断 ycache 集群
+//
+//	ycachectl [flags] <command> [command flags] [args]
+//
+// 命令：
+//
+//	get KEY                     读取key
+//	mget KEY...                 并发读取多个key
+//	del KEY                     删除key的缓存，不影响后端存储
+//	owner [-n 3] KEY            按优先级排列的负责key的节点
+//	ring [-samples 10000]       哈希环上的节点及其负责的key的比例
+//	stats [-watch 2s] [-count N]  Group的统计信息，-watch 时定期刷新并显示每秒的变化
+//	groups                      Group列表
+//	snapshot [-node] [-out F]   下载快照写入F（默认标准输出），-node 时由节点写入Group配置的快照文件
+//	restore [-node] [-in F]     从F（默认标准输入）恢复快照，-node 时由节点读取Group配置的快照文件
+//
+// -o 选择输出格式：table（默认）或 json。
+package main
+
+import (
+	pb "7days/ycache/ycachepb"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// 默认配置
+const (
+	defaultPeer    = "http://localhost:8001"
+	basePath       = "/_ycache/"
+	adminPath      = "/_admin"
+	notFoundHeader = "X-Ycache-Not-Found"
+	secretHeader   = "X-Ycache-Secret"
+)
+
+func main() {
+	if err := run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr); err != nil {
+		fmt.Fprintln(os.Stderr, "ycachectl:", err)
+		os.Exit(1)
+	}
+}
+
+// ctl 一次命令执行的配置
+type ctl struct {
+	peer    string
+	admin   string
+	secret  string
+	group   string
+	output  string
+	timeout time.Duration
+	client  *http.Client
+
+	stdin  io.Reader
+	stdout io.Writer
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	c := &ctl{stdin: stdin, stdout: stdout}
+
+	fs := flag.NewFlagSet("ycachectl", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.StringVar(&c.peer, "peer", defaultPeer, "Peer URL used by get, mget and del")
+	fs.StringVar(&c.admin, "admin", "", "Admin URL. If blank, it defaults to <peer>"+adminPath)
+	fs.StringVar(&c.secret, "secret", "", "Shared secret of the peers (pool.secret), required by del when set")
+	fs.StringVar(&c.group, "group", "", "Group name. Required by get, mget, del, snapshot and restore")
+	fs.StringVar(&c.output, "o", "table", "Output format: table or json")
+	fs.DurationVar(&c.timeout, "timeout", 5*time.Second, "Timeout of each request")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: ycachectl [flags] get|mget|del|owner|ring|stats|groups|snapshot|restore [args]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if c.output != "table" && c.output != "json" {
+		return fmt.Errorf("unknown output format %q, want table or json", c.output)
+	}
+
+	c.peer = strings.TrimSuffix(c.peer, "/")
+	if c.admin == "" {
+		c.admin = c.peer + adminPath
+	}
+	c.admin = strings.TrimSuffix(c.admin, "/")
+	c.client = &http.Client{Timeout: c.timeout}
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("command is required")
+	}
+
+	commands := map[string]func(args []string) error{
+		"get":      c.get,
+		"mget":     c.mget,
+		"del":      c.del,
+		"owner":    c.owner,
+		"ring":     c.ring,
+		"stats":    c.stats,
+		"groups":   c.groups,
+		"snapshot": c.snapshot,
+		"restore":  c.restore,
+	}
+
+	cmd, ok := commands[fs.Arg(0)]
+	if !ok {
+		return fmt.Errorf("unknown command %q", fs.Arg(0))
+	}
+
+	return cmd(fs.Args()[1:])
+}
+
+// item get 与 mget 中单个key的结果
+type item struct {
+	Key    string     `json:"key"`
+	Value  string     `json:"value,omitempty"`
+	Expire *time.Time `json:"expire,omitempty"`
+	Tags   []string   `json:"tags,omitempty"`
+	Error  string     `json:"error,omitempty"`
+}
+
+func (c *ctl) get(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: get KEY")
+	}
+
+	it := c.fetch(args[0])
+	if it.Error != "" {
+		return errors.New(it.Error)
+	}
+
+	if c.output == "json" {
+		return c.printJSON(it)
+	}
+	return c.printTable([]string{"KEY", "VALUE", "EXPIRE", "TAGS"}, [][]string{itemRow(it)[:4]})
+}
+
+func (c *ctl) mget(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: mget KEY...")
+	}
+
+	items := make([]item, len(args))
+	var wg sync.WaitGroup
+	for i, key := range args {
+		wg.Add(1)
+		go func(i int, key string) {
+			defer wg.Done()
+			items[i] = c.fetch(key)
+		}(i, key)
+	}
+	wg.Wait()
+
+	if c.output == "json" {
+		return c.printJSON(items)
+	}
+
+	rows := make([][]string, len(items))
+	for i, it := range items {
+		rows[i] = itemRow(it)
+	}
+	return c.printTable([]string{"KEY", "VALUE", "EXPIRE", "TAGS", "ERROR"}, rows)
+}
+
+func itemRow(it item) []string {
+	expire := "-"
+	if it.Expire != nil {
+		expire = it.Expire.Format(time.RFC3339)
+	}
+
+	return []string{it.Key, it.Value, expire, strings.Join(it.Tags, ","), it.Error}
+}
+
+// fetch 通过节点接口读取key，错误记录在结果中
+func (c *ctl) fetch(key string) item {
+	it := item{Key: key}
+	if c.group == "" {
+		it.Error = "-group is required"
+		return it
+	}
+
+	body, err := c.do(http.MethodGet, c.keyURL(key), nil)
+	if err != nil {
+		it.Error = err.Error()
+		return it
+	}
+
+	resp := &pb.Response{}
+	if err := proto.Unmarshal(body, resp); err != nil {
+		it.Error = "decoding response: " + err.Error()
+		return it
+	}
+
+	it.Value, it.Tags = string(resp.GetValue()), resp.GetTags()
+	if n := resp.GetExpire(); n != 0 {
+		expire := time.Unix(0, n)
+		it.Expire = &expire
+	}
+
+	return it
+}
+
+func (c *ctl) del(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: del KEY")
+	}
+	if c.group == "" {
+		return errors.New("-group is required")
+	}
+
+	body, err := c.do(http.MethodDelete, c.keyURL(args[0]), nil)
+	if err != nil {
+		return err
+	}
+
+	resp := &pb.RemoveResponse{}
+	if err := proto.Unmarshal(body, resp); err != nil {
+		return fmt.Errorf("decoding response: %v", err)
+	}
+
+	result := struct {
+		Key     string `json:"key"`
+		Removed bool   `json:"removed"`
+	}{args[0], resp.GetRemoved()}
+
+	if c.output == "json" {
+		return c.printJSON(result)
+	}
+	return c.printTable([]string{"KEY", "REMOVED"}, [][]string{{result.Key, strconv.FormatBool(result.Removed)}})
+}
+
+func (c *ctl) owner(args []string) error {
+	fs := flag.NewFlagSet("owner", flag.ContinueOnError)
+	n := fs.Int("n", 3, "Number of owners in priority order")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: owner [-n 3] KEY")
+	}
+
+	var owner struct {
+		Key    string   `json:"key"`
+		Owner  string   `json:"owner"`
+		Owners []string `json:"owners"`
+	}
+	query := url.Values{"key": {fs.Arg(0)}, "n": {strconv.Itoa(*n)}}
+	if err := c.adminJSON(http.MethodGet, "/owner", query, nil, &owner); err != nil {
+		return err
+	}
+
+	if c.output == "json" {
+		return c.printJSON(owner)
+	}
+
+	rows := make([][]string, len(owner.Owners))
+	for i, peer := range owner.Owners {
+		rows[i] = []string{strconv.Itoa(i + 1), peer}
+	}
+	return c.printTable([]string{"RANK", "PEER"}, rows)
+}
+
+func (c *ctl) ring(args []string) error {
+	fs := flag.NewFlagSet("ring", flag.ContinueOnError)
+	samples := fs.Int("samples", 10000, "Number of sample keys used to estimate the key share")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var ring []struct {
+		Peer    string  `json:"peer"`
+		Self    bool    `json:"self"`
+		Healthy bool    `json:"healthy"`
+		Weight  int     `json:"weight"`
+		Share   float64 `json:"share"`
+	}
+	if err := c.adminJSON(http.MethodGet, "/ring", url.Values{"samples": {strconv.Itoa(*samples)}}, nil, &ring); err != nil {
+		return err
+	}
+
+	if c.output == "json" {
+		return c.printJSON(ring)
+	}
+
+	rows := make([][]string, len(ring))
+	for i, r := range ring {
+		peer := r.Peer
+		if r.Self {
+			peer += " (self)"
+		}
+		rows[i] = []string{peer, strconv.FormatBool(r.Healthy), strconv.Itoa(r.Weight), fmt.Sprintf("%.1f%%", r.Share*100)}
+	}
+	return c.printTable([]string{"PEER", "HEALTHY", "WEIGHT", "SHARE"}, rows)
+}
+
+// groupStatus 管理接口 /groups 返回的Group状态
+type groupStatus struct {
+	Name       string           `json:"name"`
+	Generation uint64           `json:"generation"`
+	Stats      map[string]int64 `json:"stats"`
+	Cache      struct {
+		Items     int64 `json:"items"`
+		Evictions int64 `json:"evictions"`
+	} `json:"cache"`
+}
+
+func (c *ctl) fetchGroups() ([]groupStatus, error) {
+	query := url.Values{}
+	if c.group != "" {
+		query.Set("group", c.group)
+	}
+
+	var groups []groupStatus
+	err := c.adminJSON(http.MethodGet, "/groups", query, nil, &groups)
+	return groups, err
+}
+
+func (c *ctl) groups(args []string) error {
+	groups, err := c.fetchGroups()
+	if err != nil {
+		return err
+	}
+
+	if c.output == "json" {
+		return c.printJSON(groups)
+	}
+
+	rows := make([][]string, len(groups))
+	for i, g := range groups {
+		rows[i] = []string{
+			g.Name,
+			strconv.FormatUint(g.Generation, 10),
+			strconv.FormatInt(g.Cache.Items, 10),
+			strconv.FormatInt(g.Stats["gets"], 10),
+			hitRate(g.Stats),
+		}
+	}
+	return c.printTable([]string{"GROUP", "GENERATION", "ITEMS", "GETS", "HIT RATE"}, rows)
+}
+
+// statColumns stats 命令的表格中显示的统计项
+var statColumns = []string{"gets", "cache_hits", "loads", "peer_loads", "peer_errors", "local_loads", "local_load_errs", "server_requests"}
+
+func (c *ctl) stats(args []string) error {
+	fs := flag.NewFlagSet("stats", flag.ContinueOnError)
+	watch := fs.Duration("watch", 0, "Refresh interval. If blank, stats are printed once")
+	count := fs.Int("count", 0, "Number of refreshes in watch mode. If blank, refresh until interrupted")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var prev map[string]groupStatus
+	var prevAt time.Time
+	for i := 0; ; i++ {
+		groups, err := c.fetchGroups()
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+
+		if err := c.printStats(groups, prev, now.Sub(prevAt)); err != nil {
+			return err
+		}
+
+		if *watch <= 0 || *count > 0 && i+1 >= *count {
+			return nil
+		}
+
+		prev, prevAt = make(map[string]groupStatus), now
+		for _, g := range groups {
+			prev[g.Name] = g
+		}
+		time.Sleep(*watch)
+	}
+}
+
+// printStats 打印统计信息，有上一次的结果时增加每秒变化量
+func (c *ctl) printStats(groups []groupStatus, prev map[string]groupStatus, elapsed time.Duration) error {
+	if c.output == "json" {
+		// watch 模式下每次刷新输出一行
+		return json.NewEncoder(c.stdout).Encode(struct {
+			Time   time.Time     `json:"time"`
+			Groups []groupStatus `json:"groups"`
+		}{time.Now(), groups})
+	}
+
+	header := []string{"GROUP", "ITEMS", "EVICTIONS", "HIT RATE"}
+	for _, name := range statColumns {
+		header = append(header, strings.ToUpper(name))
+	}
+	if prev != nil {
+		header = append(header, "GETS/S", "LOADS/S")
+	}
+
+	var rows [][]string
+	for _, g := range groups {
+		row := []string{g.Name, strconv.FormatInt(g.Cache.Items, 10), strconv.FormatInt(g.Cache.Evictions, 10), hitRate(g.Stats)}
+		for _, name := range statColumns {
+			row = append(row, strconv.FormatInt(g.Stats[name], 10))
+		}
+
+		if prev != nil {
+			p := prev[g.Name]
+			rate := func(name string) string {
+				return fmt.Sprintf("%.1f", float64(g.Stats[name]-p.Stats[name])/elapsed.Seconds())
+			}
+			row = append(row, rate("gets"), rate("loads"))
+		}
+		rows = append(rows, row)
+	}
+
+	if prev != nil {
+		fmt.Fprintln(c.stdout, time.Now().Format("15:04:05"))
+	}
+	return c.printTable(header, rows)
+}
+
+func hitRate(stats map[string]int64) string {
+	if stats["gets"] == 0 {
+		return "-"
+	}
+
+	return fmt.Sprintf("%.1f%%", float64(stats["cache_hits"])*100/float64(stats["gets"]))
+}
+
+func (c *ctl) snapshot(args []string) error {
+	fs := flag.NewFlagSet("snapshot", flag.ContinueOnError)
+	node := fs.Bool("node", false, "Write the snapshot to the group's configured snapshot file on the node")
+	out := fs.String("out", "", "Local file to download the snapshot to. If blank, it is written to stdout")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if c.group == "" {
+		return errors.New("-group is required")
+	}
+
+	query := url.Values{"group": {c.group}}
+	if *node {
+		return c.nodeFile(http.MethodPost, "/snapshot", query, nil)
+	}
+
+	data, err := c.do(http.MethodGet, c.admin+"/snapshot?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+
+	if *out == "" {
+		_, err = c.stdout.Write(data)
+		return err
+	}
+	return ioutil.WriteFile(*out, data, 0644)
+}
+
+func (c *ctl) restore(args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ContinueOnError)
+	node := fs.Bool("node", false, "Restore the snapshot from the group's configured snapshot file on the node")
+	in := fs.String("in", "", "Local snapshot file to upload. If blank, it is read from stdin")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if c.group == "" {
+		return errors.New("-group is required")
+	}
+
+	query := url.Values{"group": {c.group}}
+	if *node {
+		query.Set("from", "file")
+		return c.nodeFile(http.MethodPost, "/restore", query, nil)
+	}
+
+	var data []byte
+	var err error
+	if *in == "" {
+		data, err = ioutil.ReadAll(c.stdin)
+	} else {
+		data, err = ioutil.ReadFile(*in)
+	}
+	if err != nil {
+		return err
+	}
+
+	return c.nodeFile(http.MethodPost, "/restore", query, data)
+}
+
+// nodeFile 调用写入或读取快照的管理接口并打印结果
+func (c *ctl) nodeFile(method, path string, query url.Values, body []byte) error {
+	var result struct {
+		Group string `json:"group"`
+		Path  string `json:"path,omitempty"`
+	}
+	if err := c.adminJSON(method, path, query, body, &result); err != nil {
+		return err
+	}
+
+	if c.output == "json" {
+		return c.printJSON(result)
+	}
+
+	file := result.Path
+	if file == "" {
+		file = "-"
+	}
+	return c.printTable([]string{"GROUP", "PATH"}, [][]string{{result.Group, file}})
+}
+
+func (c *ctl) keyURL(key string) string {
+	return c.peer + basePath + url.PathEscape(c.group) + "/" + url.PathEscape(key)
+}
+
+// adminJSON 请求管理接口，把JSON响应解码到v
+func (c *ctl) adminJSON(method, path string, query url.Values, body []byte, v interface{}) error {
+	u := c.admin + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	data, err := c.do(method, u, body)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("decoding response of %s: %v", path, err)
+	}
+	return nil
+}
+
+// do 发送请求并返回响应体，非200的响应作为错误返回
+func (c *ctl) do(method, u string, body []byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if c.secret != "" {
+		req.Header.Set(secretHeader, c.secret)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.Header.Get(notFoundHeader) != "" {
+		return nil, errors.New("not found")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+
+	return data, nil
+}
+
+func (c *ctl) printJSON(v interface{}) error {
+	enc := json.NewEncoder(c.stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func (c *ctl) printTable(header []string, rows [][]string) error {
+	w := tabwriter.NewWriter(c.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, strings.Join(header, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+
+	return w.Flush()
+}
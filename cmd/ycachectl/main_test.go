@@ -0,0 +1,97 @@
+package main
+
+import (
+	"7days/ycache"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newTestNode(t *testing.T) string {
+	ycache.NewGroup("ctl", 2<<10, ycache.GetterFunc(func(ctx context.Context, key string) ([]byte, error) {
+		if key == "missing" {
+			return nil, ycache.ErrNotFound
+		}
+		return []byte("v-" + key), nil
+	}))
+
+	var pool *ycache.HTTPPool
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	pool = ycache.NewHTTPPool(srv.URL)
+	pool.Set(srv.URL, "http://other")
+	mux.Handle("/_ycache/", pool)
+	mux.Handle("/_admin/", http.StripPrefix("/_admin", ycache.NewAdmin(pool)))
+
+	return srv.URL
+}
+
+func ctlRun(t *testing.T, args ...string) string {
+	var stdout, stderr bytes.Buffer
+	if err := run(args, strings.NewReader(""), &stdout, &stderr); err != nil {
+		t.Fatalf("ycachectl %s: %v\n%s", strings.Join(args, " "), err, stderr.String())
+	}
+	return stdout.String()
+}
+
+func TestCtlKeys(t *testing.T) {
+	peer := newTestNode(t)
+
+	if out := ctlRun(t, "-peer", peer, "-group", "ctl", "get", "a b"); !strings.Contains(out, "v-a b") {
+		t.Errorf("get output:\n%s", out)
+	}
+
+	var items []item
+	out := ctlRun(t, "-peer", peer, "-group", "ctl", "-o", "json", "mget", "a", "missing")
+	if err := json.Unmarshal([]byte(out), &items); err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 || items[0].Value != "v-a" || items[1].Error != "not found" {
+		t.Errorf("mget = %+v", items)
+	}
+
+	if err := run([]string{"-peer", peer, "-group", "ctl", "get", "missing"}, nil, &bytes.Buffer{}, &bytes.Buffer{}); err == nil {
+		t.Error("get of a missing key succeeded")
+	}
+
+	if out := ctlRun(t, "-peer", peer, "-group", "ctl", "del", "a"); !strings.Contains(out, "REMOVED") {
+		t.Errorf("del output:\n%s", out)
+	}
+}
+
+func TestCtlAdmin(t *testing.T) {
+	peer := newTestNode(t)
+	ctlRun(t, "-peer", peer, "-group", "ctl", "get", "a")
+
+	var owner struct{ Owners []string }
+	if err := json.Unmarshal([]byte(ctlRun(t, "-peer", peer, "-o", "json", "owner", "-n", "2", "a")), &owner); err != nil {
+		t.Fatal(err)
+	}
+	if len(owner.Owners) != 2 {
+		t.Errorf("owners = %v", owner.Owners)
+	}
+
+	if out := ctlRun(t, "-peer", peer, "ring", "-samples", "100"); !strings.Contains(out, peer+" (self)") || !strings.Contains(out, "http://other") {
+		t.Errorf("ring output:\n%s", out)
+	}
+
+	if out := ctlRun(t, "-peer", peer, "groups"); !strings.Contains(out, "ctl") {
+		t.Errorf("groups output:\n%s", out)
+	}
+
+	out := ctlRun(t, "-peer", peer, "-group", "ctl", "stats", "-watch", "10ms", "-count", "2")
+	if !strings.Contains(out, "GETS/S") || strings.Count(out, "GROUP") != 2 {
+		t.Errorf("stats output:\n%s", out)
+	}
+
+	path := filepath.Join(t.TempDir(), "ctl.snapshot")
+	ctlRun(t, "-peer", peer, "-group", "ctl", "snapshot", "-out", path)
+	ctlRun(t, "-peer", peer, "-group", "ctl", "restore", "-in", path)
+}
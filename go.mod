@@ -6,4 +6,5 @@ require (
 	github.com/golang/protobuf v1.5.2
 	go.starlark.net v0.0.0-20211203141949-70c0e40ae128
 	google.golang.org/grpc v1.43.0
+	gopkg.in/yaml.v2 v2.4.0
 )
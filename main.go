@@ -1,81 +1,85 @@
 package main
 
 import (
-	"7days/ycache"
+	"7days/ycache/server"
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
-var db = map[string]string{
-	"Zhangsan": "1-1",
-	"Lisi":     "1-2",
-	"Wangwu":   "1-3",
-}
-
-func createGroup() *ycache.Group {
-	return ycache.NewGroup("names", 2<<10, ycache.GetterFunc(
-		func(ctx context.Context, key string) ([]byte, error) {
-			log.Println("[SlowDB] search key", key)
-			if v, ok := db[key]; ok {
-				return []byte(v), nil
-			}
-
-			return nil, fmt.Errorf("%s not exist", key)
-		}))
-}
-
-func startCacheServer(addr string, addrs []string, y *ycache.Group) {
-	peers := ycache.NewHTTPPool(addr)
-	peers.Set(addrs...)
-	y.RegisterPeers(peers)
-	log.Println("ycache is running at", addr)
-	log.Fatal(http.ListenAndServe(addr[7:], peers))
-}
-
-func startAPIServer(apiAddr string, y *ycache.Group) {
-	http.Handle("/api", http.HandlerFunc(
-		func(w http.ResponseWriter, r *http.Request) {
-			key := r.URL.Query().Get("key")
-			view, err := y.Get(r.Context(), key)
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-
-			w.Header().Set("Context-Type", "application/octet-stream")
-			w.Write(view.ByteSlice())
-		}))
-	log.Println("fontend server is running at", apiAddr)
-	log.Fatal(http.ListenAndServe(apiAddr[7:], nil))
-}
-
 func main() {
-	var port int
-	var api bool
-	flag.IntVar(&port, "port", 8001, "YCache server port")
-	flag.BoolVar(&api, "api", false, "Start a api server?")
+	var path string
+	var check bool
+	var shutdownTimeout time.Duration
+	flag.StringVar(&path, "config", "ycache.yaml", "Config file in YAML, or JSON when it ends with .json. Reloaded on SIGHUP")
+	flag.BoolVar(&check, "check", false, "Validate the config file and exit")
+	flag.DurationVar(&shutdownTimeout, "shutdown-timeout", 30*time.Second, "Time to wait for in-flight requests and loads on SIGINT/SIGTERM")
 	flag.Parse()
 
-	apiAddr := "http://localhost:9999"
-	addrMap := map[int]string{
-		8001: "http://localhost:8001",
-		8002: "http://localhost:8002",
-		8003: "http://localhost:8003",
+	cfg, err := server.LoadConfig(path)
+	if err != nil {
+		log.Fatal(err)
 	}
 
-	var addrs []string
-
-	for _, v := range addrMap {
-		addrs = append(addrs, v)
+	if check {
+		fmt.Println(path, "is valid")
+		return
 	}
 
-	y := createGroup()
-	if api {
-		go startAPIServer(apiAddr, y)
+	s, err := server.New(cfg)
+	if err != nil {
+		log.Fatal(err)
 	}
 
-	startCacheServer(addrMap[port], addrs, y)
+	// SIGHUP 重新加载配置，SIGINT/SIGTERM 离开集群、等待进行中的请求并写入快照后退出，
+	// 再次收到 SIGINT/SIGTERM 时立即退出
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM)
+	done := make(chan struct{})
+	go func() {
+		stopping := false
+		for sig := range sigs {
+			if sig != syscall.SIGHUP {
+				if stopping {
+					log.Println("[server] forced to exit")
+					os.Exit(1)
+				}
+				stopping = true
+
+				go func() {
+					log.Println("[server] shutting down")
+					ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+					defer cancel()
+					if err := s.Shutdown(ctx); err != nil {
+						log.Println("[server] Failed to shut down gracefully:", err)
+					}
+					close(done)
+				}()
+				continue
+			}
+
+			cfg, err := server.LoadConfig(path)
+			if err != nil {
+				log.Println("[server] Failed to reload config:", err)
+				continue
+			}
+			if err := s.Reload(cfg); err != nil {
+				log.Println("[server] Failed to reload config:", err)
+				continue
+			}
+			log.Println("[server] config reloaded from", path)
+		}
+	}()
+
+	if err := s.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
+	<-done
 }
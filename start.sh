@@ -1,22 +1,30 @@
 #!/bin/bash
-trap "rm server; kill 0" EXIT
+dir=$(mktemp -d)
+trap "rm -rf server $dir; kill 0" EXIT
 
 go build -o server
-./server -port=8001 &
-sleep 1
-./server -port=8002 &
-sleep 1
-./server -port=8003 -api=1 &
+
+# 每个节点的配置只有 self 与 listen 不同，其余与 ycache.example.yaml 相同
+for port in 8001 8002 8003; do
+	sed -e "s|^self: .*|self: http://localhost:$port|" \
+		-e "s|^  peer: .*|  peer: localhost:$port|" \
+		ycache.example.yaml > $dir/$port.yaml
+	if [ $port != 8003 ]; then
+		sed -i -e "s|^  api: .*|  api: \"\"|" $dir/$port.yaml
+	fi
+	./server -config $dir/$port.yaml &
+	sleep 1
+done
 
 sleep 2
 echo ">>> star test\n"
 echo ">>> test 1\n"
-curl "http://localhost:9999/api?key=Lisi" &
+curl "http://localhost:9999/v1/groups/names/keys/Lisi" &
 sleep 1
 echo "\n>>> test 2"
-curl "http://localhost:9999/api?key=Lisi" &
+curl "http://localhost:9999/v1/groups/names/keys/Lisi" &
 sleep 1
 echo "\n>>> test 3"
-curl "http://localhost:9999/api?key=Lisi" &
+curl "http://localhost:9999/v1/groups/names/keys/Lisi" &
 
 wait
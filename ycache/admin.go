@@ -0,0 +1,346 @@
+package ycache
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+)
+
+// 管理接口的默认参数
+const (
+	defaultOwnerReplicas = 3
+	defaultRingSamples   = 10000
+	maxRingSamples       = 100000
+)
+
+// Admin 管理接口，以JSON格式展示本节点的运行状态
+//
+//	GET  /peers                   节点列表及健康状态
+//	GET  /generation?group=name   Group当前的generation
+//	POST /generation?group=name   增加generation，使整个集群中该Group的缓存失效
+//	POST /invalidate?group=name&tag=t  删除整个集群中该Group带有标签t的数据
+//	GET  /groups[?group=name]     Group列表及统计信息
+//	GET  /owner?key=k[&n=3]       按优先级排列的负责key的节点
+//	GET  /ring[?samples=10000]    哈希环上的节点及其负责的key的比例（抽样估计）
+//	GET  /snapshot?group=name     下载Group的快照
+//	POST /snapshot?group=name     把快照写入Group配置的快照文件，需要先调用 HandleSnapshotFiles
+//	POST /restore?group=name[&from=file]  从请求体中的快照恢复，from=file 时读取Group配置的快照文件
+//	GET  /migration               迁移进度，需要先调用 HandleMigration
+//
+// 管理接口没有鉴权，应只在内部网络中提供服务
+type Admin struct {
+	pool *HTTPPool
+	mux  *http.ServeMux
+
+	snapshotFile func(group string) string // 返回Group配置的快照文件，见 HandleSnapshotFiles
+}
+
+// NewAdmin 创建管理接口
+func NewAdmin(pool *HTTPPool) *Admin {
+	a := &Admin{
+		pool: pool,
+		mux:  http.NewServeMux(),
+	}
+
+	a.mux.HandleFunc("/peers", a.peers)
+	a.mux.HandleFunc("/generation", a.generation)
+	a.mux.HandleFunc("/invalidate", a.invalidate)
+	a.mux.HandleFunc("/groups", a.groups)
+	a.mux.HandleFunc("/owner", a.owner)
+	a.mux.HandleFunc("/ring", a.ring)
+	a.mux.HandleFunc("/snapshot", a.snapshot)
+	a.mux.HandleFunc("/restore", a.restore)
+
+	return a
+}
+
+// HandleMigration 展示 MigrationPicker 的迁移进度
+func (a *Admin) HandleMigration(m *MigrationPicker) {
+	a.mux.HandleFunc("/migration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, m.Status())
+	})
+}
+
+// HandleSnapshotFiles 允许在本节点上读写快照文件，file 返回Group配置的快照文件，
+// 没有配置时返回空字符串。文件路径只能来自配置，不能由请求指定。
+func (a *Admin) HandleSnapshotFiles(file func(group string) string) {
+	a.snapshotFile = file
+}
+
+// snapshotPath 返回Group配置的快照文件
+func (a *Admin) snapshotPath(group string) string {
+	if a.snapshotFile == nil {
+		return ""
+	}
+
+	return a.snapshotFile(group)
+}
+
+func (a *Admin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.mux.ServeHTTP(w, r)
+}
+
+func (a *Admin) peers(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, a.pool.Status())
+}
+
+// generationStatus Group的generation
+type generationStatus struct {
+	Group      string `json:"group"`
+	Generation uint64 `json:"generation"`
+	Error      string `json:"error,omitempty"`
+}
+
+func (a *Admin) generation(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("group")
+	g := GetGroup(name)
+	if g == nil {
+		http.Error(w, "no such group: "+name, http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, generationStatus{Group: name, Generation: g.Generation()})
+	case http.MethodPost:
+		gen, err := g.BumpGeneration(r.Context())
+		if err != nil {
+			// 本节点已经采用了新的generation，其余节点稍后会追上
+			writeJSON(w, http.StatusBadGateway, generationStatus{Group: name, Generation: gen, Error: err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, generationStatus{Group: name, Generation: gen})
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// invalidateStatus 删除标签对应数据的结果
+type invalidateStatus struct {
+	Group   string `json:"group"`
+	Tag     string `json:"tag"`
+	Removed int64  `json:"removed"`
+	Error   string `json:"error,omitempty"`
+}
+
+func (a *Admin) invalidate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name, tag := r.URL.Query().Get("group"), r.URL.Query().Get("tag")
+	g := GetGroup(name)
+	if g == nil {
+		http.Error(w, "no such group: "+name, http.StatusNotFound)
+		return
+	}
+
+	if tag == "" {
+		http.Error(w, "tag is required", http.StatusBadRequest)
+		return
+	}
+
+	removed, err := g.InvalidateTag(r.Context(), tag)
+	if err != nil {
+		writeJSON(w, http.StatusBadGateway, invalidateStatus{Group: name, Tag: tag, Removed: removed, Error: err.Error()})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, invalidateStatus{Group: name, Tag: tag, Removed: removed})
+}
+
+// groupStatus Group的状态与统计信息
+type groupStatus struct {
+	Name       string           `json:"name"`
+	Generation uint64           `json:"generation"`
+	Stats      map[string]int64 `json:"stats"`
+	Cache      CacheStats       `json:"cache"`
+}
+
+func (a *Admin) groups(w http.ResponseWriter, r *http.Request) {
+	names := GroupNames()
+	if name := r.URL.Query().Get("group"); name != "" {
+		if GetGroup(name) == nil {
+			http.Error(w, "no such group: "+name, http.StatusNotFound)
+			return
+		}
+		names = []string{name}
+	}
+
+	statuses := make([]groupStatus, 0, len(names))
+	for _, name := range names {
+		g := GetGroup(name)
+		s := &g.Stats
+		statuses = append(statuses, groupStatus{
+			Name:       name,
+			Generation: g.Generation(),
+			Stats: map[string]int64{
+				"gets":            s.Gets.Get(),
+				"cache_hits":      s.CacheHits.Get(),
+				"loads":           s.Loads.Get(),
+				"loads_deduped":   s.LoadsDeduped.Get(),
+				"peer_loads":      s.PeerLoads.Get(),
+				"peer_errors":     s.PeerErrors.Get(),
+				"local_loads":     s.LocalLoads.Get(),
+				"local_load_errs": s.LocalLoadErrs.Get(),
+				"server_requests": s.ServerRequests.Get(),
+			},
+			Cache: g.CacheStats(),
+		})
+	}
+
+	writeJSON(w, http.StatusOK, statuses)
+}
+
+// ownerStatus 负责key的节点
+type ownerStatus struct {
+	Key    string   `json:"key"`
+	Owner  string   `json:"owner"`
+	Owners []string `json:"owners"` // 按优先级排列，第一个为 Owner
+}
+
+func (a *Admin) owner(w http.ResponseWriter, r *http.Request) {
+	key := r.URL.Query().Get("key")
+	if key == "" {
+		http.Error(w, "key is required", http.StatusBadRequest)
+		return
+	}
+
+	n, err := intParam(r, "n", defaultOwnerReplicas)
+	if err != nil || n < 1 {
+		http.Error(w, "n must be a positive integer", http.StatusBadRequest)
+		return
+	}
+
+	owners := a.pool.Owners(key, n)
+	if len(owners) == 0 {
+		http.Error(w, "no peers", http.StatusServiceUnavailable)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, ownerStatus{Key: key, Owner: owners[0], Owners: owners})
+}
+
+// ringStatus 哈希环上的节点
+type ringStatus struct {
+	Peer    string  `json:"peer"`
+	Self    bool    `json:"self"`
+	Healthy bool    `json:"healthy"`
+	Weight  int     `json:"weight"`
+	Share   float64 `json:"share"` // 负责的key的比例
+}
+
+func (a *Admin) ring(w http.ResponseWriter, r *http.Request) {
+	samples, err := intParam(r, "samples", defaultRingSamples)
+	if err != nil || samples < 1 || samples > maxRingSamples {
+		http.Error(w, "samples must be between 1 and "+strconv.Itoa(maxRingSamples), http.StatusBadRequest)
+		return
+	}
+
+	share := a.pool.KeyShare(samples)
+	var ring []ringStatus
+	for _, s := range a.pool.Status() {
+		ring = append(ring, ringStatus{
+			Peer:    s.Peer,
+			Self:    s.Self,
+			Healthy: s.Healthy,
+			Weight:  s.Weight,
+			Share:   share[s.Peer],
+		})
+	}
+	sort.Slice(ring, func(i, j int) bool { return ring[i].Peer < ring[j].Peer })
+
+	writeJSON(w, http.StatusOK, ring)
+}
+
+// snapshotStatus 在本节点上写入或读取快照文件的结果
+type snapshotStatus struct {
+	Group string `json:"group"`
+	Path  string `json:"path,omitempty"`
+}
+
+func (a *Admin) snapshot(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("group")
+	g := GetGroup(name)
+	if g == nil {
+		http.Error(w, "no such group: "+name, http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/octet-stream")
+		// 已经开始写入响应，出错时只能中断连接
+		if err := g.Snapshot(w); err != nil {
+			panic(http.ErrAbortHandler)
+		}
+	case http.MethodPost:
+		path := a.snapshotPath(name)
+		if path == "" {
+			http.Error(w, "no snapshot file configured for group: "+name, http.StatusNotFound)
+			return
+		}
+		if err := g.SnapshotFile(path); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, snapshotStatus{Group: name, Path: path})
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (a *Admin) restore(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := r.URL.Query().Get("group")
+	g := GetGroup(name)
+	if g == nil {
+		http.Error(w, "no such group: "+name, http.StatusNotFound)
+		return
+	}
+
+	var path string
+	var err error
+	switch from := r.URL.Query().Get("from"); from {
+	case "":
+		err = g.Restore(r.Body)
+	case "file":
+		if path = a.snapshotPath(name); path == "" {
+			http.Error(w, "no snapshot file configured for group: "+name, http.StatusNotFound)
+			return
+		}
+		err = g.RestoreFile(path)
+	default:
+		http.Error(w, "from must be file", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, snapshotStatus{Group: name, Path: path})
+}
+
+// intParam 读取整数参数，参数不存在时返回def
+func intParam(r *http.Request, name string, def int) (int, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return def, nil
+	}
+
+	return strconv.Atoi(v)
+}
+
+// writeJSON 以JSON格式返回响应
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,162 @@
+package ycache
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func getJSON(t *testing.T, url string, v interface{}) {
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET %s: %s", url, resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAdminGroupsAndRing(t *testing.T) {
+	g := NewGroup("admin-groups", 2<<10, GetterFunc(func(ctx context.Context, key string) ([]byte, error) {
+		return []byte("value"), nil
+	}))
+	g.Get(context.Background(), "key")
+	g.Get(context.Background(), "key")
+
+	pool := NewHTTPPool("http://self")
+	pool.Set("http://self", "http://a", "http://b")
+	srv := httptest.NewServer(NewAdmin(pool))
+	defer srv.Close()
+
+	var groups []groupStatus
+	getJSON(t, srv.URL+"/groups?group=admin-groups", &groups)
+	if len(groups) != 1 || groups[0].Stats["gets"] != 2 || groups[0].Stats["local_loads"] != 1 {
+		t.Fatalf("groups = %+v", groups)
+	}
+
+	var owner ownerStatus
+	getJSON(t, srv.URL+"/owner?key=key&n=2", &owner)
+	if len(owner.Owners) != 2 || owner.Owner != owner.Owners[0] || owner.Owner != pool.Owners("key", 1)[0] {
+		t.Fatalf("owner = %+v", owner)
+	}
+
+	var ring []ringStatus
+	getJSON(t, srv.URL+"/ring?samples=3000", &ring)
+	if len(ring) != 3 {
+		t.Fatalf("ring = %+v", ring)
+	}
+	total := 0.0
+	for _, r := range ring {
+		if r.Share < 0.1 {
+			t.Errorf("share of %s = %.3f, too small for 3 peers", r.Peer, r.Share)
+		}
+		total += r.Share
+	}
+	if math.Abs(total-1) > 1e-6 {
+		t.Errorf("total share = %f, want 1", total)
+	}
+}
+
+func TestAdminSnapshot(t *testing.T) {
+	warm(newSnapshotGroup("admin-snapshot"), "key", "v-key")
+
+	srv := httptest.NewServer(NewAdmin(NewHTTPPool("http://self")))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/snapshot?group=admin-snapshot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dump, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	dst := NewGroup("admin-snapshot", 2<<10, GetterFunc(func(ctx context.Context, key string) ([]byte, error) {
+		t.Fatal("restored key was loaded")
+		return nil, nil
+	}))
+
+	resp, err = http.Post(srv.URL+"/restore?group=admin-snapshot", "application/octet-stream", bytes.NewReader(dump))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("restore: %s", resp.Status)
+	}
+
+	if v, ok := dst.peek("key"); !ok || v.String() != "v-key" {
+		t.Fatalf("restored key = %q, %v", v.String(), ok)
+	}
+
+	resp, _ = http.Post(srv.URL+"/restore?group=admin-snapshot", "application/octet-stream", bytes.NewReader([]byte("junk")))
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("restoring junk: %s, want 400", resp.Status)
+	}
+}
+
+func TestAdminSnapshotFile(t *testing.T) {
+	warm(newSnapshotGroup("admin-snapshot-file"), "key", "v-key")
+
+	admin := NewAdmin(NewHTTPPool("http://self"))
+	srv := httptest.NewServer(admin)
+	defer srv.Close()
+
+	post := func(path string) int {
+		resp, err := http.Post(srv.URL+path, "application/octet-stream", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// 没有配置快照文件时不能在节点上读写文件
+	if code := post("/snapshot?group=admin-snapshot-file"); code != http.StatusNotFound {
+		t.Fatalf("snapshot without a configured file: %d, want 404", code)
+	}
+
+	file := filepath.Join(t.TempDir(), "admin.snapshot")
+	other := filepath.Join(t.TempDir(), "other.snapshot")
+	admin.HandleSnapshotFiles(func(group string) string {
+		if group == "admin-snapshot-file" {
+			return file
+		}
+		return ""
+	})
+
+	// 请求不能指定文件路径
+	if code := post("/snapshot?group=admin-snapshot-file&path=" + url.QueryEscape(other)); code != http.StatusOK {
+		t.Fatalf("snapshot: %d", code)
+	}
+	if _, err := os.Stat(other); !os.IsNotExist(err) {
+		t.Fatalf("snapshot was written to the requested path: %v", err)
+	}
+	if _, err := os.Stat(file); err != nil {
+		t.Fatalf("snapshot was not written to the configured file: %v", err)
+	}
+
+	dst := NewGroup("admin-snapshot-file", 2<<10, GetterFunc(func(ctx context.Context, key string) ([]byte, error) {
+		t.Fatal("restored key was loaded")
+		return nil, nil
+	}))
+	if code := post("/restore?group=admin-snapshot-file&from=file"); code != http.StatusOK {
+		t.Fatalf("restore: %d", code)
+	}
+	if v, ok := dst.peek("key"); !ok || v.String() != "v-key" {
+		t.Fatalf("restored key = %q, %v", v.String(), ok)
+	}
+}
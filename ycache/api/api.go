@@ -0,0 +1,397 @@
+// Package api 实现 ycache 的 REST API
+//
+//	GET    /v1/groups/{group}/keys/{key}         读取key
+//	HEAD   /v1/groups/{group}/keys/{key}         同 GET，不返回内容
+//	DELETE /v1/groups/{group}/keys/{key}         删除key的缓存，不影响后端存储
+//	GET    /v1/groups/{group}/keys?key=a&key=b   批量读取
+//	POST   /v1/groups/{group}/keys               批量读取，请求体为 {"keys": ["a", "b"]}
+//
+// 读取单个key时：
+//   - 根据 Accept 返回 application/octet-stream（默认）、application/json 或 text/plain，无法满足时返回406
+//   - 返回基于内容的 ETag，请求的 If-None-Match 与之匹配时返回304
+//   - X-Cache 说明数据的来源：HIT 本地缓存，PEER 其他节点，MISS 回源加载
+//
+// 错误以JSON返回：{"error": {"code": 404, "message": "..."}}。
+// key不存在（Getter 返回 ycache.ErrNotFound）时返回404，其余加载失败返回503。
+package api
+
+import (
+	"7days/ycache"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 默认配置
+const (
+	defaultPrefix   = "/v1"
+	defaultTimeout  = 5 * time.Second
+	defaultMaxBatch = 1000
+	maxBatchBody    = 1 << 20
+)
+
+// 支持的响应格式，按默认的优先顺序排列
+const (
+	contentBinary = "application/octet-stream"
+	contentJSON   = "application/json"
+	contentText   = "text/plain"
+)
+
+var offers = []string{contentBinary, contentJSON, contentText}
+
+// Options are the configurations of a Handler.
+type Options struct {
+	// Prefix API的路径前缀。
+	// If blank, it defaults to "/v1".
+	Prefix string
+
+	// Timeout 每个请求读取数据的超时时间。
+	// If blank, it defaults to 5s.
+	Timeout time.Duration
+
+	// MaxBatch 批量读取最多包含多少个key。
+	// If blank, it defaults to 1000.
+	MaxBatch int
+}
+
+// Handler REST API
+type Handler struct {
+	opts Options
+}
+
+// New 创建REST API
+func New(o *Options) *Handler {
+	h := &Handler{}
+	if o != nil {
+		h.opts = *o
+	}
+
+	if h.opts.Prefix == "" {
+		h.opts.Prefix = defaultPrefix
+	}
+	h.opts.Prefix = strings.TrimSuffix(h.opts.Prefix, "/")
+
+	if h.opts.Timeout == 0 {
+		h.opts.Timeout = defaultTimeout
+	}
+
+	if h.opts.MaxBatch == 0 {
+		h.opts.MaxBatch = defaultMaxBatch
+	}
+
+	return h
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// /<prefix>/groups/<group>/keys[/<key>]，key中可以包含转义后的 "/"
+	path := r.URL.EscapedPath()
+	if !strings.HasPrefix(path, h.opts.Prefix+"/groups/") {
+		writeError(w, http.StatusNotFound, "not found: "+r.URL.Path)
+		return
+	}
+
+	parts := strings.SplitN(path[len(h.opts.Prefix+"/groups/"):], "/", 3)
+	if len(parts) < 2 || parts[1] != "keys" {
+		writeError(w, http.StatusNotFound, "not found: "+r.URL.Path)
+		return
+	}
+
+	name, err := url.PathUnescape(parts[0])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	g := ycache.GetGroup(name)
+	if g == nil {
+		writeError(w, http.StatusNotFound, "no such group: "+name)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), h.opts.Timeout)
+	defer cancel()
+
+	if len(parts) == 2 || parts[2] == "" {
+		switch r.Method {
+		case http.MethodGet:
+			h.batch(ctx, w, g, r.URL.Query()["key"])
+		case http.MethodPost:
+			h.batchBody(ctx, w, r, g)
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+		return
+	}
+
+	key, err := url.PathUnescape(parts[2])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		h.get(ctx, w, r, g, key)
+	case http.MethodDelete:
+		h.delete(ctx, w, g, key)
+	default:
+		w.Header().Set("Allow", "GET, HEAD, DELETE")
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// value JSON格式的单个key
+type value struct {
+	Group string `json:"group"`
+	Key   string `json:"key"`
+	Value []byte `json:"value"`
+}
+
+func (h *Handler) get(ctx context.Context, w http.ResponseWriter, r *http.Request, g *ycache.Group, key string) {
+	w.Header().Set("Vary", "Accept")
+
+	contentType := negotiate(r.Header.Get("Accept"))
+	if contentType == "" {
+		writeError(w, http.StatusNotAcceptable, "acceptable types are "+strings.Join(offers, ", "))
+		return
+	}
+
+	view, source, err := g.GetWithSource(ctx, key)
+	if err != nil {
+		writeError(w, errorStatus(err), err.Error())
+		return
+	}
+
+	data := view.ByteSlice()
+	etag := etagOf(data)
+	w.Header().Set("ETag", etag)
+	w.Header().Set("X-Cache", source.CacheStatus())
+	if expire := view.Expire(); !expire.IsZero() {
+		w.Header().Set("Expires", expire.UTC().Format(http.TimeFormat))
+	}
+
+	if matchETag(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	switch contentType {
+	case contentJSON:
+		writeJSON(w, http.StatusOK, value{Group: g.Name(), Key: key, Value: data})
+	case contentText:
+		w.Header().Set("Content-Type", contentText+"; charset=utf-8")
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.Write(data)
+	default:
+		w.Header().Set("Content-Type", contentBinary)
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.Write(data)
+	}
+}
+
+func (h *Handler) delete(ctx context.Context, w http.ResponseWriter, g *ycache.Group, key string) {
+	removed, err := g.Remove(ctx, key)
+	if err != nil {
+		writeError(w, errorStatus(err), err.Error())
+		return
+	}
+
+	if !removed {
+		writeError(w, http.StatusNotFound, "not cached: "+key)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// batchRequest 批量读取的请求体
+type batchRequest struct {
+	Keys []string `json:"keys"`
+}
+
+// batchItem 批量读取中单个key的结果，Error 不为空时读取失败
+type batchItem struct {
+	Key   string     `json:"key"`
+	Value []byte     `json:"value,omitempty"`
+	Cache string     `json:"cache,omitempty"`
+	Error *errorBody `json:"error,omitempty"`
+}
+
+// batchResponse 批量读取的结果，与请求中key的顺序一致
+type batchResponse struct {
+	Group string      `json:"group"`
+	Items []batchItem `json:"items"`
+}
+
+func (h *Handler) batchBody(ctx context.Context, w http.ResponseWriter, r *http.Request, g *ycache.Group) {
+	var req batchRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBatchBody)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "decoding request body: "+err.Error())
+		return
+	}
+
+	h.batch(ctx, w, g, req.Keys)
+}
+
+// batch 并发读取多个key，部分key失败时仍然返回200，失败原因在每个key的结果中
+func (h *Handler) batch(ctx context.Context, w http.ResponseWriter, g *ycache.Group, keys []string) {
+	if len(keys) == 0 {
+		writeError(w, http.StatusBadRequest, "at least one key is required")
+		return
+	}
+
+	if len(keys) > h.opts.MaxBatch {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("at most %d keys are allowed", h.opts.MaxBatch))
+		return
+	}
+
+	items := make([]batchItem, len(keys))
+
+	var wg sync.WaitGroup
+	for i, key := range keys {
+		wg.Add(1)
+		go func(i int, key string) {
+			defer wg.Done()
+
+			item := batchItem{Key: key}
+			view, source, err := g.GetWithSource(ctx, key)
+			if err != nil {
+				item.Error = &errorBody{Code: errorStatus(err), Message: err.Error()}
+			} else {
+				item.Value, item.Cache = view.ByteSlice(), source.CacheStatus()
+			}
+			items[i] = item
+		}(i, key)
+	}
+	wg.Wait()
+
+	writeJSON(w, http.StatusOK, batchResponse{Group: g.Name(), Items: items})
+}
+
+// errorStatus 根据错误选择状态码：key不存在为404，其余加载失败为503
+func errorStatus(err error) int {
+	if errors.Is(err, ycache.ErrNotFound) {
+		return http.StatusNotFound
+	}
+
+	return http.StatusServiceUnavailable
+}
+
+// etagOf 根据内容计算强 ETag，所有节点对同样的值返回同样的 ETag
+func etagOf(data []byte) string {
+	h := fnv.New64a()
+	h.Write(data)
+	return fmt.Sprintf(`"%016x"`, h.Sum64())
+}
+
+// matchETag If-None-Match 是否与etag匹配，按弱比较忽略 W/ 前缀
+func matchETag(header, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// negotiate 根据 Accept 选择响应格式，没有可接受的格式时返回空字符串
+func negotiate(accept string) string {
+	if strings.TrimSpace(accept) == "" {
+		return contentBinary
+	}
+
+	type candidate struct {
+		offer string
+		q     float64
+		order int
+	}
+
+	var candidates []candidate
+	for order, offer := range offers {
+		q := -1.0
+		specificity := -1
+		for _, part := range strings.Split(accept, ",") {
+			mediaType, weight := parseAccept(part)
+			s := matchMediaType(mediaType, offer)
+			// 以最具体的匹配项的权重为准
+			if s > specificity {
+				specificity, q = s, weight
+			}
+		}
+
+		if q > 0 {
+			candidates = append(candidates, candidate{offer, q, order})
+		}
+	}
+
+	if len(candidates) == 0 {
+		return ""
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].q > candidates[j].q
+	})
+	return candidates[0].offer
+}
+
+// parseAccept 解析 Accept 中的一项，返回媒体类型与权重
+func parseAccept(part string) (mediaType string, q float64) {
+	q = 1
+	params := strings.Split(part, ";")
+	mediaType = strings.ToLower(strings.TrimSpace(params[0]))
+
+	for _, p := range params[1:] {
+		p = strings.TrimSpace(p)
+		if strings.HasPrefix(p, "q=") {
+			if v, err := strconv.ParseFloat(p[2:], 64); err == nil {
+				q = v
+			}
+		}
+	}
+
+	return mediaType, q
+}
+
+// matchMediaType 返回匹配的具体程度：2 完全匹配，1 type/*，0 */*，-1 不匹配
+func matchMediaType(mediaType, offer string) int {
+	switch {
+	case mediaType == offer:
+		return 2
+	case strings.HasSuffix(mediaType, "/*") && strings.HasPrefix(offer, mediaType[:len(mediaType)-1]):
+		return 1
+	case mediaType == "*/*":
+		return 0
+	}
+
+	return -1
+}
+
+// errorBody JSON格式的错误
+type errorBody struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func writeError(w http.ResponseWriter, code int, message string) {
+	writeJSON(w, code, struct {
+		Error errorBody `json:"error"`
+	}{errorBody{Code: code, Message: message}})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", contentJSON)
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,188 @@
+package api
+
+import (
+	"7days/ycache"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newServer(t *testing.T, name string) *httptest.Server {
+	ycache.NewGroup(name, 2<<10, ycache.GetterFunc(func(ctx context.Context, key string) ([]byte, error) {
+		switch key {
+		case "missing":
+			return nil, fmt.Errorf("%s: %w", key, ycache.ErrNotFound)
+		case "broken":
+			return nil, fmt.Errorf("database is down")
+		}
+		return []byte("value of " + key), nil
+	}))
+
+	srv := httptest.NewServer(New(nil))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func request(t *testing.T, method, url string, header map[string]string) (*http.Response, string) {
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := ioutil.ReadAll(resp.Body)
+	return resp, string(body)
+}
+
+func TestGet(t *testing.T) {
+	srv := newServer(t, "api-get")
+	u := srv.URL + "/v1/groups/api-get/keys/a%2Fb"
+
+	resp, body := request(t, http.MethodGet, u, nil)
+	if resp.StatusCode != http.StatusOK || body != "value of a/b" {
+		t.Fatalf("GET = %d %q", resp.StatusCode, body)
+	}
+	if resp.Header.Get("X-Cache") != "MISS" || resp.Header.Get("Content-Type") != contentBinary {
+		t.Fatalf("headers = %v", resp.Header)
+	}
+
+	etag := resp.Header.Get("ETag")
+	resp, _ = request(t, http.MethodGet, u, map[string]string{"If-None-Match": `"other", ` + etag})
+	if resp.StatusCode != http.StatusNotModified || resp.Header.Get("X-Cache") != "HIT" {
+		t.Fatalf("conditional GET = %d, X-Cache %s", resp.StatusCode, resp.Header.Get("X-Cache"))
+	}
+
+	resp, body = request(t, http.MethodGet, u, map[string]string{"Accept": "text/html, application/json;q=0.9, */*;q=0.1"})
+	var v value
+	if err := json.Unmarshal([]byte(body), &v); err != nil || resp.Header.Get("Content-Type") != contentJSON {
+		t.Fatalf("JSON GET = %q, %v", body, err)
+	}
+	if v.Group != "api-get" || v.Key != "a/b" || string(v.Value) != "value of a/b" {
+		t.Fatalf("JSON value = %+v", v)
+	}
+
+	resp, _ = request(t, http.MethodGet, u, map[string]string{"Accept": "text/*"})
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), contentText) {
+		t.Fatalf("text GET Content-Type = %s", resp.Header.Get("Content-Type"))
+	}
+
+	resp, _ = request(t, http.MethodGet, u, map[string]string{"Accept": "image/png"})
+	if resp.StatusCode != http.StatusNotAcceptable {
+		t.Fatalf("GET image/png = %d", resp.StatusCode)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	srv := newServer(t, "api-errors")
+
+	cases := []struct {
+		method, path string
+		code         int
+	}{
+		{http.MethodGet, "/v1/groups/api-errors/keys/missing", http.StatusNotFound},
+		{http.MethodGet, "/v1/groups/api-errors/keys/broken", http.StatusServiceUnavailable},
+		{http.MethodGet, "/v1/groups/api-none/keys/a", http.StatusNotFound},
+		{http.MethodGet, "/v2/groups/api-errors/keys/a", http.StatusNotFound},
+		{http.MethodPut, "/v1/groups/api-errors/keys/a", http.StatusMethodNotAllowed},
+		{http.MethodGet, "/v1/groups/api-errors/keys", http.StatusBadRequest},
+	}
+
+	for _, tc := range cases {
+		resp, body := request(t, tc.method, srv.URL+tc.path, nil)
+
+		var e struct {
+			Error errorBody `json:"error"`
+		}
+		if err := json.Unmarshal([]byte(body), &e); err != nil {
+			t.Fatalf("%s %s: %q is not a JSON error", tc.method, tc.path, body)
+		}
+
+		if resp.StatusCode != tc.code || e.Error.Code != tc.code || e.Error.Message == "" {
+			t.Fatalf("%s %s = %d %q, want %d", tc.method, tc.path, resp.StatusCode, body, tc.code)
+		}
+	}
+}
+
+func TestDelete(t *testing.T) {
+	srv := newServer(t, "api-delete")
+	u := srv.URL + "/v1/groups/api-delete/keys/a"
+
+	request(t, http.MethodGet, u, nil)
+	if resp, _ := request(t, http.MethodDelete, u, nil); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("DELETE = %d", resp.StatusCode)
+	}
+
+	if resp, _ := request(t, http.MethodDelete, u, nil); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("second DELETE = %d", resp.StatusCode)
+	}
+
+	if resp, _ := request(t, http.MethodGet, u, nil); resp.Header.Get("X-Cache") != "MISS" {
+		t.Fatalf("GET after DELETE X-Cache = %s", resp.Header.Get("X-Cache"))
+	}
+}
+
+func TestBatch(t *testing.T) {
+	srv := newServer(t, "api-batch")
+
+	check := func(body string) {
+		var resp batchResponse
+		if err := json.Unmarshal([]byte(body), &resp); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(resp.Items) != 2 {
+			t.Fatalf("batch = %q", body)
+		}
+
+		a, missing := resp.Items[0], resp.Items[1]
+		if a.Key != "a" || string(a.Value) != "value of a" || a.Error != nil {
+			t.Fatalf("item a = %+v", a)
+		}
+		if missing.Key != "missing" || missing.Error == nil || missing.Error.Code != http.StatusNotFound {
+			t.Fatalf("item missing = %+v", missing)
+		}
+	}
+
+	_, body := request(t, http.MethodGet, srv.URL+"/v1/groups/api-batch/keys?key=a&key=missing", nil)
+	check(body)
+
+	resp, err := http.Post(srv.URL+"/v1/groups/api-batch/keys", contentJSON, strings.NewReader(`{"keys": ["a", "missing"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, _ := ioutil.ReadAll(resp.Body)
+	check(string(b))
+}
+
+func TestNegotiate(t *testing.T) {
+	cases := map[string]string{
+		"":                                   contentBinary,
+		"*/*":                                contentBinary,
+		"application/json":                   contentJSON,
+		"text/plain;q=0.5, application/json": contentJSON,
+		"application/*;q=0.2, text/plain":    contentText,
+		"application/json;q=0, */*":          contentBinary,
+		"application/json;q=0, text/html":    "",
+		"application/octet-stream;q=0, */*":  contentJSON,
+	}
+
+	for accept, want := range cases {
+		if got := negotiate(accept); got != want {
+			t.Errorf("negotiate(%q) = %q, want %q", accept, got, want)
+		}
+	}
+}
@@ -1,7 +1,12 @@
 package ycache
 
+import "time"
+
 type ByteView struct {
-	data []byte
+	data   []byte
+	expire time.Time // 过期时间，零值表示永不过期
+	gen    uint64    // 写入缓存时Group的generation
+	tags   []string  // Getter 为数据设置的标签
 }
 
 func (b ByteView) Len() int {
@@ -21,3 +26,33 @@ func cloneBytes(b []byte) []byte {
 func (b ByteView) ByteSlice() []byte {
 	return cloneBytes(b.data)
 }
+
+// Tags 返回数据的标签
+func (b ByteView) Tags() []string {
+	return b.tags
+}
+
+// Expire 返回过期时间，零值表示永不过期
+func (b ByteView) Expire() time.Time {
+	return b.expire
+}
+
+func (b ByteView) expired(now time.Time) bool {
+	return !b.expire.IsZero() && !now.Before(b.expire)
+}
+
+// unixNano 把过期时间转换为纳秒时间戳，永不过期时为0
+func unixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+// fromUnixNano 是 unixNano 的逆操作
+func fromUnixNano(n int64) time.Time {
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n)
+}
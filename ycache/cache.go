@@ -1,38 +1,434 @@
 package ycache
 
 import (
+	"7days/ycache/disk"
 	"7days/ycache/lru"
+	"hash/fnv"
+	"log"
+	"strconv"
 	"sync"
+	"time"
 )
 
 type cache struct {
 	mu         sync.Mutex
 	lruk       *lru.LRUKCache
 	cacheBytes int
+	disk       *disk.Store // 从内存中淘汰的数据写入磁盘，为nil时不使用磁盘
+
+	tags          map[string]map[string]struct{} // tag → keys，只包含内存中的数据
+	keyTags       map[string][]string            // 带标签的key → tags
+	invalidations uint64                         // removeTag 的次数
+	versions      [versionStripes]uint64         // 按key的hash分组的 set/remove 次数，见 addLoaded
+	evictions     int64
+
+	pending     map[string]*diskWrite // 等待在 c.mu 之外写入或删除的磁盘数据，key见 diskKey
+	writing     bool                  // 是否有调用方正在处理 pending
+	diskDeletes uint64                // 从磁盘中删除数据的次数
+}
+
+// versionStripes 记录 set/remove 次数的分组数，同一分组中其他key的写入只会使加载结果不被缓存
+const versionStripes = 256
+
+// loadToken 加载开始时的失效状态，见 addLoaded
+type loadToken struct {
+	invalidations uint64 // removeTag 的次数
+	version       uint64 // key所在分组的 set/remove 次数
+}
+
+// diskWrite 等待在 c.mu 之外写入磁盘的数据，remove 为true时从磁盘中删除key
+type diskWrite struct {
+	key    string
+	value  ByteView
+	remove bool
 }
 
 func (c *cache) add(key string, value ByteView) {
+	defer c.writeEvicted()
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	c.put(key, value, len(value.tags) > 0)
+}
 
+// restore 把快照中的数据直接加入缓存表，快照中只有缓存表中的热点数据，
+// 恢复到临时表会使它们在下一次快照中丢失
+func (c *cache) restore(key string, value ByteView) {
+	defer c.writeEvicted()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.put(key, value, len(value.tags) > 0)
+	c.lruk.Promote(key)
+}
+
+// set 更新缓存，磁盘中旧的值同时失效
+func (c *cache) set(key string, value ByteView) {
+	defer c.writeEvicted()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.versions[versionStripe(key)]++
+	c.put(key, value, true)
+}
+
+// put 写入内存并更新标签索引，调用方需持有 c.mu
+func (c *cache) put(key string, value ByteView, dropDisk bool) {
 	if c.lruk == nil {
 		c.lruk = lru.NewLRUKCache(c.cacheBytes, 2)
+		c.lruk.OnEvicted = c.evicted
+		c.tags = make(map[string]map[string]struct{})
+		c.keyTags = make(map[string][]string)
 	}
 
+	c.unindex(key)
 	c.lruk.Add(key, value)
+	c.index(key, value.tags)
+
+	// 带标签的数据只保存在内存中，磁盘中旧的值不能再被读到
+	if dropDisk && c.disk != nil {
+		c.deleteDisk(diskKey(key, value.gen))
+	}
+}
+
+// deleteDisk 从磁盘中删除key，由 writeEvicted 在 c.mu 之外删除，调用方需持有 c.mu
+// 删除完成之前 get 不会读取磁盘中的旧数据
+func (c *cache) deleteDisk(key string) {
+	if c.pending == nil {
+		c.pending = make(map[string]*diskWrite)
+	}
+
+	c.pending[key] = &diskWrite{key: key, remove: true}
+	c.diskDeletes++
+}
+
+// index 把key加入标签索引，调用方需持有 c.mu
+func (c *cache) index(key string, tags []string) {
+	if len(tags) == 0 {
+		return
+	}
+
+	c.keyTags[key] = tags
+	for _, tag := range tags {
+		keys, ok := c.tags[tag]
+		if !ok {
+			keys = make(map[string]struct{})
+			c.tags[tag] = keys
+		}
+		keys[key] = struct{}{}
+	}
 }
 
-func (c *cache) get(key string) (value ByteView, ok bool) {
+// unindex 从标签索引中删除key，调用方需持有 c.mu
+func (c *cache) unindex(key string) {
+	tags, ok := c.keyTags[key]
+	if !ok {
+		return
+	}
+
+	delete(c.keyTags, key)
+	for _, tag := range tags {
+		delete(c.tags[tag], key)
+		if len(c.tags[tag]) == 0 {
+			delete(c.tags, tag)
+		}
+	}
+}
+
+// removeTag 删除带有tag的所有数据，返回删除的key
+func (c *cache) removeTag(tag string) []string {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
+	c.invalidations++
 	if c.lruk == nil {
+		return nil
+	}
+
+	// unindex 会修改 c.tags[tag]，先取出所有key
+	var keys []string
+	for key := range c.tags[tag] {
+		keys = append(keys, key)
+	}
+
+	for _, key := range keys {
+		c.lruk.Remove(key)
+		c.unindex(key)
+	}
+
+	return keys
+}
+
+// remove 从内存与磁盘中删除key，返回内存或磁盘中是否有generation不小于gen的数据
+func (c *cache) remove(key string, gen uint64) bool {
+	defer c.writeEvicted()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.versions[versionStripe(key)]++
+	removed := false
+	if c.lruk != nil {
+		if v, ok := c.lruk.Peek(key); ok {
+			removed = c.valid(v.(ByteView), gen)
+			c.lruk.Remove(key)
+			c.unindex(key)
+		}
+	}
+
+	if c.disk != nil {
+		dk := diskKey(key, gen)
+		if c.onDisk(dk) {
+			removed = true
+			c.deleteDisk(dk)
+		}
+	}
+
+	return removed
+}
+
+// onDisk 判断key是否在磁盘或等待写入磁盘的数据中，只查询索引，调用方需持有 c.mu
+func (c *cache) onDisk(key string) bool {
+	if w, ok := c.pending[key]; ok {
+		return !w.remove
+	}
+
+	return c.disk.Has(key)
+}
+
+// startLoad 返回加载开始时的失效状态，加载结束后传给 addLoaded
+func (c *cache) startLoad(key string) loadToken {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return loadToken{invalidations: c.invalidations, version: c.versions[versionStripe(key)]}
+}
+
+// versionStripe 返回key所在的分组
+func versionStripe(key string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return h.Sum32() % versionStripes
+}
+
+// addLoaded 加入加载得到的数据，加载期间key被 set/remove 时加载的结果可能比新的值旧，
+// 执行过 removeTag 时带标签的数据可能已经失效，都不放入缓存。
+// 已经过期的数据（如 Getter 要求不缓存的数据）同样不放入缓存
+func (c *cache) addLoaded(key string, value ByteView, t loadToken) {
+	defer c.writeEvicted()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.versions[versionStripe(key)] != t.version {
+		return
+	}
+
+	if len(value.tags) > 0 && c.invalidations != t.invalidations {
+		return
+	}
+
+	if value.expired(time.Now()) {
+		return
+	}
+
+	c.put(key, value, len(value.tags) > 0)
+}
+
+// get 查询缓存，generation小于gen的数据视为未命中
+func (c *cache) get(key string, gen uint64) (value ByteView, ok bool) {
+	// 命中临时表的数据可能进入缓存表并淘汰其他数据
+	defer c.writeEvicted()
+
+	c.mu.Lock()
+	if c.lruk != nil {
+		if v, ok := c.lruk.Get(key); ok && c.valid(v.(ByteView), gen) {
+			c.mu.Unlock()
+			return v.(ByteView), ok
+		}
+	}
+
+	if value, ok := c.takePending(key, gen); ok {
+		c.mu.Unlock()
+		return value, true
+	}
+
+	if c.removing(key, gen) {
+		c.mu.Unlock()
+		return
+	}
+
+	d := c.disk
+	deletes := c.diskDeletes
+	c.mu.Unlock()
+
+	if d == nil {
+		return
+	}
+
+	// 内存未命中时在 c.mu 之外读取磁盘，命中的数据重新放回内存
+	data, expire, ok := d.Get(diskKey(key, gen))
+	if !ok {
+		return
+	}
+
+	value = ByteView{data: data, expire: fromUnixNano(expire), gen: gen}
+	if value.expired(time.Now()) {
+		d.Delete(diskKey(key, gen))
+		return ByteView{}, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// 读取磁盘期间key可能被重新写入内存或被淘汰，它们都比磁盘中的副本新
+	if c.lruk != nil {
+		if v, ok := c.lruk.Peek(key); ok && v.(ByteView).gen >= gen {
+			if !c.valid(v.(ByteView), gen) {
+				return ByteView{}, false
+			}
+			return v.(ByteView), true
+		}
+	}
+
+	if value, ok := c.takePending(key, gen); ok {
+		return value, true
+	}
+
+	// 读取期间key被删除，读到的是旧数据
+	if c.removing(key, gen) {
+		return ByteView{}, false
+	}
+
+	// 读取期间磁盘中的数据被删除过，不再放回内存
+	if c.diskDeletes == deletes {
+		c.put(key, value, false)
+	}
+
+	return value, true
+}
+
+// takePending 把淘汰后尚未写入磁盘的数据放回内存，调用方需持有 c.mu
+func (c *cache) takePending(key string, gen uint64) (ByteView, bool) {
+	w, ok := c.pending[diskKey(key, gen)]
+	if !ok || w.remove || w.value.expired(time.Now()) {
+		return ByteView{}, false
+	}
+
+	delete(c.pending, w.key)
+	c.put(key, w.value, false)
+	return w.value, true
+}
+
+// removing 判断key是否正在从磁盘中删除，调用方需持有 c.mu
+func (c *cache) removing(key string, gen uint64) bool {
+	w, ok := c.pending[diskKey(key, gen)]
+	return ok && w.remove
+}
+
+func (c *cache) valid(v ByteView, gen uint64) bool {
+	return v.gen >= gen && !v.expired(time.Now())
+}
+
+// evicted 把从内存中淘汰的数据加入等待写入磁盘的队列，由 writeEvicted 在 c.mu 之外写入，调用方需持有 c.mu
+// 带标签的数据不写入磁盘，保证 removeTag 能找到所有带标签的数据
+func (c *cache) evicted(key lru.Key, value interface{}) {
+	c.evictions++
+	c.unindex(key.(string))
+
+	v := value.(ByteView)
+	if c.disk == nil || len(v.tags) > 0 || v.expired(time.Now()) {
 		return
 	}
 
-	if v, ok := c.lruk.Get(key); ok {
-		return v.(ByteView), ok
+	if c.pending == nil {
+		c.pending = make(map[string]*diskWrite)
+	}
+
+	dk := diskKey(key.(string), v.gen)
+	c.pending[dk] = &diskWrite{key: dk, value: v}
+}
+
+// writeEvicted 把等待写入的数据写入磁盘并删除等待删除的key，读写磁盘时不持有 c.mu
+// 同一时间只有一个调用方负责写入，其他调用方加入的数据也由它写入
+func (c *cache) writeEvicted() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.writing || len(c.pending) == 0 {
+		return
+	}
+	c.writing = true
+
+	for len(c.pending) > 0 {
+		var w *diskWrite
+		for _, w = range c.pending {
+			break
+		}
+		d := c.disk
+
+		c.mu.Unlock()
+		var err error
+		if w.remove {
+			d.Delete(w.key)
+		} else {
+			err = d.Put(w.key, w.value.data, unixNano(w.value.expire))
+		}
+		c.mu.Lock()
+
+		if err != nil {
+			log.Println("[ycache] Failed to write evicted entry to disk", err)
+		}
+
+		if cur, ok := c.pending[w.key]; !ok && !w.remove {
+			// 写入期间数据被放回了内存，磁盘中的副本已经过时
+			c.pending[w.key] = &diskWrite{key: w.key, remove: true}
+		} else if ok && cur == w {
+			delete(c.pending, w.key)
+		}
+	}
+
+	c.writing = false
+}
+
+// stats 返回统计信息
+func (c *cache) stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	st := CacheStats{Evictions: c.evictions}
+	if c.lruk != nil {
+		st.Items = int64(c.lruk.Len())
+	}
+
+	return st
+}
+
+// setDisk 设置磁盘存储
+func (c *cache) setDisk(d *disk.Store) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.disk = d
+}
+
+// hottest 按从热到冷的顺序返回最多n个缓存内容，n<=0 时返回全部
+func (c *cache) hottest(n int) (keys []string, values []ByteView) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.lruk == nil {
+		return
 	}
 
+	now := time.Now()
+	c.lruk.Range(func(key lru.Key, value interface{}) bool {
+		if value.(ByteView).expired(now) {
+			return true
+		}
+
+		keys = append(keys, key.(string))
+		values = append(values, value.(ByteView))
+		return n <= 0 || len(keys) < n
+	})
+
 	return
 }
+
+// diskKey 磁盘中的key包含generation，旧的数据不会被读到，之后随段文件一起被删除
+func diskKey(key string, gen uint64) string {
+	return strconv.FormatUint(gen, 10) + "/" + key
+}
@@ -0,0 +1,138 @@
+// Package circuit 实现熔断器
+//
+// 熔断器有三种状态:
+//   - Closed   正常放行请求，连续失败达到阈值后进入 Open
+//   - Open     拒绝所有请求，经过 OpenTimeout 后进入 HalfOpen
+//   - HalfOpen 只放行一个探测请求，成功则回到 Closed，失败则回到 Open
+package circuit
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrOpen 熔断器处于打开状态时返回的错误
+var ErrOpen = errors.New("circuit breaker is open")
+
+// State 熔断器状态
+type State int
+
+const (
+	Closed State = iota
+	Open
+	HalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	}
+
+	return "unknown"
+}
+
+// Breaker 熔断器
+type Breaker struct {
+	mu          sync.Mutex
+	threshold   int           // 连续失败多少次后打开
+	openTimeout time.Duration // 打开后多久进入半开状态
+	state       State
+	failures    int       // 连续失败次数
+	openedAt    time.Time // 打开的时间
+	probing     bool      // 半开状态下是否已经放行了探测请求
+
+	// now 返回当前时间，测试时可以替换
+	now func() time.Time
+}
+
+// New 创建熔断器
+func New(threshold int, openTimeout time.Duration) *Breaker {
+	if threshold < 1 {
+		threshold = 1
+	}
+
+	return &Breaker{
+		threshold:   threshold,
+		openTimeout: openTimeout,
+		now:         time.Now,
+	}
+}
+
+// Allow 判断是否放行请求
+// 放行后调用方必须调用 Success 或 Failure 报告请求的结果，没有发出请求时调用 Release
+func (b *Breaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case Open:
+		if b.now().Sub(b.openedAt) < b.openTimeout {
+			return false
+		}
+
+		b.state = HalfOpen
+		b.probing = true
+		return true
+	case HalfOpen:
+		if b.probing {
+			return false
+		}
+
+		b.probing = true
+		return true
+	}
+
+	return true
+}
+
+// Success 报告请求成功，熔断器回到关闭状态
+func (b *Breaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.state = Closed
+	b.failures = 0
+	b.probing = false
+}
+
+// Failure 报告请求失败
+func (b *Breaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	if b.state == HalfOpen || b.failures >= b.threshold {
+		b.state = Open
+		b.openedAt = b.now()
+		b.probing = false
+	}
+}
+
+// Release 归还已经放行但没有发出的请求，如调用方在发出请求之前取消
+// 半开状态下之后可以再放行一个探测请求
+func (b *Breaker) Release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == HalfOpen {
+		b.probing = false
+	}
+}
+
+// State 返回熔断器当前的状态
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == Open && b.now().Sub(b.openedAt) >= b.openTimeout {
+		return HalfOpen
+	}
+
+	return b.state
+}
@@ -0,0 +1,109 @@
+package circuit
+
+import (
+	"testing"
+	"time"
+)
+
+// fakeClock 手动拨动的时钟
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) now() time.Time {
+	return c.t
+}
+
+func newTestBreaker() (*Breaker, *fakeClock) {
+	clock := &fakeClock{t: time.Unix(0, 0)}
+	b := New(3, time.Second)
+	b.now = clock.now
+	return b, clock
+}
+
+func TestOpenAfterFailures(t *testing.T) {
+	b, _ := newTestBreaker()
+
+	for i := 0; i < 3; i++ {
+		if !b.Allow() {
+			t.Fatalf("closed breaker rejected request %d", i)
+		}
+		b.Failure()
+	}
+
+	if b.State() != Open {
+		t.Fatalf("state = %v after 3 failures, want open", b.State())
+	}
+
+	if b.Allow() {
+		t.Fatal("open breaker allowed a request")
+	}
+}
+
+func TestSuccessResetsFailures(t *testing.T) {
+	b, _ := newTestBreaker()
+
+	b.Failure()
+	b.Failure()
+	b.Success()
+	b.Failure()
+	b.Failure()
+
+	if b.State() != Closed {
+		t.Fatalf("state = %v, want closed: failures are not consecutive", b.State())
+	}
+}
+
+func TestHalfOpen(t *testing.T) {
+	b, clock := newTestBreaker()
+	for i := 0; i < 3; i++ {
+		b.Failure()
+	}
+
+	clock.t = clock.t.Add(time.Second)
+	if b.State() != HalfOpen {
+		t.Fatalf("state = %v after open timeout, want half-open", b.State())
+	}
+
+	// 半开状态只放行一个探测请求
+	if !b.Allow() {
+		t.Fatal("half-open breaker rejected the probe")
+	}
+	if b.Allow() {
+		t.Fatal("half-open breaker allowed a second request")
+	}
+
+	// 探测失败后重新打开
+	b.Failure()
+	if b.State() != Open || b.Allow() {
+		t.Fatalf("state = %v after failed probe, want open", b.State())
+	}
+
+	clock.t = clock.t.Add(time.Second)
+	if !b.Allow() {
+		t.Fatal("half-open breaker rejected the probe")
+	}
+
+	b.Success()
+	if b.State() != Closed || !b.Allow() || !b.Allow() {
+		t.Fatalf("state = %v after successful probe, want closed", b.State())
+	}
+}
+
+func TestRelease(t *testing.T) {
+	b, clock := newTestBreaker()
+	for i := 0; i < 3; i++ {
+		b.Failure()
+	}
+
+	clock.t = clock.t.Add(time.Second)
+	if !b.Allow() {
+		t.Fatal("half-open breaker rejected the probe")
+	}
+
+	// 归还没有发出的探测请求后可以再放行一个
+	b.Release()
+	if b.State() != HalfOpen || !b.Allow() {
+		t.Fatalf("state = %v after release, want half-open allowing a probe", b.State())
+	}
+}
@@ -0,0 +1,555 @@
+// Package client 是 ycache 的Go客户端
+//
+// Client 与 HTTPPool 使用同样的一致性哈希，直接请求负责key的节点，
+// 节点列表来自配置或管理接口的 /peers。
+// 读取到的数据保存在本地的近端缓存中，通过订阅每个节点的事件流（见 ycache.EventHandler）保持一致：
+//   - 只有在负责该key的节点的事件流已连接时才使用近端缓存
+//   - 收到 set/remove 事件时删除对应的key，收到 tag 事件时删除带有该标签的key
+//   - 收到 generation/reset 事件时清空近端缓存
+package client
+
+import (
+	"7days/ycache"
+	"7days/ycache/consistenthash"
+	"7days/ycache/lru"
+	pb "7days/ycache/ycachepb"
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// 默认配置
+const (
+	defaultBasePath        = "/_ycache/"
+	defaultEventsPath      = "/_events"
+	defaultReplicas        = 50
+	defaultNearCacheSize   = 1024
+	defaultRefreshInterval = 10 * time.Second
+	reconnectBackoff       = time.Second
+	maxConcurrentGets      = 16
+)
+
+// ErrNoPeers 没有可用的节点
+var ErrNoPeers = errors.New("client: no peers")
+
+// Options are the configurations of a Client.
+type Options struct {
+	// Peers 节点地址列表，例如 "http://10.0.0.1:8001"。
+	// Peers 与 AdminURL 至少设置一个，都设置时以管理接口返回的节点为准。
+	Peers []string
+
+	// AdminURL 节点管理接口的地址，例如 "http://10.0.0.1:8001/_admin"，
+	// 定期从它的 /peers 读取节点列表及权重，只使用健康的节点。
+	AdminURL string
+
+	// RefreshInterval 从管理接口更新节点列表的间隔。
+	// If blank, it defaults to 10s.
+	RefreshInterval time.Duration
+
+	// BasePath 节点处理 ycache 请求的路径，需要与 HTTPPoolOptions.BasePath 一致。
+	// If blank, it defaults to "/_ycache/".
+	BasePath string
+
+	// EventsPath 节点事件流的路径。
+	// If blank, it defaults to "/_events".
+	EventsPath string
+
+	// Replicas 与 HashFn 需要与 HTTPPoolOptions 一致，保证选出相同的节点。
+	// If blank, they default to 50 and crc32.ChecksumIEEE.
+	Replicas int
+	HashFn   consistenthash.Hash
+
+	// NearCacheSize 近端缓存最多保存多少个key，小于0时不使用近端缓存。
+	// If blank, it defaults to 1024.
+	NearCacheSize int
+
+	// HTTPClient 发送请求的客户端，事件流是长连接，不要设置 Timeout，请使用 context 控制超时。
+	// If blank, it defaults to http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+// Client ycache的客户端，可以被多个goroutine同时使用
+type Client struct {
+	group string
+	opts  Options
+
+	mu      sync.Mutex
+	ring    *consistenthash.Map
+	streams map[string]*stream // 每个节点的事件流
+	near    *lru.Cache         // key → *nearEntry
+	tags    map[string]map[string]struct{}
+	changes uint64 // 收到事件或事件流连接状态变化的次数
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// nearEntry 近端缓存中的数据
+type nearEntry struct {
+	value []byte
+	peer  string // 返回该数据的节点
+	tags  []string
+}
+
+// stream 一个节点的事件流
+type stream struct {
+	peer      string
+	cancel    context.CancelFunc
+	connected bool   // 由 Client.mu 保护
+	lastID    string // 最后收到的事件id，重新连接时从它之后继续
+}
+
+// New 创建访问group的客户端，设置了 AdminURL 时先读取一次节点列表
+func New(group string, o *Options) (*Client, error) {
+	c := &Client{
+		group:   group,
+		streams: make(map[string]*stream),
+		tags:    make(map[string]map[string]struct{}),
+	}
+	if o != nil {
+		c.opts = *o
+	}
+
+	if c.opts.Peers == nil && c.opts.AdminURL == "" {
+		return nil, errors.New("client: Peers or AdminURL is required")
+	}
+
+	if c.opts.RefreshInterval == 0 {
+		c.opts.RefreshInterval = defaultRefreshInterval
+	}
+
+	if c.opts.BasePath == "" {
+		c.opts.BasePath = defaultBasePath
+	}
+
+	if c.opts.EventsPath == "" {
+		c.opts.EventsPath = defaultEventsPath
+	}
+
+	if c.opts.Replicas == 0 {
+		c.opts.Replicas = defaultReplicas
+	}
+
+	if c.opts.NearCacheSize == 0 {
+		c.opts.NearCacheSize = defaultNearCacheSize
+	}
+
+	if c.opts.HTTPClient == nil {
+		c.opts.HTTPClient = http.DefaultClient
+	}
+
+	if c.opts.NearCacheSize > 0 {
+		c.near = lru.New(c.opts.NearCacheSize)
+		c.near.OnEvicted = c.evicted
+	}
+
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+
+	weights := make(map[string]int)
+	for _, peer := range c.opts.Peers {
+		weights[peer] = 1
+	}
+	c.setPeers(weights)
+
+	if c.opts.AdminURL != "" {
+		if err := c.refresh(); err != nil {
+			c.Close()
+			return nil, err
+		}
+		go c.watch()
+	}
+
+	return c, nil
+}
+
+// Close 停止订阅事件流与更新节点列表
+func (c *Client) Close() {
+	c.cancel()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for peer, s := range c.streams {
+		s.cancel()
+		delete(c.streams, peer)
+	}
+}
+
+// Get 读取key的值，近端缓存未命中时请求负责该key的节点
+func (c *Client) Get(ctx context.Context, key string) ([]byte, error) {
+	if key == "" {
+		return nil, errors.New("key is required")
+	}
+
+	c.mu.Lock()
+	peer := c.pick(key)
+	if value, ok := c.nearGet(key, peer); ok {
+		c.mu.Unlock()
+		return value, nil
+	}
+	changes := c.changes
+	c.mu.Unlock()
+
+	if peer == "" {
+		return nil, ErrNoPeers
+	}
+
+	resp, err := c.fetch(ctx, peer, key)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.nearAdd(key, peer, resp, changes)
+	c.mu.Unlock()
+
+	return resp.GetValue(), nil
+}
+
+// GetMany 并发读取多个key，返回读取成功的key的值
+// 部分key读取失败时返回的错误中包含失败的数量
+func (c *Client) GetMany(ctx context.Context, keys []string) (map[string][]byte, error) {
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		values = make(map[string][]byte, len(keys))
+		failed int
+		last   error
+	)
+
+	sem := make(chan struct{}, maxConcurrentGets)
+	for _, key := range keys {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(key string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			value, err := c.Get(ctx, key)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				failed++
+				last = err
+				return
+			}
+			values[key] = value
+		}(key)
+	}
+	wg.Wait()
+
+	if failed > 0 {
+		return values, fmt.Errorf("failed to get %d of %d keys: %v", failed, len(keys), last)
+	}
+
+	return values, nil
+}
+
+// pick 根据key选择节点，调用方需持有 c.mu
+func (c *Client) pick(key string) string {
+	return c.ring.Get(key)
+}
+
+// fetch 从节点读取key
+func (c *Client) fetch(ctx context.Context, peer, key string) (*pb.Response, error) {
+	u := fmt.Sprintf(
+		"%v%v%v/%v",
+		peer,
+		c.opts.BasePath,
+		url.QueryEscape(c.group),
+		url.QueryEscape(key),
+	)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.opts.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("reading response body: %v", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("server returned %v: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	out := &pb.Response{}
+	if err := proto.Unmarshal(body, out); err != nil {
+		return nil, fmt.Errorf("decoding response body: %v", err)
+	}
+
+	return out, nil
+}
+
+// nearGet 查询近端缓存，数据必须来自当前负责该key且事件流已连接的节点，调用方需持有 c.mu
+func (c *Client) nearGet(key, peer string) ([]byte, bool) {
+	if c.near == nil {
+		return nil, false
+	}
+
+	v, ok := c.near.Get(key)
+	if !ok {
+		return nil, false
+	}
+
+	e := v.(*nearEntry)
+	if s, ok := c.streams[e.peer]; e.peer != peer || !ok || !s.connected {
+		return nil, false
+	}
+
+	// 调用方可能修改返回的值，返回副本
+	return append([]byte(nil), e.value...), true
+}
+
+// nearAdd 加入近端缓存，调用方需持有 c.mu
+// 请求期间收到过事件或事件流断开时，无法确认数据仍然有效，不放入近端缓存
+func (c *Client) nearAdd(key, peer string, resp *pb.Response, changes uint64) {
+	if c.near == nil || c.changes != changes {
+		return
+	}
+
+	if s, ok := c.streams[peer]; !ok || !s.connected {
+		return
+	}
+
+	c.near.Remove(key)
+	c.near.Add(key, &nearEntry{value: resp.GetValue(), peer: peer, tags: resp.GetTags()})
+
+	for _, tag := range resp.GetTags() {
+		keys, ok := c.tags[tag]
+		if !ok {
+			keys = make(map[string]struct{})
+			c.tags[tag] = keys
+		}
+		keys[key] = struct{}{}
+	}
+}
+
+// evicted 从标签索引中删除key，调用方需持有 c.mu
+func (c *Client) evicted(key lru.Key, value interface{}) {
+	for _, tag := range value.(*nearEntry).tags {
+		delete(c.tags[tag], key.(string))
+		if len(c.tags[tag]) == 0 {
+			delete(c.tags, tag)
+		}
+	}
+}
+
+// purge 清空近端缓存，调用方需持有 c.mu
+func (c *Client) purge() {
+	if c.near == nil {
+		return
+	}
+
+	c.near = lru.New(c.opts.NearCacheSize)
+	c.near.OnEvicted = c.evicted
+	c.tags = make(map[string]map[string]struct{})
+}
+
+// apply 根据事件更新近端缓存
+func (c *Client) apply(e ycache.Event) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.changes++
+	if c.near == nil {
+		return
+	}
+
+	switch e.Type {
+	case ycache.EventSet, ycache.EventRemove:
+		c.near.Remove(e.Key)
+	case ycache.EventTag:
+		for key := range c.tags[e.Tag] {
+			c.near.Remove(key)
+		}
+	case ycache.EventGeneration, ycache.EventReset:
+		c.purge()
+	}
+}
+
+// setPeers 更新哈希环，为新的节点订阅事件流，停止已移除节点的事件流
+func (c *Client) setPeers(weights map[string]int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.ctx.Err() != nil {
+		return
+	}
+
+	c.ring = consistenthash.New(c.opts.Replicas, c.opts.HashFn)
+	for peer, weight := range weights {
+		c.ring.AddWeighted(peer, weight)
+
+		if _, ok := c.streams[peer]; !ok {
+			ctx, cancel := context.WithCancel(c.ctx)
+			s := &stream{peer: peer, cancel: cancel}
+			c.streams[peer] = s
+			go c.subscribe(ctx, s)
+		}
+	}
+
+	for peer, s := range c.streams {
+		if _, ok := weights[peer]; !ok {
+			s.cancel()
+			delete(c.streams, peer)
+		}
+	}
+}
+
+// refresh 从管理接口读取节点列表
+func (c *Client) refresh() error {
+	ctx, cancel := context.WithTimeout(c.ctx, c.opts.RefreshInterval)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(c.opts.AdminURL, "/")+"/peers", nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.opts.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("admin returned %v", resp.Status)
+	}
+
+	var status []ycache.PeerStatus
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return fmt.Errorf("decoding peers: %v", err)
+	}
+
+	weights := make(map[string]int)
+	for _, s := range status {
+		if s.Healthy {
+			weights[s.Peer] = s.Weight
+		}
+	}
+
+	c.setPeers(weights)
+	return nil
+}
+
+// watch 定期从管理接口更新节点列表
+func (c *Client) watch() {
+	ticker := time.NewTicker(c.opts.RefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := c.refresh(); err != nil {
+				log.Println("[ycache client] Failed to refresh peers:", err)
+			}
+		case <-c.ctx.Done():
+			return
+		}
+	}
+}
+
+// subscribe 订阅节点的事件流，断开后重新连接
+func (c *Client) subscribe(ctx context.Context, s *stream) {
+	for {
+		err := c.readStream(ctx, s)
+		c.setConnected(s, false)
+
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("[ycache client] Event stream of %s disconnected: %v", s.peer, err)
+
+		select {
+		case <-time.After(reconnectBackoff):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// readStream 读取事件流直到连接断开
+func (c *Client) readStream(ctx context.Context, s *stream) error {
+	u := s.peer + c.opts.EventsPath + "?group=" + url.QueryEscape(c.group)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	if s.lastID != "" {
+		req.Header.Set("Last-Event-ID", s.lastID)
+	}
+
+	resp, err := c.opts.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("server returned %v", resp.Status)
+	}
+
+	c.setConnected(s, true)
+
+	var id string
+	var data []byte
+	r := bufio.NewReader(resp.Body)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return err
+		}
+
+		line = strings.TrimRight(line, "\r\n")
+		switch {
+		case strings.HasPrefix(line, "id: "):
+			id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "data: "):
+			data = []byte(strings.TrimPrefix(line, "data: "))
+		case line == "" && data != nil:
+			var e ycache.Event
+			if err := json.Unmarshal(data, &e); err != nil {
+				return fmt.Errorf("decoding event: %v", err)
+			}
+
+			c.apply(e)
+			s.lastID, id, data = id, "", nil
+		}
+	}
+}
+
+// setConnected 更新事件流的连接状态
+// 断开期间错过的事件在重新连接后才回放，连接时清空近端缓存，避免回放完成前返回过期的数据
+func (c *Client) setConnected(s *stream, connected bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if s.connected != connected {
+		s.connected = connected
+		c.changes++
+		if connected {
+			c.purge()
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package client
+
+import (
+	"7days/ycache"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// server 单节点的ycache服务，统计收到的读取请求数
+type server struct {
+	*httptest.Server
+	group *ycache.Group
+	gets  int32
+}
+
+func newServer(t *testing.T, name string, getter ycache.Getter) *server {
+	s := &server{group: ycache.NewGroup(name, 2<<10, getter)}
+
+	mux := http.NewServeMux()
+	s.Server = httptest.NewServer(mux)
+
+	pool := ycache.NewHTTPPool(s.URL)
+	pool.Set(s.URL)
+	s.group.RegisterPeers(pool)
+
+	mux.Handle("/_ycache/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&s.gets, 1)
+		pool.ServeHTTP(w, r)
+	}))
+	mux.Handle("/_events", ycache.NewEventHandler())
+	mux.Handle("/_admin/", http.StripPrefix("/_admin", ycache.NewAdmin(pool)))
+
+	t.Cleanup(s.Close)
+	return s
+}
+
+// waitConnected 等待客户端连接上所有节点的事件流
+func waitConnected(t *testing.T, c *Client) {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		c.mu.Lock()
+		connected := len(c.streams) > 0
+		for _, s := range c.streams {
+			connected = connected && s.connected
+		}
+		c.mu.Unlock()
+
+		if connected {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatal("event streams not connected")
+}
+
+// waitMiss 等待key从近端缓存中删除
+func waitMiss(t *testing.T, c *Client, key string) {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		c.mu.Lock()
+		_, ok := c.nearGet(key, c.pick(key))
+		c.mu.Unlock()
+
+		if !ok {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatalf("%s is still in the near cache", key)
+}
+
+func TestNearCache(t *testing.T) {
+	s := newServer(t, "client-near", ycache.GetterFunc(func(ctx context.Context, key string) ([]byte, error) {
+		return []byte("loaded-" + key), nil
+	}))
+
+	c, err := New("client-near", &Options{AdminURL: s.URL + "/_admin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	waitConnected(t, c)
+
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		if v, err := c.Get(ctx, "a"); err != nil || string(v) != "loaded-a" {
+			t.Fatalf("Get = %q, %v", v, err)
+		}
+	}
+
+	if s.gets != 1 {
+		t.Fatalf("server received %d gets, want 1", s.gets)
+	}
+
+	// 服务端更新数据后近端缓存失效
+	if err := s.group.Set(ctx, "a", []byte("updated")); err != nil {
+		t.Fatal(err)
+	}
+	waitMiss(t, c, "a")
+
+	if v, err := c.Get(ctx, "a"); err != nil || string(v) != "updated" {
+		t.Fatalf("Get after Set = %q, %v", v, err)
+	}
+}
+
+func TestNearCacheTags(t *testing.T) {
+	s := newServer(t, "client-tags", ycache.EntryGetterFunc(func(ctx context.Context, key string) (ycache.Entry, error) {
+		return ycache.Entry{Value: []byte(key), Tags: []string{strings.SplitN(key, ":", 2)[0]}}, nil
+	}))
+
+	c, err := New("client-tags", &Options{Peers: []string{s.URL}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	waitConnected(t, c)
+
+	ctx := context.Background()
+	values, err := c.GetMany(ctx, []string{"row1:a", "row1:b", "row2:a"})
+	if err != nil || len(values) != 3 || string(values["row1:b"]) != "row1:b" {
+		t.Fatalf("GetMany = %q, %v", values, err)
+	}
+
+	if _, err := s.group.InvalidateTag(ctx, "row1"); err != nil {
+		t.Fatal(err)
+	}
+	waitMiss(t, c, "row1:a")
+	waitMiss(t, c, "row1:b")
+
+	c.mu.Lock()
+	_, ok := c.nearGet("row2:a", c.pick("row2:a"))
+	c.mu.Unlock()
+	if !ok {
+		t.Fatal("row2:a should still be in the near cache")
+	}
+}
+
+func TestGetManyErrors(t *testing.T) {
+	s := newServer(t, "client-errors", ycache.GetterFunc(func(ctx context.Context, key string) ([]byte, error) {
+		if key == "missing" {
+			return nil, context.DeadlineExceeded
+		}
+		return []byte(key), nil
+	}))
+
+	c, err := New("client-errors", &Options{Peers: []string{s.URL}, NearCacheSize: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	values, err := c.GetMany(context.Background(), []string{"a", "missing"})
+	if err == nil || len(values) != 1 || string(values["a"]) != "a" {
+		t.Fatalf("GetMany = %q, %v", values, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := c.Get(ctx, "b"); err == nil {
+		t.Fatal("expected error from canceled context")
+	}
+}
+
+func TestNearCacheReconnect(t *testing.T) {
+	s := newServer(t, "client-reconnect", ycache.GetterFunc(func(ctx context.Context, key string) ([]byte, error) {
+		return []byte("loaded-" + key), nil
+	}))
+
+	c, err := New("client-reconnect", &Options{Peers: []string{s.URL}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	waitConnected(t, c)
+
+	if _, err := c.Get(context.Background(), "a"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 重新连接后错过的事件尚未回放，近端缓存中的数据不再可用
+	c.mu.Lock()
+	st := c.streams[s.URL]
+	c.mu.Unlock()
+	c.setConnected(st, false)
+	c.setConnected(st, true)
+
+	c.mu.Lock()
+	_, ok := c.nearGet("a", s.URL)
+	c.mu.Unlock()
+	if ok {
+		t.Fatal("near cache served a value before the missed events were replayed")
+	}
+}
@@ -2,6 +2,7 @@ package consistenthash
 
 import (
 	"hash/crc32"
+	"math"
 	"sort"
 	"strconv"
 )
@@ -15,6 +16,7 @@ type Map struct {
 	replicas int   // 虚拟节点数
 	keys     []int // Sorted
 	hashMap  map[int]string
+	nodes    map[string]int // 真实节点及其权重
 }
 
 // New create Map instance
@@ -23,6 +25,7 @@ func New(replicas int, fn Hash) *Map {
 		replicas: replicas,
 		hash:     fn,
 		hashMap:  make(map[int]string),
+		nodes:    make(map[string]int),
 	}
 
 	if m.hash == nil {
@@ -33,16 +36,82 @@ func New(replicas int, fn Hash) *Map {
 	return m
 }
 
-// Add 将Key添加至hashMap
+// Add 将Key添加至hashMap，每个节点的权重为1
 func (m *Map) Add(keys ...string) {
 	for _, key := range keys {
-		for i := 0; i < m.replicas; i++ {
-			// 创建对应的虚拟节点
-			hash := int(m.hash([]byte(strconv.FormatInt(int64(i), 10) + key)))
-			m.keys = append(m.keys, hash)
-			// 虚拟节点对应真正的节点
+		m.AddWeighted(key, 1)
+	}
+}
+
+// AddWeighted 添加一个带权重的节点，节点拥有 replicas×weight 个虚拟节点，
+// weight 小于1时按1处理。节点已经存在时更新它的权重。
+func (m *Map) AddWeighted(key string, weight int) {
+	if weight < 1 {
+		weight = 1
+	}
+
+	old, ok := m.nodes[key]
+	if ok && old == weight {
+		return
+	}
+
+	m.nodes[key] = weight
+	if weight < old {
+		// 权重降低需要去掉部分虚拟节点，直接重建
+		m.rebuild()
+		return
+	}
+
+	// 前 replicas×old 个虚拟节点已经在环上，只需要补上新增的部分
+	m.place(key, m.replicas*old, m.replicas*weight)
+	sort.Ints(m.keys)
+}
+
+// Remove 将节点及其虚拟节点从环上移除，其余节点的位置不变
+func (m *Map) Remove(keys ...string) {
+	removed := false
+	for _, key := range keys {
+		if _, ok := m.nodes[key]; ok {
+			delete(m.nodes, key)
+			removed = true
+		}
+	}
+
+	if removed {
+		// 被移除的节点可能在冲突中占据了其他节点的虚拟节点，
+		// 重建后这些位置会交还给原来的节点
+		m.rebuild()
+	}
+}
+
+// place 创建节点编号为 [from, to) 的虚拟节点
+func (m *Map) place(key string, from, to int) {
+	for i := from; i < to; i++ {
+		// 创建对应的虚拟节点
+		hash := int(m.hash([]byte(strconv.FormatInt(int64(i), 10) + key)))
+		if owner, ok := m.hashMap[hash]; ok {
+			// 虚拟节点hash冲突时固定由字典序较小的节点占据，
+			// 这样无论节点加入的顺序如何，每个peer得到的环都相同
+			if owner <= key {
+				continue
+			}
+
 			m.hashMap[hash] = key
+			continue
 		}
+
+		m.keys = append(m.keys, hash)
+		// 虚拟节点对应真正的节点
+		m.hashMap[hash] = key
+	}
+}
+
+// rebuild 根据 nodes 重新生成整个环
+func (m *Map) rebuild() {
+	m.keys = m.keys[:0]
+	m.hashMap = make(map[int]string, len(m.hashMap))
+	for key, weight := range m.nodes {
+		m.place(key, 0, m.replicas*weight)
 	}
 
 	sort.Ints(m.keys)
@@ -61,3 +130,77 @@ func (m *Map) Get(key string) string {
 
 	return m.hashMap[m.keys[idx%len(m.keys)]]
 }
+
+// GetN 沿哈希环顺时针返回最多n个不同的节点
+func (m *Map) GetN(key string, n int) []string {
+	if len(m.keys) == 0 || n <= 0 {
+		return nil
+	}
+
+	if n > len(m.nodes) {
+		n = len(m.nodes)
+	}
+
+	hash := int(m.hash([]byte(key)))
+	idx := sort.Search(len(m.keys), func(i int) bool {
+		return m.keys[i] >= hash
+	})
+
+	nodes := make([]string, 0, n)
+	for i := 0; i < len(m.keys) && len(nodes) < n; i++ {
+		node := m.hashMap[m.keys[(idx+i)%len(m.keys)]]
+		if !contains(nodes, node) {
+			nodes = append(nodes, node)
+		}
+	}
+
+	return nodes
+}
+
+func contains(nodes []string, node string) bool {
+	for _, n := range nodes {
+		if n == node {
+			return true
+		}
+	}
+
+	return false
+}
+
+// GetBounded 有界负载的一致性哈希 (Mirrokni et al.)
+// load 返回节点当前进行中的请求数，每个节点的容量为 ceil((1+epsilon)×平均负载)，
+// 负责key的节点达到容量时，沿哈希环顺时针选择下一个未满的节点。
+func (m *Map) GetBounded(key string, epsilon float64, load func(node string) int64) string {
+	if len(m.keys) == 0 {
+		return ""
+	}
+
+	var total int64
+	for node := range m.nodes {
+		total += load(node)
+	}
+
+	// 算上即将分配的这个请求
+	capacity := int64(math.Ceil((1 + epsilon) * float64(total+1) / float64(len(m.nodes))))
+
+	hash := int(m.hash([]byte(key)))
+	idx := sort.Search(len(m.keys), func(i int) bool {
+		return m.keys[i] >= hash
+	})
+
+	owner := m.hashMap[m.keys[idx%len(m.keys)]]
+	checked := make(map[string]bool, len(m.nodes))
+	for i := 0; i < len(m.keys) && len(checked) < len(m.nodes); i++ {
+		node := m.hashMap[m.keys[(idx+i)%len(m.keys)]]
+		if checked[node] {
+			continue
+		}
+
+		if load(node) < capacity {
+			return node
+		}
+		checked[node] = true
+	}
+
+	return owner
+}
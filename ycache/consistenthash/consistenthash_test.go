@@ -36,3 +36,147 @@ func TestHashing(t *testing.T) {
 		}
 	}
 }
+
+func TestBoundedLoads(t *testing.T) {
+	hash := New(1, func(data []byte) uint32 {
+		i, _ := strconv.Atoi(string(data))
+		return uint32(i)
+	})
+
+	// 虚拟节点 02、04、06
+	hash.Add("2", "4", "6")
+
+	loads := map[string]int64{}
+	load := func(node string) int64 { return loads[node] }
+
+	if node := hash.GetBounded("1", 0.25, load); node != "2" {
+		t.Fatalf("Asking for 1 without load, should have yielded 2, got %s", node)
+	}
+
+	// 总负载 3+1，每个节点容量为 ceil(1.25*4/3)=2
+	loads["2"] = 3
+	if node := hash.GetBounded("1", 0.25, load); node != "4" {
+		t.Fatalf("Asking for 1 with 2 overloaded, should have yielded 4, got %s", node)
+	}
+
+	// 总负载 8+1，容量为 ceil(1.25*9/3)=4
+	loads["2"] = 4
+	loads["4"] = 4
+	if node := hash.GetBounded("1", 0.25, load); node != "6" {
+		t.Fatalf("Asking for 1 with 2 and 4 overloaded, should have yielded 6, got %s", node)
+	}
+
+	// 负载降下来之后回到原来的节点
+	loads["2"] = 0
+	if node := hash.GetBounded("1", 0.25, load); node != "2" {
+		t.Fatalf("Asking for 1 after 2 recovered, should have yielded 2, got %s", node)
+	}
+}
+
+func TestRemove(t *testing.T) {
+	hash := New(3, func(data []byte) uint32 {
+		i, _ := strconv.Atoi(string(data))
+		return uint32(i)
+	})
+
+	hash.Add("2", "4", "6", "8")
+	hash.Remove("8")
+
+	// 与只添加了 2、4、6 时的结果一致
+	testCases := map[string]string{
+		"2":  "2",
+		"11": "2",
+		"23": "4",
+		"27": "2",
+	}
+
+	for k, v := range testCases {
+		if hash.Get(k) != v {
+			t.Errorf("Asking for %s, should have yielded %s", k, v)
+		}
+	}
+
+	hash.Remove("2", "4", "6")
+	if node := hash.Get("2"); node != "" {
+		t.Errorf("Asking for 2 on an empty ring, got %s", node)
+	}
+}
+
+func TestCollision(t *testing.T) {
+	// 所有虚拟节点都落在同一个位置
+	collide := func(data []byte) uint32 { return 1 }
+
+	a := New(3, collide)
+	a.Add("b", "a", "c")
+	b := New(3, collide)
+	b.Add("c", "a", "b")
+
+	if a.Get("key") != "a" || b.Get("key") != "a" {
+		t.Fatalf("collided virtual nodes should be owned by a, got %s and %s", a.Get("key"), b.Get("key"))
+	}
+
+	a.Remove("a")
+	if node := a.Get("key"); node != "b" {
+		t.Fatalf("after removing a, collided virtual nodes should be owned by b, got %s", node)
+	}
+}
+
+func TestWeights(t *testing.T) {
+	keys := testKeys(30000)
+
+	for _, s := range []struct {
+		name string
+		new  func() WeightedSelector
+	}{
+		{"ring", func() WeightedSelector { return New(50, nil) }},
+		{"rendezvous", func() WeightedSelector { return NewRendezvous(nil) }},
+	} {
+		sel := s.new()
+		sel.Add(peers...)
+		sel.AddWeighted(peers[0], 2)
+
+		counts := make(map[string]int)
+		for _, key := range keys {
+			counts[sel.Get(key)]++
+		}
+
+		// peers[0] 的权重为2，应当负责约一半的key
+		share := float64(counts[peers[0]]) / float64(len(keys))
+		if share < 0.4 || share > 0.6 {
+			t.Errorf("%s: peer with weight 2 owns %.2f%% of keys, want about 50%%", s.name, share*100)
+		}
+
+		// 权重恢复后与从未加权时的结果一致
+		sel.AddWeighted(peers[0], 1)
+		plain := s.new()
+		plain.Add(peers...)
+		for _, key := range keys {
+			if sel.Get(key) != plain.Get(key) {
+				t.Fatalf("%s: Asking for %s after resetting weight, should have yielded %s", s.name, key, plain.Get(key))
+			}
+		}
+	}
+}
+
+func TestGetN(t *testing.T) {
+	hash := New(3, func(data []byte) uint32 {
+		i, _ := strconv.Atoi(string(data))
+		return uint32(i)
+	})
+
+	hash.Add("2", "4", "6")
+
+	// 23 落在 24 上，之后依次是 26、02
+	if nodes := hash.GetN("23", 5); len(nodes) != 3 || nodes[0] != "4" || nodes[1] != "6" || nodes[2] != "2" {
+		t.Errorf("Asking for 3 nodes of 23, should have yielded [4 6 2], got %v", nodes)
+	}
+
+	for _, sel := range []MultiSelector{hash, NewRendezvous(nil)} {
+		sel.Add(peers...)
+		for _, key := range testKeys(100) {
+			if nodes := sel.GetN(key, 2); len(nodes) != 2 || nodes[0] != sel.Get(key) || nodes[0] == nodes[1] {
+				t.Fatalf("%T: GetN(%s, 2) = %v, want 2 distinct nodes starting with %s", sel, key, nodes, sel.Get(key))
+			}
+		}
+	}
+}
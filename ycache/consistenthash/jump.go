@@ -0,0 +1,67 @@
+package consistenthash
+
+import "sort"
+
+// Jump Jump Consistent Hash (Lamping & Veach)
+// 不需要额外的内存，分布非常均匀，但节点只能按编号访问:
+// 节点按字典序排列以保证每个peer得到相同的编号，
+// 因此只有新节点排在末尾时才能做到最少的key迁移。
+type Jump struct {
+	hash  Hash64
+	nodes []string // Sorted
+}
+
+// NewJump create Jump instance
+func NewJump(fn Hash64) *Jump {
+	j := &Jump{hash: fn}
+
+	if j.hash == nil {
+		j.hash = defaultHash64
+	}
+
+	return j
+}
+
+// Add 添加节点，重复的节点会被忽略
+func (j *Jump) Add(nodes ...string) {
+	for _, node := range nodes {
+		idx := sort.SearchStrings(j.nodes, node)
+		if idx < len(j.nodes) && j.nodes[idx] == node {
+			continue
+		}
+
+		j.nodes = append(j.nodes, "")
+		copy(j.nodes[idx+1:], j.nodes[idx:])
+		j.nodes[idx] = node
+	}
+}
+
+// Remove 移除节点，排在被移除节点之后的节点编号都会改变
+func (j *Jump) Remove(nodes ...string) {
+	for _, node := range nodes {
+		idx := sort.SearchStrings(j.nodes, node)
+		if idx < len(j.nodes) && j.nodes[idx] == node {
+			j.nodes = append(j.nodes[:idx], j.nodes[idx+1:]...)
+		}
+	}
+}
+
+func (j *Jump) Get(key string) string {
+	if len(j.nodes) == 0 {
+		return ""
+	}
+
+	return j.nodes[jumpHash(j.hash([]byte(key)), len(j.nodes))]
+}
+
+// jumpHash 返回key对应的桶编号 [0, buckets)
+func jumpHash(key uint64, buckets int) int {
+	var b, j int64 = -1, 0
+	for j < int64(buckets) {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+
+	return int(b)
+}
@@ -0,0 +1,137 @@
+package consistenthash
+
+import (
+	"math/big"
+	"sort"
+)
+
+// defaultMaglevSize 查找表默认大小，需要是质数且远大于节点数
+const defaultMaglevSize = 65537
+
+// Maglev Google Maglev 负载均衡使用的一致性哈希
+// 每个节点按自己的排列顺序轮流填充一张固定大小的查找表，
+// 查询时只需一次hash和一次数组访问，节点间的分布几乎完全均匀。
+type Maglev struct {
+	hash  Hash64
+	size  uint64   // 查找表大小(质数)
+	nodes []string // Sorted
+	table []int    // 查找表，值为nodes的下标
+}
+
+// NewMaglev create Maglev instance
+// size 为查找表大小，必须是质数，不是质数(包括0和负数)时使用默认值。
+// 节点数不小于查找表大小时，查找表扩大为比节点数大的质数。
+func NewMaglev(size int, fn Hash64) *Maglev {
+	m := &Maglev{
+		hash: fn,
+		size: defaultMaglevSize,
+	}
+
+	if m.hash == nil {
+		m.hash = defaultHash64
+	}
+
+	if size > 0 && isPrime(uint64(size)) {
+		m.size = uint64(size)
+	}
+
+	return m
+}
+
+// Add 添加节点并重建查找表，重复的节点会被忽略
+func (m *Maglev) Add(nodes ...string) {
+	for _, node := range nodes {
+		idx := sort.SearchStrings(m.nodes, node)
+		if idx < len(m.nodes) && m.nodes[idx] == node {
+			continue
+		}
+
+		m.nodes = append(m.nodes, "")
+		copy(m.nodes[idx+1:], m.nodes[idx:])
+		m.nodes[idx] = node
+	}
+
+	m.populate()
+}
+
+// Remove 移除节点并重建查找表
+func (m *Maglev) Remove(nodes ...string) {
+	for _, node := range nodes {
+		idx := sort.SearchStrings(m.nodes, node)
+		if idx < len(m.nodes) && m.nodes[idx] == node {
+			m.nodes = append(m.nodes[:idx], m.nodes[idx+1:]...)
+		}
+	}
+
+	m.populate()
+}
+
+func (m *Maglev) Get(key string) string {
+	if len(m.table) == 0 {
+		return ""
+	}
+
+	return m.nodes[m.table[m.hash([]byte(key))%m.size]]
+}
+
+// populate 按论文中的算法填充查找表
+func (m *Maglev) populate() {
+	if len(m.nodes) == 0 {
+		m.table = nil
+		return
+	}
+
+	// 每个节点至少需要一个位置
+	if n := uint64(len(m.nodes)); n >= m.size {
+		m.size = nextPrime(n + 1)
+	}
+
+	offsets := make([]uint64, len(m.nodes))
+	skips := make([]uint64, len(m.nodes))
+	for i, node := range m.nodes {
+		h := m.hash([]byte(node))
+		offsets[i] = h % m.size
+		skips[i] = mix64(h)%(m.size-1) + 1
+	}
+
+	table := make([]int, m.size)
+	for i := range table {
+		table[i] = -1
+	}
+
+	next := make([]uint64, len(m.nodes))
+	var filled uint64
+	for {
+		for i := range m.nodes {
+			// 找到该节点排列中下一个空位
+			c := (offsets[i] + next[i]*skips[i]) % m.size
+			for table[c] >= 0 {
+				next[i]++
+				c = (offsets[i] + next[i]*skips[i]) % m.size
+			}
+
+			table[c] = i
+			next[i]++
+			filled++
+
+			if filled == m.size {
+				m.table = table
+				return
+			}
+		}
+	}
+}
+
+// isPrime 判断n是否为质数，对 uint64 范围内的数结果是准确的
+func isPrime(n uint64) bool {
+	return new(big.Int).SetUint64(n).ProbablyPrime(0)
+}
+
+// nextPrime 返回不小于n的最小质数
+func nextPrime(n uint64) uint64 {
+	for !isPrime(n) {
+		n++
+	}
+
+	return n
+}
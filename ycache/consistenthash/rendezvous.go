@@ -0,0 +1,124 @@
+package consistenthash
+
+import (
+	"math"
+	"sort"
+)
+
+// Rendezvous 最高随机权重哈希(Highest Random Weight)
+// 对每个节点计算 hash(node, key)，分值最高的节点负责该key。
+// 增删节点时只有属于该节点的key会移动，不需要虚拟节点。
+type Rendezvous struct {
+	hash    Hash64
+	nodes   []string
+	weights map[string]int
+}
+
+// NewRendezvous create Rendezvous instance
+func NewRendezvous(fn Hash64) *Rendezvous {
+	r := &Rendezvous{
+		hash:    fn,
+		weights: make(map[string]int),
+	}
+
+	if r.hash == nil {
+		r.hash = defaultHash64
+	}
+
+	return r
+}
+
+// Add 添加节点，每个节点的权重为1，重复的节点会被忽略
+func (r *Rendezvous) Add(nodes ...string) {
+	for _, node := range nodes {
+		if _, ok := r.weights[node]; !ok {
+			r.AddWeighted(node, 1)
+		}
+	}
+}
+
+// AddWeighted 添加带权重的节点，weight 小于1时按1处理
+// 使用 -weight/ln(h) 作为分值 (Schindelhauer & Schomaker)，
+// 节点负责的key的比例与权重成正比。
+func (r *Rendezvous) AddWeighted(node string, weight int) {
+	if weight < 1 {
+		weight = 1
+	}
+
+	if _, ok := r.weights[node]; !ok {
+		r.nodes = append(r.nodes, node)
+	}
+
+	r.weights[node] = weight
+}
+
+// Remove 移除节点
+func (r *Rendezvous) Remove(nodes ...string) {
+	for _, node := range nodes {
+		if _, ok := r.weights[node]; !ok {
+			continue
+		}
+
+		delete(r.weights, node)
+		for i, n := range r.nodes {
+			if n == node {
+				r.nodes = append(r.nodes[:i], r.nodes[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+func (r *Rendezvous) Get(key string) string {
+	var (
+		owner string
+		max   float64
+	)
+
+	for _, node := range r.nodes {
+		score := r.score(node, key)
+		// 分值相同时取字典序较小的节点，保证结果确定
+		if owner == "" || score > max || (score == max && node < owner) {
+			owner, max = node, score
+		}
+	}
+
+	return owner
+}
+
+// GetN 按分值从高到低返回最多n个节点
+func (r *Rendezvous) GetN(key string, n int) []string {
+	if n <= 0 {
+		return nil
+	}
+
+	scores := make(map[string]float64, len(r.nodes))
+	nodes := make([]string, len(r.nodes))
+	for i, node := range r.nodes {
+		scores[node] = r.score(node, key)
+		nodes[i] = node
+	}
+
+	sort.Slice(nodes, func(i, j int) bool {
+		si, sj := scores[nodes[i]], scores[nodes[j]]
+		return si > sj || (si == sj && nodes[i] < nodes[j])
+	})
+
+	if n < len(nodes) {
+		nodes = nodes[:n]
+	}
+
+	return nodes
+}
+
+// score 计算节点对key的权重
+func (r *Rendezvous) score(node, key string) float64 {
+	buf := make([]byte, 0, len(node)+len(key)+1)
+	buf = append(buf, node...)
+	buf = append(buf, 0)
+	buf = append(buf, key...)
+
+	// 将hash值映射到 (0, 1) 区间
+	h := (float64(r.hash(buf)>>11) + 0.5) / (1 << 53)
+	return -float64(r.weights[node]) / math.Log(h)
+}
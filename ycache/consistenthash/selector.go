@@ -0,0 +1,70 @@
+package consistenthash
+
+import "hash/fnv"
+
+// Selector 根据key从一组节点中选出负责该key的节点
+// Map(哈希环)、Rendezvous(HRW)、Jump、Maglev 均实现了该接口
+type Selector interface {
+	// Add 添加节点
+	Add(nodes ...string)
+	// Remove 移除节点
+	Remove(nodes ...string)
+	// Get 返回key对应的节点，没有节点时返回空字符串
+	Get(key string) string
+}
+
+// BoundedSelector 支持有界负载的节点选择器
+type BoundedSelector interface {
+	Selector
+	// GetBounded 在 Get 的基础上考虑节点负载，见 Map.GetBounded
+	GetBounded(key string, epsilon float64, load func(node string) int64) string
+}
+
+// WeightedSelector 支持节点权重的节点选择器，权重越大的节点负责越多的key
+type WeightedSelector interface {
+	Selector
+	// AddWeighted 添加带权重的节点，节点已存在时更新其权重
+	AddWeighted(node string, weight int)
+}
+
+// MultiSelector 可以按优先级返回多个节点的节点选择器，
+// 第一个节点与 Get 的结果相同，其余节点在第一个节点不可用时作为副本使用
+type MultiSelector interface {
+	Selector
+	// GetN 返回最多n个不同的节点
+	GetN(key string, n int) []string
+}
+
+var (
+	_ BoundedSelector  = (*Map)(nil)
+	_ MultiSelector    = (*Map)(nil)
+	_ MultiSelector    = (*Rendezvous)(nil)
+	_ WeightedSelector = (*Map)(nil)
+	_ WeightedSelector = (*Rendezvous)(nil)
+
+	_ Selector = (*Map)(nil)
+	_ Selector = (*Rendezvous)(nil)
+	_ Selector = (*Jump)(nil)
+	_ Selector = (*Maglev)(nil)
+)
+
+// Hash64 用bytes key 获取 uint64的hash值
+type Hash64 func(data []byte) uint64
+
+// defaultHash64 默认的64位hash算法: FNV-1a 再做一次 splitmix64 混淆，
+// 避免相近的输入得到相近的hash值
+func defaultHash64(data []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(data)
+	return mix64(h.Sum64())
+}
+
+// mix64 splitmix64 的终结函数
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
@@ -0,0 +1,128 @@
+package consistenthash
+
+import (
+	"fmt"
+	"testing"
+)
+
+var peers = []string{
+	"http://localhost:8001",
+	"http://localhost:8002",
+	"http://localhost:8003",
+}
+
+const newPeer = "http://localhost:8004"
+
+var selectors = []struct {
+	name     string
+	new      func() Selector
+	maxSkew  float64 // 份额与平均值的最大偏差比例
+	strictly bool    // 新增节点时，移动的key是否只能移动到新节点
+}{
+	{"ring", func() Selector { return New(50, nil) }, 0.30, true},
+	{"rendezvous", func() Selector { return NewRendezvous(nil) }, 0.05, true},
+	{"jump", func() Selector { return NewJump(nil) }, 0.05, true},
+	{"maglev", func() Selector { return NewMaglev(0, nil) }, 0.05, false},
+}
+
+func testKeys(n int) []string {
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key-%d", i)
+	}
+	return keys
+}
+
+func TestSelectorDistribution(t *testing.T) {
+	keys := testKeys(30000)
+
+	for _, s := range selectors {
+		sel := s.new()
+		sel.Add(peers...)
+
+		counts := make(map[string]int)
+		for _, key := range keys {
+			counts[sel.Get(key)]++
+		}
+
+		avg := float64(len(keys)) / float64(len(peers))
+		for _, peer := range peers {
+			skew := (float64(counts[peer]) - avg) / avg
+			t.Logf("%s: %s owns %.2f%% of keys", s.name, peer, float64(counts[peer])*100/float64(len(keys)))
+			if skew > s.maxSkew || skew < -s.maxSkew {
+				t.Errorf("%s: %s owns %d keys, want %.0f±%.0f%%", s.name, peer, counts[peer], avg, s.maxSkew*100)
+			}
+		}
+	}
+}
+
+func TestSelectorMovement(t *testing.T) {
+	keys := testKeys(30000)
+
+	for _, s := range selectors {
+		before := s.new()
+		before.Add(peers...)
+		after := s.new()
+		after.Add(append(peers, newPeer)...)
+
+		moved, stray := 0, 0
+		for _, key := range keys {
+			from, to := before.Get(key), after.Get(key)
+			if from == to {
+				continue
+			}
+
+			moved++
+			if to != newPeer {
+				stray++
+			}
+		}
+
+		fraction := float64(moved) / float64(len(keys))
+		t.Logf("%s: %.2f%% of keys moved, %d between old peers", s.name, fraction*100, stray)
+
+		// 理想情况下只有 1/4 的key移动
+		if fraction > 0.32 {
+			t.Errorf("%s: %.2f%% of keys moved after adding a peer, want about 25%%", s.name, fraction*100)
+		}
+
+		if s.strictly && stray > 0 {
+			t.Errorf("%s: %d keys moved between old peers", s.name, stray)
+		}
+	}
+}
+
+func TestSelectorEmpty(t *testing.T) {
+	for _, s := range selectors {
+		if node := s.new().Get("key"); node != "" {
+			t.Errorf("%s: empty selector returned %q", s.name, node)
+		}
+	}
+}
+
+func TestMaglevSize(t *testing.T) {
+	nodes := []string{"a", "b", "c", "d", "e"}
+	keys := testKeys(1000)
+
+	// 不是质数的大小使用默认值，节点数超过大小时扩大查找表
+	for _, size := range []int{-7, 0, 1, 4, 5, 3, 100} {
+		m := NewMaglev(size, nil)
+		m.Add(nodes...)
+
+		if m.size <= uint64(len(nodes)) || !isPrime(m.size) {
+			t.Errorf("NewMaglev(%d): table size = %d, want a prime above %d", size, m.size, len(nodes))
+		}
+
+		counts := make(map[string]int)
+		for _, key := range keys {
+			counts[m.Get(key)]++
+		}
+		if len(counts) != len(nodes) || counts[""] != 0 {
+			t.Errorf("NewMaglev(%d): keys are spread over %v, want all %d nodes", size, counts, len(nodes))
+		}
+	}
+
+	if m := NewMaglev(7, nil); m.size != 7 {
+		t.Errorf("NewMaglev(7): table size = %d, want 7", m.size)
+	}
+}
@@ -0,0 +1,60 @@
+// Package discovery 提供节点发现功能，发现的节点列表通过 PeerSetter 更新到HTTP池
+package discovery
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// PeerSetter 接收完整的节点列表，*ycache.HTTPPool 实现了该接口
+type PeerSetter interface {
+	Set(peers ...string)
+}
+
+// normalize 校验节点地址并去重排序
+// 节点地址必须是 http(s)://host[:port] 的形式，不能带路径
+func normalize(peers []string) ([]string, error) {
+	seen := make(map[string]bool, len(peers))
+	out := make([]string, 0, len(peers))
+
+	for _, peer := range peers {
+		peer = strings.TrimSuffix(strings.TrimSpace(peer), "/")
+
+		u, err := url.Parse(peer)
+		if err != nil {
+			return nil, fmt.Errorf("invalid peer %q: %v", peer, err)
+		}
+
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return nil, fmt.Errorf("invalid peer %q: scheme must be http or https", peer)
+		}
+
+		if u.Host == "" || u.Path != "" || u.RawQuery != "" || u.Fragment != "" {
+			return nil, fmt.Errorf("invalid peer %q: want scheme://host[:port]", peer)
+		}
+
+		if !seen[peer] {
+			seen[peer] = true
+			out = append(out, peer)
+		}
+	}
+
+	sort.Strings(out)
+	return out, nil
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,226 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DNS 发现的默认配置
+const (
+	defaultResolveInterval = 10 * time.Second
+	defaultResolveTimeout  = 5 * time.Second
+	defaultStableRounds    = 2
+)
+
+// Resolver DNS查询接口，*net.Resolver 实现了该接口
+type Resolver interface {
+	LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+// DNSConfig DNS节点发现的配置
+type DNSConfig struct {
+	// Name 查询的域名，如 Kubernetes headless service 的 "ycache.default.svc.cluster.local"
+	// 使用SRV记录时为完整的记录名，如 "_http._tcp.ycache.default.svc.cluster.local"
+	Name string
+
+	// SRV 是否查询SRV记录，节点端口取自SRV记录；否则查询 A/AAAA 记录并使用 Port
+	SRV bool
+
+	// Port 使用 A/AAAA 记录时节点的端口
+	Port int
+
+	// Scheme 节点地址的协议。
+	// If blank, it defaults to "http".
+	Scheme string
+
+	// Interval 查询的间隔。
+	// If blank, it defaults to 10s.
+	Interval time.Duration
+
+	// Timeout 单次查询的超时时间。
+	// If blank, it defaults to 5s.
+	Timeout time.Duration
+
+	// StableRounds 查询结果连续相同多少次才更新节点列表，用来过滤抖动。
+	// If blank, it defaults to 2.
+	StableRounds int
+
+	// Resolver DNS查询使用的解析器。
+	// If blank, it defaults to net.DefaultResolver.
+	Resolver Resolver
+}
+
+// DNS 定期查询DNS记录，将结果作为节点列表
+// 查询失败或没有记录时保留上一次的节点列表。
+type DNS struct {
+	cfg    DNSConfig
+	setter PeerSetter
+
+	mu        sync.Mutex
+	peers     []string // 已经生效的节点列表
+	candidate []string // 等待确认的节点列表
+	seen      int      // candidate 连续出现的次数
+
+	once sync.Once
+	done chan struct{}
+}
+
+// NewDNS 查询一次DNS并开始定期查询，第一次查询失败时返回错误
+func NewDNS(cfg DNSConfig, setter PeerSetter) (*DNS, error) {
+	if cfg.Name == "" {
+		return nil, errors.New("discovery: DNS name is required")
+	}
+
+	if !cfg.SRV && (cfg.Port <= 0 || cfg.Port > 65535) {
+		return nil, fmt.Errorf("discovery: invalid port %d for A/AAAA records", cfg.Port)
+	}
+
+	if cfg.Scheme == "" {
+		cfg.Scheme = "http"
+	}
+
+	if cfg.Interval <= 0 {
+		cfg.Interval = defaultResolveInterval
+	}
+
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultResolveTimeout
+	}
+
+	if cfg.StableRounds <= 0 {
+		cfg.StableRounds = defaultStableRounds
+	}
+
+	if cfg.Resolver == nil {
+		cfg.Resolver = net.DefaultResolver
+	}
+
+	d := &DNS{
+		cfg:    cfg,
+		setter: setter,
+		done:   make(chan struct{}),
+	}
+
+	peers, err := d.resolve()
+	if err != nil {
+		return nil, err
+	}
+
+	// 第一次查询的结果直接生效
+	d.peers = peers
+	d.setter.Set(peers...)
+
+	go d.watch()
+
+	return d, nil
+}
+
+// Peers 返回当前的节点列表
+func (d *DNS) Peers() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string(nil), d.peers...)
+}
+
+// Close 停止查询
+func (d *DNS) Close() {
+	d.once.Do(func() {
+		close(d.done)
+	})
+}
+
+func (d *DNS) watch() {
+	ticker := time.NewTicker(d.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-d.done:
+			return
+		case <-ticker.C:
+		}
+
+		peers, err := d.resolve()
+		if err != nil {
+			log.Printf("[discovery] keep last peers, resolving %s: %v", d.cfg.Name, err)
+			continue
+		}
+
+		if d.observe(peers) {
+			log.Printf("[discovery] peers changed: %v", peers)
+		}
+	}
+}
+
+// observe 记录一次查询结果，结果连续出现 StableRounds 次后生效，生效时返回true
+func (d *DNS) observe(peers []string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if equal(peers, d.peers) {
+		d.candidate, d.seen = nil, 0
+		return false
+	}
+
+	if equal(peers, d.candidate) {
+		d.seen++
+	} else {
+		d.candidate, d.seen = peers, 1
+	}
+
+	if d.seen < d.cfg.StableRounds {
+		return false
+	}
+
+	d.peers = peers
+	d.candidate, d.seen = nil, 0
+	d.setter.Set(peers...)
+
+	return true
+}
+
+// resolve 查询DNS，返回校验、去重并排序后的节点地址
+func (d *DNS) resolve() ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), d.cfg.Timeout)
+	defer cancel()
+
+	var peers []string
+	if d.cfg.SRV {
+		_, records, err := d.cfg.Resolver.LookupSRV(ctx, "", "", d.cfg.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, srv := range records {
+			host := strings.TrimSuffix(srv.Target, ".")
+			peers = append(peers, d.url(host, int(srv.Port)))
+		}
+	} else {
+		addrs, err := d.cfg.Resolver.LookupIPAddr(ctx, d.cfg.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, addr := range addrs {
+			peers = append(peers, d.url(addr.String(), d.cfg.Port))
+		}
+	}
+
+	if len(peers) == 0 {
+		return nil, fmt.Errorf("no records for %s", d.cfg.Name)
+	}
+
+	return normalize(peers)
+}
+
+func (d *DNS) url(host string, port int) string {
+	return d.cfg.Scheme + "://" + net.JoinHostPort(host, strconv.Itoa(port))
+}
@@ -0,0 +1,150 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeResolver 进程内的DNS替身，记录可以随时修改
+type fakeResolver struct {
+	mu      sync.Mutex
+	srv     []*net.SRV
+	ips     []net.IPAddr
+	err     error
+	lookups int
+}
+
+func (f *fakeResolver) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.lookups++
+	return name, f.srv, f.err
+}
+
+func (f *fakeResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.lookups++
+	return f.ips, f.err
+}
+
+func (f *fakeResolver) set(ips []net.IPAddr, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.ips, f.err = ips, err
+}
+
+// rounds 等待解析器再被查询n次
+func (f *fakeResolver) rounds(t *testing.T, n int) {
+	f.mu.Lock()
+	want := f.lookups + n
+	f.mu.Unlock()
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		f.mu.Lock()
+		done := f.lookups >= want
+		f.mu.Unlock()
+		if done {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("resolver was not queried %d more times", n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func ips(addrs ...string) []net.IPAddr {
+	var out []net.IPAddr
+	for _, a := range addrs {
+		out = append(out, net.IPAddr{IP: net.ParseIP(a)})
+	}
+	return out
+}
+
+func TestDNSSRV(t *testing.T) {
+	resolver := &fakeResolver{srv: []*net.SRV{
+		{Target: "ycache-1.ycache.default.svc.", Port: 8001},
+		{Target: "ycache-0.ycache.default.svc.", Port: 8001},
+	}}
+
+	setter := &fakeSetter{}
+	d, err := NewDNS(DNSConfig{
+		Name:     "_http._tcp.ycache.default.svc",
+		SRV:      true,
+		Resolver: resolver,
+	}, setter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	want := []string{"http://ycache-0.ycache.default.svc:8001", "http://ycache-1.ycache.default.svc:8001"}
+	if peers, _ := setter.get(); !reflect.DeepEqual(peers, want) {
+		t.Fatalf("peers = %v, want %v", peers, want)
+	}
+}
+
+func TestDNSDebounce(t *testing.T) {
+	resolver := &fakeResolver{ips: ips("10.0.0.1", "10.0.0.2")}
+	setter := &fakeSetter{}
+	d, err := NewDNS(DNSConfig{
+		Name:         "ycache.default.svc",
+		Port:         8001,
+		Interval:     2 * time.Millisecond,
+		StableRounds: 3,
+		Resolver:     resolver,
+	}, setter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	initial := []string{"http://10.0.0.1:8001", "http://10.0.0.2:8001"}
+	if peers, _ := setter.get(); !reflect.DeepEqual(peers, initial) {
+		t.Fatalf("peers = %v, want %v", peers, initial)
+	}
+
+	// 查询失败时保留上一次的节点列表
+	resolver.set(nil, errors.New("no such host"))
+	resolver.rounds(t, 3)
+	resolver.set(nil, nil)
+	resolver.rounds(t, 3)
+	if peers, calls := setter.get(); !reflect.DeepEqual(peers, initial) || calls != 1 {
+		t.Fatalf("peers = %v after %d updates, want %v after 1", peers, calls, initial)
+	}
+
+	// 只出现一次的结果被当作抖动忽略
+	resolver.set(ips("10.0.0.1"), nil)
+	resolver.rounds(t, 1)
+	resolver.set(ips("10.0.0.1", "10.0.0.2"), nil)
+	resolver.rounds(t, 3)
+	if peers, calls := setter.get(); !reflect.DeepEqual(peers, initial) || calls != 1 {
+		t.Fatalf("peers = %v after %d updates, want %v after 1", peers, calls, initial)
+	}
+
+	// 稳定的结果生效
+	resolver.set(ips("10.0.0.3", "10.0.0.1", "10.0.0.2"), nil)
+	resolver.rounds(t, 4)
+	want := []string{"http://10.0.0.1:8001", "http://10.0.0.2:8001", "http://10.0.0.3:8001"}
+	if peers, calls := setter.get(); !reflect.DeepEqual(peers, want) || calls != 2 {
+		t.Fatalf("peers = %v after %d updates, want %v after 2", peers, calls, want)
+	}
+}
+
+func TestDNSInitialFailure(t *testing.T) {
+	resolver := &fakeResolver{err: errors.New("no such host")}
+	if _, err := NewDNS(DNSConfig{Name: "ycache", Port: 8001, Resolver: resolver}, &fakeSetter{}); err == nil {
+		t.Fatal("expected error when the first lookup fails")
+	}
+
+	if _, err := NewDNS(DNSConfig{Name: "ycache", Resolver: resolver}, &fakeSetter{}); err == nil {
+		t.Fatal("expected error without a port for A records")
+	}
+}
@@ -0,0 +1,165 @@
+package discovery
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultPollInterval = 5 * time.Second
+
+// File 从文件中读取节点列表，轮询文件的修改时间，文件变化时更新节点列表
+//
+// 支持两种格式:
+//   - JSON: ["http://10.0.0.1:8001", ...] 或 {"peers": ["http://10.0.0.1:8001", ...]}
+//   - 文本: 每行一个节点地址，忽略空行和 # 开头的注释
+//
+// 文件内容不合法时保留上一次的节点列表。
+type File struct {
+	path     string
+	interval time.Duration
+	setter   PeerSetter
+
+	mu      sync.Mutex
+	modTime time.Time
+	size    int64
+	peers   []string
+
+	once sync.Once
+	done chan struct{}
+}
+
+// NewFile 读取文件并开始监听，第一次读取失败时返回错误
+// interval 为轮询间隔，为0时使用默认值5s
+func NewFile(path string, interval time.Duration, setter PeerSetter) (*File, error) {
+	if interval <= 0 {
+		interval = defaultPollInterval
+	}
+
+	f := &File{
+		path:     path,
+		interval: interval,
+		setter:   setter,
+		done:     make(chan struct{}),
+	}
+
+	if _, err := f.reload(); err != nil {
+		return nil, err
+	}
+
+	go f.watch()
+
+	return f, nil
+}
+
+// Peers 返回当前的节点列表
+func (f *File) Peers() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.peers...)
+}
+
+// Close 停止监听
+func (f *File) Close() {
+	f.once.Do(func() {
+		close(f.done)
+	})
+}
+
+func (f *File) watch() {
+	ticker := time.NewTicker(f.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-f.done:
+			return
+		case <-ticker.C:
+		}
+
+		if changed, err := f.reload(); err != nil {
+			log.Printf("[discovery] keep last peers, reloading %s: %v", f.path, err)
+		} else if changed {
+			log.Printf("[discovery] peers changed: %v", f.Peers())
+		}
+	}
+}
+
+// reload 文件有变化时重新读取，节点列表变化时返回true
+func (f *File) reload() (bool, error) {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return false, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.peers != nil && info.ModTime().Equal(f.modTime) && info.Size() == f.size {
+		return false, nil
+	}
+
+	data, err := ioutil.ReadFile(f.path)
+	if err != nil {
+		return false, err
+	}
+
+	// 读取失败时也记录修改时间，文件再次变化之前不会重复报错
+	f.modTime, f.size = info.ModTime(), info.Size()
+
+	peers, err := ParsePeers(data)
+	if err != nil {
+		return false, err
+	}
+
+	if f.peers != nil && equal(peers, f.peers) {
+		return false, nil
+	}
+
+	f.peers = peers
+	f.setter.Set(peers...)
+
+	return true, nil
+}
+
+// ParsePeers 解析节点列表文件的内容，返回校验、去重并排序后的节点地址
+func ParsePeers(data []byte) ([]string, error) {
+	var peers []string
+
+	trimmed := bytes.TrimSpace(data)
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("[")):
+		if err := json.Unmarshal(trimmed, &peers); err != nil {
+			return nil, fmt.Errorf("decoding peers: %v", err)
+		}
+	case bytes.HasPrefix(trimmed, []byte("{")):
+		var doc struct {
+			Peers []string `json:"peers"`
+		}
+		if err := json.Unmarshal(trimmed, &doc); err != nil {
+			return nil, fmt.Errorf("decoding peers: %v", err)
+		}
+		peers = doc.Peers
+	default:
+		for _, line := range strings.Split(string(trimmed), "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			peers = append(peers, line)
+		}
+	}
+
+	if len(peers) == 0 {
+		return nil, errors.New("no peers")
+	}
+
+	return normalize(peers)
+}
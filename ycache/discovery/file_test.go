@@ -0,0 +1,127 @@
+package discovery
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSetter 记录最近一次设置的节点列表
+type fakeSetter struct {
+	mu    sync.Mutex
+	peers []string
+	calls int
+}
+
+func (f *fakeSetter) Set(peers ...string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.peers = peers
+	f.calls++
+}
+
+func (f *fakeSetter) get() ([]string, int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.peers, f.calls
+}
+
+func TestParsePeers(t *testing.T) {
+	want := []string{"http://localhost:8001", "http://localhost:8002"}
+
+	testCases := map[string]string{
+		"json array":  `["http://localhost:8002", "http://localhost:8001/"]`,
+		"json object": `{"peers": ["http://localhost:8001", "http://localhost:8002", "http://localhost:8001"]}`,
+		"text":        "# peers\nhttp://localhost:8002\n\n  http://localhost:8001  \n",
+	}
+
+	for name, data := range testCases {
+		peers, err := ParsePeers([]byte(data))
+		if err != nil || !reflect.DeepEqual(peers, want) {
+			t.Errorf("%s: got %v, %v; want %v", name, peers, err, want)
+		}
+	}
+
+	for _, data := range []string{
+		"",
+		"# nothing",
+		"localhost:8001",
+		"ftp://localhost:8001",
+		"http://localhost:8001/_ycache",
+		`["http://localhost:8001"`,
+	} {
+		if peers, err := ParsePeers([]byte(data)); err == nil {
+			t.Errorf("ParsePeers(%q) = %v, want error", data, peers)
+		}
+	}
+}
+
+func writeFile(t *testing.T, path, data string, mtime time.Time) {
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// 直接设置修改时间，不依赖文件系统的时间精度
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFileWatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "peers.txt")
+	now := time.Now()
+	writeFile(t, path, "http://localhost:8001\n", now)
+
+	setter := &fakeSetter{}
+	f, err := NewFile(path, 5*time.Millisecond, setter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if peers, _ := setter.get(); !reflect.DeepEqual(peers, []string{"http://localhost:8001"}) {
+		t.Fatalf("initial peers = %v", peers)
+	}
+
+	waitPeers := func(want []string, calls int) {
+		deadline := time.Now().Add(time.Second)
+		for {
+			peers, n := setter.get()
+			if reflect.DeepEqual(peers, want) && n == calls {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("peers = %v after %d updates, want %v after %d", peers, n, want, calls)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	writeFile(t, path, "http://localhost:8001\nhttp://localhost:8002\n", now.Add(time.Second))
+	waitPeers([]string{"http://localhost:8001", "http://localhost:8002"}, 2)
+
+	// 内容不合法时保留上一次的节点列表
+	writeFile(t, path, "localhost:8003\n", now.Add(2*time.Second))
+	time.Sleep(30 * time.Millisecond)
+	waitPeers([]string{"http://localhost:8001", "http://localhost:8002"}, 2)
+
+	writeFile(t, path, `{"peers": ["http://localhost:8003"]}`, now.Add(3*time.Second))
+	waitPeers([]string{"http://localhost:8003"}, 3)
+}
+
+func TestFileInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "peers.txt")
+	writeFile(t, path, "not a peer\n", time.Now())
+
+	if _, err := NewFile(path, time.Second, &fakeSetter{}); err == nil {
+		t.Fatal("expected error for invalid peers file")
+	}
+
+	if _, err := NewFile(path+".missing", time.Second, &fakeSetter{}); err == nil {
+		t.Fatal("expected error for missing peers file")
+	}
+}
@@ -0,0 +1,476 @@
+// Package disk 实现本地磁盘上的追加写存储，作为内存缓存之下的第二层缓存
+//
+// 数据按顺序追加写入段文件，内存中的索引记录每个key最新记录的位置：
+//   - 当前段写满后创建新的段
+//   - 所有段的总大小超过 MaxBytes 时删除最旧的段
+//   - 有效数据比例低于 CompactRatio 的段会被压缩，仍然有效的记录被重新写入当前段
+//
+// 索引只保存在内存中，打开 Store 时会清空目录中旧的段文件，
+// 需要在重启后保留缓存内容时使用 ycache 的快照。
+// Store 在目录中写入标记文件，只清空带有标记文件的目录，拒绝使用其他非空目录。
+package disk
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// 默认配置
+const (
+	defaultMaxBytes     = 1 << 30
+	defaultSegmentBytes = 64 << 20
+	defaultCompactRatio = 0.5
+	segmentExt          = ".seg"
+	markerFile          = ".ycache-disk" // 标记目录由 Store 创建
+)
+
+// 每条记录的格式，整数均为大端序：
+//
+//	crc32   uint32，之后所有字节的 CRC-32 (IEEE)
+//	keyLen  uint32
+//	valLen  uint32
+//	expire  int64，纳秒时间戳，0表示永不过期
+//	key     keyLen字节
+//	value   valLen字节
+const headerSize = 20
+
+// ErrCorrupt 记录的校验和不一致
+var ErrCorrupt = errors.New("disk: corrupt record")
+
+// ErrClosed Store 已经关闭
+var ErrClosed = errors.New("disk: store is closed")
+
+// ErrNotStore 目录不为空且不是由 Store 创建的
+var ErrNotStore = errors.New("disk: directory is not empty and was not created by a store")
+
+// ErrTooLarge 记录超过了段文件的大小上限
+var ErrTooLarge = errors.New("disk: record is larger than a segment")
+
+// Options are the configurations of a Store.
+type Options struct {
+	// MaxBytes 所有段文件的总字节数上限，超过后删除最旧的段。
+	// If blank, it defaults to 1GB.
+	MaxBytes int64
+
+	// SegmentBytes 单个段文件的大小上限。
+	// If blank, it defaults to 64MB, or MaxBytes/4 when that is smaller.
+	SegmentBytes int64
+
+	// CompactRatio 段中有效数据的比例低于该值时压缩该段。
+	// If blank, it defaults to 0.5.
+	CompactRatio float64
+}
+
+// Stats 存储的统计信息
+type Stats struct {
+	Keys        int   `json:"keys"`
+	Bytes       int64 `json:"bytes"`
+	LiveBytes   int64 `json:"live_bytes"`
+	Segments    int   `json:"segments"`
+	Compactions int64 `json:"compactions"`
+	Drops       int64 `json:"drops"` // 因为超过字节上限而删除的段数
+}
+
+// Store 追加写的磁盘存储，可以被多个goroutine同时使用
+type Store struct {
+	dir  string
+	opts Options
+
+	mu          sync.Mutex
+	index       map[string]location
+	segments    map[uint64]*segment
+	ids         []uint64 // 从旧到新排列的段编号
+	active      *segment
+	size        int64 // 所有段文件的总字节数
+	compactions int64
+	drops       int64
+	closed      bool
+}
+
+type segment struct {
+	id   uint64
+	f    *os.File
+	size int64 // 文件大小
+	live int64 // 仍在索引中的记录的字节数
+}
+
+type location struct {
+	seg    uint64
+	offset int64
+	size   int64 // 整条记录的字节数
+}
+
+// Open 在dir中创建 Store，目录中旧的段文件会被删除。
+// dir 不存在或为空时创建标记文件；dir 不为空且没有标记文件时返回 ErrNotStore，不删除任何文件
+func Open(dir string, o *Options) (*Store, error) {
+	s := &Store{
+		dir:      dir,
+		index:    make(map[string]location),
+		segments: make(map[uint64]*segment),
+	}
+	if o != nil {
+		s.opts = *o
+	}
+
+	if s.opts.MaxBytes == 0 {
+		s.opts.MaxBytes = defaultMaxBytes
+	}
+
+	if s.opts.SegmentBytes == 0 {
+		s.opts.SegmentBytes = defaultSegmentBytes
+		if s.opts.MaxBytes/4 < s.opts.SegmentBytes {
+			s.opts.SegmentBytes = s.opts.MaxBytes / 4
+		}
+	}
+
+	if s.opts.CompactRatio == 0 {
+		s.opts.CompactRatio = defaultCompactRatio
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	if err := mark(dir); err != nil {
+		return nil, err
+	}
+
+	old, err := filepath.Glob(filepath.Join(dir, "*"+segmentExt))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, path := range old {
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.rotate(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// mark 检查dir是否由 Store 创建，空目录写入标记文件
+func mark(dir string) error {
+	marker := filepath.Join(dir, markerFile)
+	if _, err := os.Stat(marker); err == nil {
+		return nil
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	f, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	names, err := f.Readdirnames(1)
+	f.Close()
+	if len(names) > 0 {
+		return fmt.Errorf("%w: %s", ErrNotStore, dir)
+	}
+	if err != nil && err != io.EOF {
+		return err
+	}
+
+	return ioutil.WriteFile(marker, nil, 0644)
+}
+
+// Put 写入key的值，覆盖之前的记录
+func (s *Store) Put(key string, value []byte, expire int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return ErrClosed
+	}
+
+	if int64(headerSize+len(key)+len(value)) > s.opts.SegmentBytes {
+		return ErrTooLarge
+	}
+
+	rotated, err := s.append(key, value, expire)
+	if err != nil {
+		return err
+	}
+
+	if rotated {
+		s.compact()
+	}
+
+	return nil
+}
+
+// Get 读取key的值
+func (s *Store) Get(key string) (value []byte, expire int64, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	loc, ok := s.index[key]
+	if !ok {
+		return nil, 0, false
+	}
+
+	k, value, expire, err := s.read(loc)
+	if err != nil || k != key {
+		// 损坏的记录当作未命中
+		s.remove(key)
+		return nil, 0, false
+	}
+
+	return value, expire, true
+}
+
+// Has 判断key是否存在，只查询内存中的索引，不读取段文件
+func (s *Store) Has(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.index[key]
+	return ok
+}
+
+// Delete 删除key
+func (s *Store) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.remove(key)
+}
+
+// Stats 返回统计信息
+func (s *Store) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st := Stats{
+		Keys:        len(s.index),
+		Bytes:       s.size,
+		Segments:    len(s.ids),
+		Compactions: s.compactions,
+		Drops:       s.drops,
+	}
+
+	for _, seg := range s.segments {
+		st.LiveBytes += seg.live
+	}
+
+	return st
+}
+
+// Close 关闭并删除所有段文件
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+
+	var first error
+	for _, id := range append([]uint64(nil), s.ids...) {
+		if err := s.deleteSegment(id); err != nil && first == nil {
+			first = err
+		}
+	}
+
+	s.index = make(map[string]location)
+	return first
+}
+
+// append 把记录追加到当前段，返回是否创建了新的段，调用方需持有 s.mu
+func (s *Store) append(key string, value []byte, expire int64) (rotated bool, err error) {
+	rec := encode(key, value, expire)
+	if s.active.size > 0 && s.active.size+int64(len(rec)) > s.opts.SegmentBytes {
+		if err := s.rotate(); err != nil {
+			return false, err
+		}
+		rotated = true
+	}
+
+	seg := s.active
+	if _, err := seg.f.WriteAt(rec, seg.size); err != nil {
+		return rotated, err
+	}
+
+	s.remove(key)
+	s.index[key] = location{seg: seg.id, offset: seg.size, size: int64(len(rec))}
+	seg.size += int64(len(rec))
+	seg.live += int64(len(rec))
+	s.size += int64(len(rec))
+
+	s.enforceLimit()
+	return rotated, nil
+}
+
+// read 读取并校验记录，调用方需持有 s.mu
+func (s *Store) read(loc location) (key string, value []byte, expire int64, err error) {
+	seg, ok := s.segments[loc.seg]
+	if !ok {
+		return "", nil, 0, ErrCorrupt
+	}
+
+	buf := make([]byte, loc.size)
+	if _, err := seg.f.ReadAt(buf, loc.offset); err != nil {
+		return "", nil, 0, err
+	}
+
+	return decode(buf)
+}
+
+// remove 从索引中删除key，调用方需持有 s.mu
+func (s *Store) remove(key string) {
+	loc, ok := s.index[key]
+	if !ok {
+		return
+	}
+
+	delete(s.index, key)
+	if seg, ok := s.segments[loc.seg]; ok {
+		seg.live -= loc.size
+	}
+}
+
+// rotate 创建新的段作为当前段，调用方需持有 s.mu
+func (s *Store) rotate() error {
+	var id uint64
+	if n := len(s.ids); n > 0 {
+		id = s.ids[n-1] + 1
+	}
+
+	f, err := os.OpenFile(s.path(id), os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	seg := &segment{id: id, f: f}
+	s.segments[id] = seg
+	s.ids = append(s.ids, id)
+	s.active = seg
+
+	return nil
+}
+
+// enforceLimit 总大小超过上限时删除最旧的段，当前段不会被删除，调用方需持有 s.mu
+func (s *Store) enforceLimit() {
+	for s.size > s.opts.MaxBytes && len(s.ids) > 1 {
+		id := s.ids[0]
+		for key, loc := range s.index {
+			if loc.seg == id {
+				delete(s.index, key)
+			}
+		}
+
+		s.deleteSegment(id)
+		s.drops++
+	}
+}
+
+// compact 压缩有效数据比例过低的段，调用方需持有 s.mu
+func (s *Store) compact() {
+	ids := append([]uint64(nil), s.ids...)
+	for _, id := range ids {
+		seg, ok := s.segments[id]
+		if !ok || seg == s.active {
+			continue
+		}
+
+		if float64(seg.live) >= s.opts.CompactRatio*float64(seg.size) {
+			continue
+		}
+
+		// 按偏移量的顺序重新写入，保持记录之间的先后顺序
+		var keys []string
+		for key, loc := range s.index {
+			if loc.seg == id {
+				keys = append(keys, key)
+			}
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			return s.index[keys[i]].offset < s.index[keys[j]].offset
+		})
+
+		for _, key := range keys {
+			loc, ok := s.index[key]
+			if !ok || loc.seg != id {
+				// 写入过程中因为字节上限被删除
+				continue
+			}
+
+			_, value, expire, err := s.read(loc)
+			if err == nil {
+				_, err = s.append(key, value, expire)
+			}
+			if err != nil {
+				s.remove(key)
+			}
+		}
+
+		if _, ok := s.segments[id]; ok {
+			s.deleteSegment(id)
+		}
+		s.compactions++
+	}
+}
+
+// deleteSegment 关闭并删除段文件，调用方需持有 s.mu
+func (s *Store) deleteSegment(id uint64) error {
+	seg, ok := s.segments[id]
+	if !ok {
+		return nil
+	}
+
+	delete(s.segments, id)
+	for i, v := range s.ids {
+		if v == id {
+			s.ids = append(s.ids[:i], s.ids[i+1:]...)
+			break
+		}
+	}
+	s.size -= seg.size
+
+	seg.f.Close()
+	return os.Remove(s.path(id))
+}
+
+func (s *Store) path(id uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%016x%s", id, segmentExt))
+}
+
+func encode(key string, value []byte, expire int64) []byte {
+	rec := make([]byte, headerSize+len(key)+len(value))
+	binary.BigEndian.PutUint32(rec[4:], uint32(len(key)))
+	binary.BigEndian.PutUint32(rec[8:], uint32(len(value)))
+	binary.BigEndian.PutUint64(rec[12:], uint64(expire))
+	copy(rec[headerSize:], key)
+	copy(rec[headerSize+len(key):], value)
+	binary.BigEndian.PutUint32(rec, crc32.ChecksumIEEE(rec[4:]))
+	return rec
+}
+
+func decode(rec []byte) (key string, value []byte, expire int64, err error) {
+	if len(rec) < headerSize || binary.BigEndian.Uint32(rec) != crc32.ChecksumIEEE(rec[4:]) {
+		return "", nil, 0, ErrCorrupt
+	}
+
+	keyLen := int(binary.BigEndian.Uint32(rec[4:]))
+	valLen := int(binary.BigEndian.Uint32(rec[8:]))
+	if headerSize+keyLen+valLen != len(rec) {
+		return "", nil, 0, ErrCorrupt
+	}
+
+	expire = int64(binary.BigEndian.Uint64(rec[12:]))
+	key = string(rec[headerSize : headerSize+keyLen])
+	value = rec[headerSize+keyLen:]
+	return key, value, expire, nil
+}
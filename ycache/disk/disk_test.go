@@ -0,0 +1,161 @@
+package disk
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func open(t *testing.T, o *Options) *Store {
+	s, err := Open(t.TempDir(), o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestPutGet(t *testing.T) {
+	s := open(t, nil)
+
+	if err := s.Put("key", []byte("v1"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put("key", []byte("v2"), 42); err != nil {
+		t.Fatal(err)
+	}
+
+	if v, expire, ok := s.Get("key"); !ok || string(v) != "v2" || expire != 42 {
+		t.Fatalf("Get = %q, %d, %v; want v2, 42", v, expire, ok)
+	}
+
+	s.Delete("key")
+	if _, _, ok := s.Get("key"); ok {
+		t.Fatal("deleted key found")
+	}
+
+	if st := s.Stats(); st.Keys != 0 || st.LiveBytes != 0 {
+		t.Fatalf("unexpected stats after delete: %+v", st)
+	}
+}
+
+func TestOpenClearsDir(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, markerFile), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	stale := filepath.Join(dir, "0000000000000007"+segmentExt)
+	if err := os.WriteFile(stale, []byte("stale"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := Open(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Fatal("stale segment was not removed")
+	}
+}
+
+func TestOpenForeignDir(t *testing.T) {
+	dir := t.TempDir()
+	foreign := filepath.Join(dir, "data"+segmentExt)
+	if err := os.WriteFile(foreign, []byte("not a cache"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// 不是由 Store 创建的非空目录不会被清空
+	if _, err := Open(dir, nil); !errors.Is(err, ErrNotStore) {
+		t.Fatalf("Open = %v, want ErrNotStore", err)
+	}
+	if _, err := os.Stat(foreign); err != nil {
+		t.Fatalf("file in a foreign directory was removed: %v", err)
+	}
+
+	// 关闭后重新打开同一个目录
+	dir = filepath.Join(t.TempDir(), "store")
+	s, err := Open(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Put("key", []byte("value"), 0)
+	s.Close()
+
+	s, err = Open(dir, nil)
+	if err != nil {
+		t.Fatalf("reopening the store: %v", err)
+	}
+	s.Close()
+}
+
+func TestMaxBytes(t *testing.T) {
+	value := []byte(strings.Repeat("x", 80))
+	s := open(t, &Options{MaxBytes: 1000, SegmentBytes: 250, CompactRatio: 0.01})
+
+	for i := 0; i < 50; i++ {
+		if err := s.Put(fmt.Sprintf("key-%02d", i), value, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	st := s.Stats()
+	if st.Bytes > 1000 || st.Drops == 0 {
+		t.Fatalf("store is not bounded: %+v", st)
+	}
+
+	// 最旧的数据被删除，最新的数据仍然可以读取
+	if _, _, ok := s.Get("key-00"); ok {
+		t.Fatal("oldest key survived")
+	}
+	if v, _, ok := s.Get("key-49"); !ok || string(v) != string(value) {
+		t.Fatal("newest key is missing")
+	}
+
+	if err := s.Put("big", make([]byte, 300), 0); err != ErrTooLarge {
+		t.Fatalf("Put of a record larger than a segment returned %v", err)
+	}
+}
+
+func TestCompaction(t *testing.T) {
+	value := []byte(strings.Repeat("x", 80))
+	s := open(t, &Options{MaxBytes: 1 << 20, SegmentBytes: 250, CompactRatio: 0.6})
+
+	// 每个段可以写入两条记录，覆盖其中一条后该段的有效数据只剩一半
+	s.Put("a", value, 0)
+	s.Put("b", value, 0)
+	s.Put("a", value, 0)
+	s.Put("a", value, 0)
+	s.Put("c", value, 0)
+
+	st := s.Stats()
+	if st.Compactions == 0 {
+		t.Fatalf("no compaction: %+v", st)
+	}
+
+	for _, key := range []string{"a", "b", "c"} {
+		if _, _, ok := s.Get(key); !ok {
+			t.Fatalf("%s lost during compaction", key)
+		}
+	}
+
+	if st.LiveBytes*2 < st.Bytes {
+		t.Fatalf("live data is still below the ratio after compaction: %+v", st)
+	}
+}
+
+func TestCorruptRecord(t *testing.T) {
+	s := open(t, nil)
+	s.Put("key", []byte("value"), 0)
+
+	// 修改磁盘上的数据后校验失败，当作未命中
+	s.active.f.WriteAt([]byte("X"), headerSize+3)
+	if _, _, ok := s.Get("key"); ok {
+		t.Fatal("corrupt record returned")
+	}
+}
@@ -0,0 +1,226 @@
+package ycache
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 事件流的默认配置
+const (
+	defaultEventBuffer  = 1024
+	eventHeartbeat      = 15 * time.Second
+	eventsGroupParam    = "group"
+	eventsSinceParam    = "since"
+	eventsLastIDHeader  = "Last-Event-ID"
+	eventsContentType   = "text/event-stream"
+	eventsIDSeparator   = "-"
+	eventsHeartbeatLine = ": ping\n\n"
+)
+
+// EventType 事件的类型
+type EventType string
+
+const (
+	// EventSet key的值被 Set 更新，事件中包含新的值
+	EventSet EventType = "set"
+	// EventRemove key被删除
+	EventRemove EventType = "remove"
+	// EventTag 带有标签的数据被删除，之前会先发出每个key的 EventRemove
+	EventTag EventType = "tag"
+	// EventGeneration generation增加，所有旧的数据失效
+	EventGeneration EventType = "generation"
+	// EventReset 请求的位置已不在回放缓冲中，客户端需要清空本地缓存后从该事件继续
+	EventReset EventType = "reset"
+)
+
+// Event Group中数据的变化，只包含本节点上发生的变化
+type Event struct {
+	Seq        uint64    `json:"seq"`
+	Type       EventType `json:"type"`
+	Key        string    `json:"key,omitempty"`
+	Value      []byte    `json:"value,omitempty"`
+	Tag        string    `json:"tag,omitempty"`
+	Generation uint64    `json:"generation,omitempty"`
+}
+
+// eventLog 保存最近的事件，序号从1开始递增
+// epoch 在进程启动时生成，节点重启后旧的序号不会被误认为仍然有效
+type eventLog struct {
+	mu      sync.Mutex
+	epoch   int64
+	seq     uint64
+	buf     []Event // 环形缓冲，保存最近的事件
+	changed chan struct{}
+}
+
+func newEventLog(size int) *eventLog {
+	return &eventLog{
+		epoch:   time.Now().UnixNano(),
+		buf:     make([]Event, 0, size),
+		changed: make(chan struct{}),
+	}
+}
+
+// publish 记录事件并唤醒所有等待中的订阅者
+func (l *eventLog) publish(e Event) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.seq++
+	e.Seq = l.seq
+	if len(l.buf) < cap(l.buf) {
+		l.buf = append(l.buf, e)
+	} else {
+		l.buf[int((e.Seq-1)%uint64(cap(l.buf)))] = e
+	}
+
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+// since 返回序号大于seq的事件以及有新事件时会被关闭的channel
+// seq之后的事件已被覆盖或seq大于当前序号时ok为false
+func (l *eventLog) since(seq uint64) (events []Event, changed <-chan struct{}, ok bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	oldest := l.seq - uint64(len(l.buf)) // 缓冲中最早的事件之前的序号
+	if seq > l.seq || seq < oldest {
+		return nil, l.changed, false
+	}
+
+	for s := seq + 1; s <= l.seq; s++ {
+		events = append(events, l.buf[int((s-1)%uint64(cap(l.buf)))])
+	}
+
+	return events, l.changed, true
+}
+
+// last 返回当前的序号
+func (l *eventLog) last() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.seq
+}
+
+// id 返回事件在SSE中的id，由epoch与序号组成
+func (l *eventLog) id(seq uint64) string {
+	return strconv.FormatInt(l.epoch, 10) + eventsIDSeparator + strconv.FormatUint(seq, 10)
+}
+
+// parseID 解析 id 返回的字符串，epoch不一致时ok为false
+func (l *eventLog) parseID(id string) (seq uint64, ok bool) {
+	parts := strings.SplitN(id, eventsIDSeparator, 2)
+	if len(parts) != 2 || parts[0] != strconv.FormatInt(l.epoch, 10) {
+		return 0, false
+	}
+
+	seq, err := strconv.ParseUint(parts[1], 10, 64)
+	return seq, err == nil
+}
+
+// Events 返回序号大于seq的事件，seq之后的事件已不在回放缓冲中时ok为false
+func (g *Group) Events(seq uint64) (events []Event, ok bool) {
+	events, _, ok = g.events.since(seq)
+	return
+}
+
+func (g *Group) publish(e Event) {
+	g.events.publish(e)
+}
+
+// EventHandler 以 Server-Sent Events 的形式推送Group中数据的变化
+//
+//	GET ?group=name
+//
+// 客户端断开后携带 Last-Event-ID 请求头（或since参数）重新连接，从上次收到的事件之后继续。
+// 没有指定位置时只推送之后发生的事件；位置已不在回放缓冲中时先推送 EventReset。
+type EventHandler struct{}
+
+// NewEventHandler 创建事件流接口
+func NewEventHandler() *EventHandler {
+	return &EventHandler{}
+}
+
+func (h *EventHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := r.URL.Query().Get(eventsGroupParam)
+	g := GetGroup(name)
+	if g == nil {
+		http.Error(w, "no such group: "+name, http.StatusNotFound)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	l := g.events
+	seq, resume := l.last(), true
+	id := r.Header.Get(eventsLastIDHeader)
+	if id == "" {
+		id = r.URL.Query().Get(eventsSinceParam)
+	}
+	if id != "" {
+		seq, resume = l.parseID(id)
+	}
+
+	w.Header().Set("Content-Type", eventsContentType)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(eventHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		events, changed, ok := l.since(seq)
+		if !resume || !ok {
+			// 客户端错过了部分事件，只能清空本地缓存
+			seq = l.last()
+			events = []Event{{Seq: seq, Type: EventReset, Generation: g.Generation()}}
+			resume = true
+		}
+
+		for _, e := range events {
+			if err := writeEvent(w, l.id(e.Seq), e); err != nil {
+				return
+			}
+			seq = e.Seq
+		}
+		flusher.Flush()
+
+		select {
+		case <-changed:
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, eventsHeartbeatLine); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// writeEvent 按SSE格式写入一个事件
+func writeEvent(w http.ResponseWriter, id string, e Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", id, e.Type, data)
+	return err
+}
@@ -0,0 +1,145 @@
+package ycache
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestEventLogReplay(t *testing.T) {
+	l := newEventLog(3)
+	for i := 0; i < 5; i++ {
+		l.publish(Event{Type: EventRemove})
+	}
+
+	events, _, ok := l.since(2)
+	if !ok || len(events) != 3 || events[0].Seq != 3 || events[2].Seq != 5 {
+		t.Fatalf("since(2) = %v, %v", events, ok)
+	}
+
+	// 序号1之后的事件已被覆盖
+	if _, _, ok := l.since(1); ok {
+		t.Fatal("since(1) should require a reset")
+	}
+
+	// 序号来自未来（例如节点重启之前）
+	if _, _, ok := l.since(6); ok {
+		t.Fatal("since(6) should require a reset")
+	}
+
+	if seq, ok := l.parseID(l.id(4)); !ok || seq != 4 {
+		t.Fatalf("parseID = %d, %v", seq, ok)
+	}
+
+	if _, ok := newEventLog(3).parseID(l.id(4)); ok {
+		t.Fatal("id from another epoch accepted")
+	}
+}
+
+func TestGroupEvents(t *testing.T) {
+	var loads int32
+	g := NewGroup("events", 2<<10, rowGetter(&loads))
+	ctx := context.Background()
+
+	g.Get(ctx, "row1:a")
+	g.Set(ctx, "row2:a", []byte("v"))
+	g.InvalidateTag(ctx, "row1")
+	g.BumpGeneration(ctx)
+
+	events, ok := g.Events(0)
+	if !ok {
+		t.Fatal("events not replayable")
+	}
+
+	want := []Event{
+		{Seq: 1, Type: EventSet, Key: "row2:a", Value: []byte("v")},
+		{Seq: 2, Type: EventRemove, Key: "row1:a", Tag: "row1"},
+		{Seq: 3, Type: EventTag, Tag: "row1"},
+		{Seq: 4, Type: EventGeneration, Generation: 1},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("got %d events, want %d: %v", len(events), len(want), events)
+	}
+
+	for i, e := range events {
+		w := want[i]
+		if e.Seq != w.Seq || e.Type != w.Type || e.Key != w.Key || string(e.Value) != string(w.Value) || e.Tag != w.Tag || e.Generation != w.Generation {
+			t.Fatalf("event %d = %+v, want %+v", i, e, w)
+		}
+	}
+}
+
+// readEvent 读取一个SSE事件，忽略心跳
+func readEvent(t *testing.T, r *bufio.Reader) (id string, e Event) {
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case strings.HasPrefix(line, "id: "):
+			id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "data: "):
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &e); err != nil {
+				t.Fatal(err)
+			}
+		case line == "" && id != "":
+			return id, e
+		}
+	}
+}
+
+func TestEventHandler(t *testing.T) {
+	g := NewGroup("events-http", 2<<10, GetterFunc(func(ctx context.Context, key string) ([]byte, error) {
+		return []byte(key), nil
+	}))
+	ctx := context.Background()
+
+	srv := httptest.NewServer(NewEventHandler())
+	defer srv.Close()
+
+	g.Set(ctx, "a", []byte("1"))
+
+	resp, err := http.Get(srv.URL + "?group=events-http")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := bufio.NewReader(resp.Body)
+
+	// 没有指定位置时只推送之后的事件
+	g.Set(ctx, "b", []byte("2"))
+	id, e := readEvent(t, r)
+	if e.Type != EventSet || e.Key != "b" || e.Seq != 2 {
+		t.Fatalf("got %+v", e)
+	}
+	resp.Body.Close()
+
+	// 断开期间发生的事件在重新连接后补发
+	g.Set(ctx, "c", []byte("3"))
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"?group=events-http", nil)
+	req.Header.Set("Last-Event-ID", id)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, e := readEvent(t, bufio.NewReader(resp.Body)); e.Type != EventSet || e.Key != "c" {
+		t.Fatalf("got %+v after resume", e)
+	}
+	resp.Body.Close()
+
+	// 无法识别的位置先收到 EventReset
+	resp, err = http.Get(srv.URL + "?group=events-http&since=0-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if _, e := readEvent(t, bufio.NewReader(resp.Body)); e.Type != EventReset || e.Seq != 3 {
+		t.Fatalf("got %+v, want reset", e)
+	}
+}
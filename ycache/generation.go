@@ -0,0 +1,116 @@
+package ycache
+
+import (
+	pb "7days/ycache/ycachepb"
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+)
+
+// Group的generation用于使整个Group的缓存失效。
+// 缓存中的数据记录写入时的generation，小于当前generation的数据视为未命中，之后随LRU淘汰。
+// 节点之间的请求与响应都携带generation，任何一方看到更大的值时都会采用它，
+// 所以没有收到 BumpGeneration 通知的节点也会在与其他节点通信时追上。
+// generation 由哈希环上负责 generationKey 的节点统一增加，
+// 多个节点同时调用 BumpGeneration 时得到不同的值，每一次失效都会生效。
+
+// generationKey 返回在哈希环上决定由哪个节点负责增加generation的key
+func generationKey(group string) string {
+	return generationPath + "/" + group
+}
+
+// Generation 返回Group当前的generation
+func (g *Group) Generation() uint64 {
+	return atomic.LoadUint64(&g.generation)
+}
+
+// observeGeneration 看到更大的generation时采用它，返回是否发生了变化
+func (g *Group) observeGeneration(gen uint64) bool {
+	for {
+		cur := atomic.LoadUint64(&g.generation)
+		if gen <= cur {
+			return false
+		}
+
+		if atomic.CompareAndSwapUint64(&g.generation, cur, gen) {
+			log.Printf("[YCache] Group %s advanced to generation %d", g.name, gen)
+			g.publish(Event{Type: EventGeneration, Generation: gen})
+			return true
+		}
+	}
+}
+
+// BumpGeneration 增加generation，使整个集群中该Group的缓存全部失效
+// 请求转发给负责generation的节点，由它增加后通知给所有节点，通知失败的节点之后在与其他节点通信时追上。
+// 负责的节点不可达时由本节点增加
+func (g *Group) BumpGeneration(ctx context.Context) (uint64, error) {
+	if g.peers != nil {
+		if peer, ok := g.peers.PickPeer(generationKey(g.name)); ok {
+			if bumper, ok := peer.(GenerationBumper); ok {
+				resp := &pb.GenerationResponse{}
+				err := bumper.BumpGeneration(ctx, &pb.GenerationRequest{Group: g.name, Generation: g.Generation()}, resp)
+				if err == nil {
+					g.observeGeneration(resp.GetGeneration())
+					return resp.GetGeneration(), nil
+				}
+
+				log.Printf("[YCache] Failed to bump generation of group %s on its owner, bumping locally: %v", g.name, err)
+			}
+		}
+	}
+
+	return g.bumpGeneration(ctx)
+}
+
+// bumpGeneration 在本节点增加generation并通知所有节点
+func (g *Group) bumpGeneration(ctx context.Context) (uint64, error) {
+	gen := atomic.AddUint64(&g.generation, 1)
+	log.Printf("[YCache] Group %s bumped to generation %d", g.name, gen)
+	g.publish(Event{Type: EventGeneration, Generation: gen})
+
+	lister, ok := g.peers.(PeerLister)
+	if !ok {
+		return gen, nil
+	}
+
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		failed int
+		last   error
+	)
+
+	peers := lister.ListPeers()
+	for _, peer := range peers {
+		setter, ok := peer.(GenerationSetter)
+		if !ok {
+			continue
+		}
+
+		wg.Add(1)
+		go func(setter GenerationSetter) {
+			defer wg.Done()
+
+			resp := &pb.GenerationResponse{}
+			err := setter.SetGeneration(ctx, &pb.GenerationRequest{Group: g.name, Generation: gen}, resp)
+			if err == nil {
+				g.observeGeneration(resp.GetGeneration())
+				return
+			}
+
+			mu.Lock()
+			failed++
+			last = err
+			mu.Unlock()
+		}(setter)
+	}
+	wg.Wait()
+
+	if failed > 0 {
+		return gen, fmt.Errorf("failed to notify %d of %d peers: %v", failed, len(peers), last)
+	}
+
+	return gen, nil
+}
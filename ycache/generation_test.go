@@ -0,0 +1,184 @@
+package ycache
+
+import (
+	pb "7days/ycache/ycachepb"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// fakeGenPeer 记录收到的generation通知
+type fakeGenPeer struct {
+	fakePeer
+	gens []uint64
+	err  error
+}
+
+func (f *fakeGenPeer) SetGeneration(ctx context.Context, in *pb.GenerationRequest, out *pb.GenerationResponse) error {
+	if f.err != nil {
+		return f.err
+	}
+
+	f.gens = append(f.gens, in.GetGeneration())
+	out.Generation = in.GetGeneration()
+	return nil
+}
+
+// listPicker 所有key都由本节点负责，只用于列出节点
+type listPicker struct {
+	peers []PeerGetter
+}
+
+func (l *listPicker) PickPeer(key string) (PeerGetter, bool) { return nil, false }
+func (l *listPicker) ListPeers() []PeerGetter                { return l.peers }
+
+func TestBumpGeneration(t *testing.T) {
+	loads := 0
+	g := NewGroup("generation", 2<<10, GetterFunc(func(ctx context.Context, key string) ([]byte, error) {
+		loads++
+		return []byte("value"), nil
+	}))
+
+	up, down := &fakeGenPeer{}, &fakeGenPeer{err: errors.New("connection refused")}
+	g.RegisterPeers(&listPicker{peers: []PeerGetter{up, down}})
+
+	ctx := context.Background()
+	g.Get(ctx, "key")
+	g.Get(ctx, "key")
+	if loads != 1 {
+		t.Fatalf("loaded %d times before bump, want 1", loads)
+	}
+
+	gen, err := g.BumpGeneration(ctx)
+	if err == nil {
+		t.Fatal("expected error when a peer cannot be notified")
+	}
+
+	if gen != 1 || g.Generation() != 1 || len(up.gens) != 1 || up.gens[0] != 1 {
+		t.Fatalf("gen = %d, Generation() = %d, notified %v", gen, g.Generation(), up.gens)
+	}
+
+	// 旧generation的数据失效，重新加载
+	g.Get(ctx, "key")
+	if loads != 2 {
+		t.Fatalf("loaded %d times after bump, want 2", loads)
+	}
+}
+
+func TestGenerationPiggyback(t *testing.T) {
+	g := NewGroup("generation-http", 2<<10, GetterFunc(func(ctx context.Context, key string) ([]byte, error) {
+		return []byte("value"), nil
+	}))
+
+	p := NewHTTPPool("http://self")
+	srv := httptest.NewServer(p)
+	defer srv.Close()
+
+	peer := p.Getter(srv.URL)
+	ctx := context.Background()
+
+	out := &pb.GenerationResponse{}
+	if err := peer.(GenerationSetter).SetGeneration(ctx, &pb.GenerationRequest{Group: "generation-http", Generation: 5}, out); err != nil {
+		t.Fatal(err)
+	}
+	if g.Generation() != 5 || out.Generation != 5 {
+		t.Fatalf("Generation() = %d, response %d; want 5", g.Generation(), out.Generation)
+	}
+
+	// 请求携带更大的generation时节点采用它，响应中返回节点的generation
+	resp := &pb.Response{}
+	if err := peer.Get(ctx, &pb.Request{Group: "generation-http", Key: "key", Generation: 7}, resp); err != nil {
+		t.Fatal(err)
+	}
+	if g.Generation() != 7 || resp.Generation != 7 {
+		t.Fatalf("Generation() = %d, response %d; want 7", g.Generation(), resp.Generation)
+	}
+
+	// generation不会减小
+	peer.Get(ctx, &pb.Request{Group: "generation-http", Key: "key", Generation: 3}, resp)
+	if g.Generation() != 7 || resp.Generation != 7 {
+		t.Fatalf("Generation() = %d, response %d; want 7", g.Generation(), resp.Generation)
+	}
+}
+
+func TestAdminGeneration(t *testing.T) {
+	g := NewGroup("generation-admin", 2<<10, GetterFunc(func(ctx context.Context, key string) ([]byte, error) {
+		return []byte("value"), nil
+	}))
+
+	srv := httptest.NewServer(NewAdmin(NewHTTPPool("http://self")))
+	defer srv.Close()
+
+	resp, err := http.Post(srv.URL+"/generation?group=generation-admin", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || g.Generation() != 1 {
+		t.Fatalf("status %s, Generation() = %d", resp.Status, g.Generation())
+	}
+}
+
+// ownerPicker generation由owner负责，其他key由本节点负责
+type ownerPicker struct {
+	owner PeerGetter
+}
+
+func (o *ownerPicker) PickPeer(key string) (PeerGetter, bool) {
+	if strings.HasPrefix(key, generationPath+"/") {
+		return o.owner, true
+	}
+	return nil, false
+}
+
+func TestBumpGenerationOnOwner(t *testing.T) {
+	g := NewGroup("generation-owner", 2<<10, GetterFunc(func(ctx context.Context, key string) ([]byte, error) {
+		return []byte("value"), nil
+	}))
+
+	// 测试中负责generation的节点与本节点共享同一个Group
+	var bumps int32
+	pool := NewHTTPPool("http://self")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == defaultBasePath+bumpPath {
+			atomic.AddInt32(&bumps, 1)
+		}
+		pool.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	g.RegisterPeers(&ownerPicker{owner: NewHTTPPool("http://self").Getter(srv.URL)})
+
+	// 同时增加generation时每次得到不同的值，任何一次失效都不会被合并
+	var wg sync.WaitGroup
+	gens := make([]uint64, 5)
+	for i := range gens {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			gen, err := g.BumpGeneration(context.Background())
+			if err != nil {
+				t.Error(err)
+			}
+			gens[i] = gen
+		}(i)
+	}
+	wg.Wait()
+
+	seen := make(map[uint64]bool)
+	for _, gen := range gens {
+		if seen[gen] {
+			t.Fatalf("generation %d returned twice: %v", gen, gens)
+		}
+		seen[gen] = true
+	}
+
+	if g.Generation() != 5 || bumps != 5 {
+		t.Fatalf("Generation() = %d after %d bumps on the owner, want 5", g.Generation(), bumps)
+	}
+}
@@ -0,0 +1,733 @@
+// Package gossip 实现基于 SWIM 协议的集群成员管理
+//
+// 每个节点周期性地随机探测一个成员(ping)，超时未响应时请其他成员代为探测(ping-req)，
+// 仍然失败则将其标记为可疑(suspect)，可疑状态持续 SuspicionTimeout 后认定为下线(dead)。
+// 被怀疑的节点收到关于自己的消息后会增大 incarnation 来反驳。
+// 成员状态的变更附带在 ping/ack 消息上以 gossip 的方式传播。
+package gossip
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 默认配置
+const (
+	defaultProbeInterval    = time.Second
+	defaultProbeTimeout     = 500 * time.Millisecond
+	defaultIndirectChecks   = 3
+	defaultSuspicionTimeout = 5 * time.Second
+	defaultJoinTimeout      = 2 * time.Second
+
+	retransmitMult = 4     // 每条状态变更被附带发送的次数为 retransmitMult×log(n+1)
+	maxPiggyback   = 16    // 每条消息最多附带的状态变更数
+	maxPacketSize  = 65507 // UDP 报文最大长度
+)
+
+// Config 成员管理的配置
+type Config struct {
+	// Name 成员名，在集群中唯一，通常为本节点的 HTTP 地址，如 "http://10.0.0.1:8001"
+	Name string
+
+	// BindAddr UDP 监听地址，如 "0.0.0.0:7946"
+	BindAddr string
+
+	// AdvertiseAddr 通告给其他成员的 UDP 地址。
+	// If blank, it defaults to the address the node is bound to.
+	AdvertiseAddr string
+
+	// ProbeInterval 探测的间隔。
+	// If blank, it defaults to 1s.
+	ProbeInterval time.Duration
+
+	// ProbeTimeout 等待ack的超时时间，需要小于 ProbeInterval。
+	// If blank, it defaults to 500ms.
+	ProbeTimeout time.Duration
+
+	// IndirectChecks 直接探测失败后请多少个成员代为探测。
+	// If blank, it defaults to 3.
+	IndirectChecks int
+
+	// SuspicionTimeout 成员被怀疑多久后被认定为下线。
+	// If blank, it defaults to 5s.
+	SuspicionTimeout time.Duration
+
+	// OnChange 存活成员的集合发生变化时调用，参数为按字典序排列的成员名(包括自己)
+	OnChange func(members []string)
+}
+
+// State 成员状态
+type State int
+
+const (
+	Alive State = iota
+	Suspect
+	Dead
+	Left
+)
+
+func (s State) String() string {
+	switch s {
+	case Alive:
+		return "alive"
+	case Suspect:
+		return "suspect"
+	case Dead:
+		return "dead"
+	case Left:
+		return "left"
+	}
+
+	return "unknown"
+}
+
+// Member 集群成员
+type Member struct {
+	Name        string
+	Addr        string
+	State       State
+	Incarnation uint64
+}
+
+// live 成员是否仍属于集群，可疑的成员在确认下线之前仍然保留
+func (m *Member) live() bool {
+	return m.State == Alive || m.State == Suspect
+}
+
+// 消息类型
+type msgType int
+
+const (
+	pingMsg msgType = iota
+	pingReqMsg
+	ackMsg
+	joinMsg
+	leaveMsg
+)
+
+// message UDP 报文
+type message struct {
+	Type    msgType  `json:"type"`
+	Seq     uint64   `json:"seq"`
+	Target  string   `json:"target,omitempty"` // ping-req 中需要代为探测的地址
+	Updates []Member `json:"updates,omitempty"`
+}
+
+// broadcast 等待传播的状态变更
+type broadcast struct {
+	member    Member
+	transmits int
+}
+
+// Node 集群中的一个成员
+type Node struct {
+	cfg  Config
+	conn *net.UDPConn
+	addr string // 通告地址
+
+	mu          sync.Mutex
+	incarnation uint64
+	members     map[string]*Member
+	broadcasts  map[string]*broadcast
+	probeOrder  []string // 本轮探测的顺序
+	seq         uint64
+	acks        map[uint64]chan struct{}
+
+	notifyMu sync.Mutex
+	lastLive []string
+
+	closeOnce sync.Once
+	done      chan struct{}
+	wg        sync.WaitGroup
+}
+
+// New 创建成员并开始监听，需要调用 Join 加入集群
+func New(cfg Config) (*Node, error) {
+	if cfg.Name == "" {
+		return nil, errors.New("gossip: member name is required")
+	}
+
+	if cfg.ProbeInterval == 0 {
+		cfg.ProbeInterval = defaultProbeInterval
+	}
+
+	if cfg.ProbeTimeout == 0 {
+		cfg.ProbeTimeout = defaultProbeTimeout
+	}
+
+	if cfg.IndirectChecks == 0 {
+		cfg.IndirectChecks = defaultIndirectChecks
+	}
+
+	if cfg.SuspicionTimeout == 0 {
+		cfg.SuspicionTimeout = defaultSuspicionTimeout
+	}
+
+	laddr, err := net.ResolveUDPAddr("udp", cfg.BindAddr)
+	if err != nil {
+		return nil, fmt.Errorf("gossip: resolving bind address: %v", err)
+	}
+
+	conn, err := net.ListenUDP("udp", laddr)
+	if err != nil {
+		return nil, fmt.Errorf("gossip: listening: %v", err)
+	}
+
+	n := &Node{
+		cfg:        cfg,
+		conn:       conn,
+		addr:       cfg.AdvertiseAddr,
+		members:    make(map[string]*Member),
+		broadcasts: make(map[string]*broadcast),
+		acks:       make(map[uint64]chan struct{}),
+		done:       make(chan struct{}),
+	}
+
+	if n.addr == "" {
+		n.addr = conn.LocalAddr().String()
+	}
+
+	n.members[cfg.Name] = &Member{Name: cfg.Name, Addr: n.addr, State: Alive}
+
+	n.wg.Add(2)
+	go n.receive()
+	go n.probeLoop()
+
+	n.notify()
+
+	return n, nil
+}
+
+// Addr 返回通告给其他成员的 UDP 地址
+func (n *Node) Addr() string {
+	return n.addr
+}
+
+// Join 通过种子节点加入集群，至少有一个种子节点响应时返回成功
+func (n *Node) Join(seeds ...string) error {
+	if len(seeds) == 0 {
+		return nil
+	}
+
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		joined int
+		errs   []string
+	)
+
+	for _, seed := range seeds {
+		wg.Add(1)
+		go func(seed string) {
+			defer wg.Done()
+
+			seq, ack := n.expectAck()
+			defer n.cancelAck(seq)
+
+			n.mu.Lock()
+			self := *n.members[n.cfg.Name]
+			n.mu.Unlock()
+
+			err := n.send(seed, &message{Type: joinMsg, Seq: seq, Updates: []Member{self}})
+			if err == nil {
+				select {
+				case <-ack:
+				case <-time.After(defaultJoinTimeout):
+					err = errors.New("timed out")
+				case <-n.done:
+					err = errors.New("node closed")
+				}
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %v", seed, err))
+				return
+			}
+			joined++
+		}(seed)
+	}
+
+	wg.Wait()
+
+	if joined == 0 {
+		return fmt.Errorf("gossip: failed to join any seed: %v", errs)
+	}
+
+	return nil
+}
+
+// Leave 通知其他成员本节点主动离开集群，然后关闭节点
+func (n *Node) Leave() error {
+	n.mu.Lock()
+	self := n.members[n.cfg.Name]
+	self.State = Left
+	update := *self
+
+	var addrs []string
+	for _, m := range n.members {
+		if m.Name != n.cfg.Name && m.live() {
+			addrs = append(addrs, m.Addr)
+		}
+	}
+	n.mu.Unlock()
+
+	// 直接通知所有成员，不依赖 gossip 传播
+	for _, addr := range addrs {
+		n.send(addr, &message{Type: leaveMsg, Updates: []Member{update}})
+	}
+
+	return n.Close()
+}
+
+// Close 停止节点，其他成员会通过故障检测发现本节点下线
+func (n *Node) Close() error {
+	var err error
+	n.closeOnce.Do(func() {
+		close(n.done)
+		err = n.conn.Close()
+		n.wg.Wait()
+	})
+
+	return err
+}
+
+// Members 返回所有已知成员，按成员名排序
+func (n *Node) Members() []Member {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	members := make([]Member, 0, len(n.members))
+	for _, m := range n.members {
+		members = append(members, *m)
+	}
+
+	sort.Slice(members, func(i, j int) bool {
+		return members[i].Name < members[j].Name
+	})
+
+	return members
+}
+
+// LiveMembers 返回存活成员的成员名(包括自己)，按字典序排列
+func (n *Node) LiveMembers() []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.liveMembers()
+}
+
+func (n *Node) liveMembers() []string {
+	var names []string
+	for _, m := range n.members {
+		if m.live() {
+			names = append(names, m.Name)
+		}
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// notify 存活成员变化时调用 OnChange
+func (n *Node) notify() {
+	n.notifyMu.Lock()
+	defer n.notifyMu.Unlock()
+
+	live := n.LiveMembers()
+	if equal(live, n.lastLive) {
+		return
+	}
+
+	n.lastLive = live
+	if n.cfg.OnChange != nil {
+		n.cfg.OnChange(live)
+	}
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// receive 读取并处理UDP报文
+func (n *Node) receive() {
+	defer n.wg.Done()
+
+	buf := make([]byte, maxPacketSize)
+	for {
+		size, from, err := n.conn.ReadFromUDP(buf)
+		if err != nil {
+			select {
+			case <-n.done:
+				return
+			default:
+			}
+
+			log.Println("[gossip] read failed:", err)
+			continue
+		}
+
+		msg := &message{}
+		if err := json.Unmarshal(buf[:size], msg); err != nil {
+			log.Println("[gossip] bad packet from", from, err)
+			continue
+		}
+
+		n.handle(from.String(), msg)
+	}
+}
+
+// handle 处理一条消息
+func (n *Node) handle(from string, msg *message) {
+	n.merge(msg.Updates)
+
+	switch msg.Type {
+	case pingMsg:
+		n.send(from, &message{Type: ackMsg, Seq: msg.Seq})
+	case pingReqMsg:
+		go n.pingFor(from, msg.Target, msg.Seq)
+	case ackMsg:
+		n.mu.Lock()
+		if ch, ok := n.acks[msg.Seq]; ok {
+			delete(n.acks, msg.Seq)
+			close(ch)
+		}
+		n.mu.Unlock()
+	case joinMsg:
+		// 新成员需要完整的成员列表
+		n.send(from, &message{Type: ackMsg, Seq: msg.Seq, Updates: n.Members()})
+	case leaveMsg:
+	}
+}
+
+// pingFor 代替 requester 探测 target，收到ack后转发给 requester
+func (n *Node) pingFor(requester, target string, seq uint64) {
+	mySeq, ack := n.expectAck()
+	defer n.cancelAck(mySeq)
+
+	n.send(target, &message{Type: pingMsg, Seq: mySeq})
+
+	select {
+	case <-ack:
+		n.send(requester, &message{Type: ackMsg, Seq: seq})
+	case <-time.After(n.cfg.ProbeTimeout):
+	case <-n.done:
+	}
+}
+
+// probeLoop 周期性地探测成员
+func (n *Node) probeLoop() {
+	defer n.wg.Done()
+
+	ticker := time.NewTicker(n.cfg.ProbeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-n.done:
+			return
+		case <-ticker.C:
+			n.probe()
+		}
+	}
+}
+
+// probe 探测下一个成员
+func (n *Node) probe() {
+	target, ok := n.nextTarget()
+	if !ok {
+		return
+	}
+
+	seq, ack := n.expectAck()
+	defer n.cancelAck(seq)
+
+	n.send(target.Addr, &message{Type: pingMsg, Seq: seq})
+
+	select {
+	case <-ack:
+		return
+	case <-time.After(n.cfg.ProbeTimeout):
+	case <-n.done:
+		return
+	}
+
+	// 直接探测失败，请其他成员代为探测
+	for _, m := range n.randomMembers(n.cfg.IndirectChecks, target.Name) {
+		n.send(m.Addr, &message{Type: pingReqMsg, Seq: seq, Target: target.Addr})
+	}
+
+	select {
+	case <-ack:
+		return
+	case <-time.After(n.cfg.ProbeInterval - n.cfg.ProbeTimeout):
+	case <-n.done:
+		return
+	}
+
+	n.merge([]Member{{
+		Name:        target.Name,
+		Addr:        target.Addr,
+		State:       Suspect,
+		Incarnation: target.Incarnation,
+	}})
+}
+
+// nextTarget 按随机的轮转顺序返回下一个需要探测的成员
+func (n *Node) nextTarget() (Member, bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	for {
+		if len(n.probeOrder) == 0 {
+			for name, m := range n.members {
+				if name != n.cfg.Name && m.live() {
+					n.probeOrder = append(n.probeOrder, name)
+				}
+			}
+
+			if len(n.probeOrder) == 0 {
+				return Member{}, false
+			}
+
+			rand.Shuffle(len(n.probeOrder), func(i, j int) {
+				n.probeOrder[i], n.probeOrder[j] = n.probeOrder[j], n.probeOrder[i]
+			})
+		}
+
+		name := n.probeOrder[0]
+		n.probeOrder = n.probeOrder[1:]
+		if m, ok := n.members[name]; ok && m.live() {
+			return *m, true
+		}
+	}
+}
+
+// randomMembers 随机返回最多k个存活成员，不包括自己和 exclude
+func (n *Node) randomMembers(k int, exclude string) []Member {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	var members []Member
+	for name, m := range n.members {
+		if name != n.cfg.Name && name != exclude && m.State == Alive {
+			members = append(members, *m)
+		}
+	}
+
+	rand.Shuffle(len(members), func(i, j int) {
+		members[i], members[j] = members[j], members[i]
+	})
+
+	if len(members) > k {
+		members = members[:k]
+	}
+
+	return members
+}
+
+// merge 合并收到的状态变更，规则如下:
+//   - alive   incarnation 更大时生效
+//   - suspect incarnation 不小于存活成员的 incarnation，或大于可疑成员的 incarnation 时生效
+//   - dead/left incarnation 不小于当前值时生效
+//
+// 关于自己的 suspect/dead/left 消息会通过增大 incarnation 来反驳，本节点正在离开时除外。
+func (n *Node) merge(updates []Member) {
+	if len(updates) == 0 {
+		return
+	}
+
+	changed := false
+
+	n.mu.Lock()
+	for _, u := range updates {
+		if u.Name == n.cfg.Name {
+			// 离开后以相同名称重启的节点同样需要反驳旧的 left 消息
+			if u.State != Alive && u.Incarnation >= n.incarnation && n.members[n.cfg.Name].State != Left {
+				n.refute(u.Incarnation)
+			}
+			continue
+		}
+
+		cur, ok := n.members[u.Name]
+		if !ok {
+			m := u
+			n.members[u.Name] = &m
+			if !m.live() {
+				// 不认识的成员已经下线，记录下来以免旧的 alive 消息让它复活
+				continue
+			}
+
+			// 可疑的成员仍然算作存活，超时后才标记为下线
+			if u.State == Suspect {
+				n.startSuspicion(u.Name, u.Incarnation)
+			}
+
+			n.queue(u)
+			changed = true
+			continue
+		}
+
+		if !apply(cur, u) {
+			continue
+		}
+
+		wasLive := cur.live()
+		*cur = u
+		n.queue(u)
+
+		if u.State == Suspect {
+			n.startSuspicion(u.Name, u.Incarnation)
+		}
+
+		if wasLive != cur.live() {
+			changed = true
+		}
+	}
+	n.mu.Unlock()
+
+	if changed {
+		n.notify()
+	}
+}
+
+// apply 判断状态变更 u 是否覆盖当前状态 cur
+func apply(cur *Member, u Member) bool {
+	switch u.State {
+	case Alive:
+		return u.Incarnation > cur.Incarnation
+	case Suspect:
+		if cur.State == Alive {
+			return u.Incarnation >= cur.Incarnation
+		}
+		return cur.State == Suspect && u.Incarnation > cur.Incarnation
+	case Dead, Left:
+		if cur.State == Dead || cur.State == Left {
+			return u.Incarnation > cur.Incarnation
+		}
+		return u.Incarnation >= cur.Incarnation
+	}
+
+	return false
+}
+
+// refute 反驳关于自己的怀疑，调用方需持有 n.mu
+func (n *Node) refute(inc uint64) {
+	n.incarnation = inc + 1
+
+	self := n.members[n.cfg.Name]
+	self.Incarnation = n.incarnation
+	n.queue(*self)
+}
+
+// startSuspicion 可疑状态持续 SuspicionTimeout 后将成员标记为下线，调用方需持有 n.mu
+func (n *Node) startSuspicion(name string, inc uint64) {
+	time.AfterFunc(n.cfg.SuspicionTimeout, func() {
+		n.mu.Lock()
+		m, ok := n.members[name]
+		if !ok || m.State != Suspect || m.Incarnation != inc {
+			n.mu.Unlock()
+			return
+		}
+
+		dead := *m
+		dead.State = Dead
+		n.mu.Unlock()
+
+		n.merge([]Member{dead})
+	})
+}
+
+// queue 将状态变更加入待传播队列，同一成员较新的变更会覆盖旧的，调用方需持有 n.mu
+func (n *Node) queue(m Member) {
+	n.broadcasts[m.Name] = &broadcast{member: m}
+}
+
+// piggyback 取出需要附带在消息上的状态变更
+func (n *Node) piggyback() []Member {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if len(n.broadcasts) == 0 {
+		return nil
+	}
+
+	pending := make([]*broadcast, 0, len(n.broadcasts))
+	for _, b := range n.broadcasts {
+		pending = append(pending, b)
+	}
+
+	// 优先发送传播次数少的变更
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].transmits < pending[j].transmits
+	})
+
+	if len(pending) > maxPiggyback {
+		pending = pending[:maxPiggyback]
+	}
+
+	limit := retransmitMult * int(math.Ceil(math.Log10(float64(len(n.members)+1))))
+	updates := make([]Member, 0, len(pending))
+	for _, b := range pending {
+		updates = append(updates, b.member)
+		b.transmits++
+		if b.transmits >= limit {
+			delete(n.broadcasts, b.member.Name)
+		}
+	}
+
+	return updates
+}
+
+// expectAck 分配序号并注册ack等待
+func (n *Node) expectAck() (uint64, <-chan struct{}) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.seq++
+	ch := make(chan struct{})
+	n.acks[n.seq] = ch
+	return n.seq, ch
+}
+
+func (n *Node) cancelAck(seq uint64) {
+	n.mu.Lock()
+	delete(n.acks, seq)
+	n.mu.Unlock()
+}
+
+// send 发送消息，并附带待传播的状态变更
+func (n *Node) send(addr string, msg *message) error {
+	msg.Updates = append(msg.Updates, n.piggyback()...)
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	raddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return err
+	}
+
+	_, err = n.conn.WriteToUDP(data, raddr)
+	return err
+}
@@ -0,0 +1,209 @@
+package gossip
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testNode 记录最近一次 OnChange 的结果
+type testNode struct {
+	*Node
+	mu      sync.Mutex
+	members []string
+}
+
+func (t *testNode) seen() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.members
+}
+
+func newTestNode(t *testing.T, i int) *testNode {
+	tn := &testNode{}
+	n, err := New(Config{
+		Name:             fmt.Sprintf("http://localhost:800%d", i),
+		BindAddr:         "127.0.0.1:0",
+		ProbeInterval:    20 * time.Millisecond,
+		ProbeTimeout:     8 * time.Millisecond,
+		SuspicionTimeout: 100 * time.Millisecond,
+		OnChange: func(members []string) {
+			tn.mu.Lock()
+			tn.members = members
+			tn.mu.Unlock()
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tn.Node = n
+	return tn
+}
+
+// newCluster 创建n个节点，其余节点都通过第一个节点加入集群
+func newCluster(t *testing.T, n int) []*testNode {
+	nodes := make([]*testNode, n)
+	for i := range nodes {
+		nodes[i] = newTestNode(t, i+1)
+		if i > 0 {
+			if err := nodes[i].Join(nodes[0].Addr()); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	return nodes
+}
+
+func names(nodes []*testNode) []string {
+	var names []string
+	for _, n := range nodes {
+		names = append(names, n.cfg.Name)
+	}
+	return names
+}
+
+// waitMembers 等待所有节点看到的存活成员都是 want
+func waitMembers(t *testing.T, nodes []*testNode, want []string) {
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		converged := true
+		for _, n := range nodes {
+			if !reflect.DeepEqual(n.seen(), want) {
+				converged = false
+			}
+		}
+
+		if converged {
+			return
+		}
+
+		if time.Now().After(deadline) {
+			for _, n := range nodes {
+				t.Logf("%s sees %v", n.cfg.Name, n.seen())
+			}
+			t.Fatalf("members did not converge to %v", want)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestJoin(t *testing.T) {
+	nodes := newCluster(t, 4)
+	for _, n := range nodes {
+		defer n.Close()
+	}
+
+	waitMembers(t, nodes, names(nodes))
+}
+
+func TestRejoinAfterLeave(t *testing.T) {
+	nodes := newCluster(t, 3)
+	for _, n := range nodes[:2] {
+		defer n.Close()
+	}
+
+	waitMembers(t, nodes, names(nodes))
+
+	// 优雅离开后以相同名称重启，需要反驳旧的 left 状态才能重新加入
+	nodes[2].Leave()
+	waitMembers(t, nodes[:2], names(nodes[:2]))
+
+	nodes[2] = newTestNode(t, 3)
+	defer nodes[2].Close()
+	if err := nodes[2].Join(nodes[0].Addr()); err != nil {
+		t.Fatal(err)
+	}
+
+	waitMembers(t, nodes, names(nodes))
+}
+
+func TestJoinNoSeed(t *testing.T) {
+	n := newTestNode(t, 1)
+	defer n.Close()
+
+	if err := n.Join("127.0.0.1:1"); err == nil {
+		t.Fatal("expected error when no seed responds")
+	}
+}
+
+func TestFailureDetection(t *testing.T) {
+	nodes := newCluster(t, 4)
+	for _, n := range nodes[:3] {
+		defer n.Close()
+	}
+
+	waitMembers(t, nodes, names(nodes))
+
+	// 直接关闭，不通知其他节点
+	nodes[3].Close()
+	waitMembers(t, nodes[:3], names(nodes[:3]))
+
+	for _, m := range nodes[0].Members() {
+		if m.Name == nodes[3].cfg.Name && m.State != Dead {
+			t.Fatalf("closed node is %v, want dead", m.State)
+		}
+	}
+}
+
+func TestLeave(t *testing.T) {
+	nodes := newCluster(t, 3)
+	for _, n := range nodes[:2] {
+		defer n.Close()
+	}
+
+	waitMembers(t, nodes, names(nodes))
+
+	if err := nodes[2].Leave(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 主动离开的节点立即被移除，不需要等待故障检测
+	start := time.Now()
+	waitMembers(t, nodes[:2], names(nodes[:2]))
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Fatalf("leave took %v to propagate", elapsed)
+	}
+}
+
+func TestRejoin(t *testing.T) {
+	nodes := newCluster(t, 3)
+	for _, n := range nodes[:2] {
+		defer n.Close()
+	}
+
+	waitMembers(t, nodes, names(nodes))
+
+	// 节点重启后 incarnation 从0开始，需要反驳旧的下线状态才能重新加入
+	nodes[2].Close()
+	waitMembers(t, nodes[:2], names(nodes[:2]))
+
+	nodes[2] = newTestNode(t, 3)
+	defer nodes[2].Close()
+	if err := nodes[2].Join(nodes[0].Addr()); err != nil {
+		t.Fatal(err)
+	}
+
+	waitMembers(t, nodes, names(nodes))
+}
+
+func TestLearnSuspect(t *testing.T) {
+	n := newTestNode(t, 1)
+	defer n.Close()
+
+	// 第一次听说的成员已经是可疑状态：算作存活，超时后标记为下线
+	ghost := Member{Name: "http://localhost:8009", Addr: "127.0.0.1:1", State: Suspect, Incarnation: 1}
+	n.merge([]Member{ghost})
+	waitMembers(t, []*testNode{n}, []string{n.cfg.Name, ghost.Name})
+	waitMembers(t, []*testNode{n}, []string{n.cfg.Name})
+
+	for _, m := range n.Members() {
+		if m.Name == ghost.Name && m.State != Dead {
+			t.Fatalf("suspect member is %v after the suspicion timeout, want dead", m.State)
+		}
+	}
+}
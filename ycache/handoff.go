@@ -0,0 +1,211 @@
+package ycache
+
+import (
+	pb "7days/ycache/ycachepb"
+	"context"
+	"log"
+	"time"
+)
+
+// 数据移交的默认配置
+const (
+	defaultHandoffRate  = 1 << 20  // 1MB/s
+	handoffBatchBytes   = 64 << 10 // 每次推送的最大字节数
+	handoffPushPath     = "_push"
+	handoffPushTimeout  = 5 * time.Second
+	handoffChangeSettle = 100 * time.Millisecond // 等待节点变化稳定后再开始移交
+)
+
+// handoffBudget 一次数据移交的字节预算与速率限制，由所有Group共享
+type handoffBudget struct {
+	remaining int64 // 剩余可以推送的字节数
+	rate      int64 // 每秒最多推送的字节数
+}
+
+// reserve 预留n字节的预算，预算不足时返回false
+func (b *handoffBudget) reserve(n int64) bool {
+	if n > b.remaining {
+		return false
+	}
+
+	b.remaining -= n
+	return true
+}
+
+// wait 按速率限制等待发送n字节所需的时间，ctx结束时返回false
+func (b *handoffBudget) wait(ctx context.Context, n int64) bool {
+	d := time.Duration(float64(n) / float64(b.rate) * float64(time.Second))
+	return sleep(ctx, d) == nil
+}
+
+// handoff 把本节点缓存中已经不归本节点负责的热点数据推送给新的负责节点
+// 按从热到冷的顺序推送，字节预算用尽时停止
+func (g *Group) handoff(ctx context.Context, budget *handoffBudget) {
+	keys, values := g.mainCache.hottest(0)
+	gen := g.Generation()
+
+	type batch struct {
+		req   *pb.PushRequest
+		bytes int64
+	}
+	batches := make(map[PeerPusher]*batch)
+
+	flush := func(peer PeerPusher, b *batch) bool {
+		delete(batches, peer)
+		if !budget.wait(ctx, b.bytes) {
+			return false
+		}
+
+		pushCtx, cancel := context.WithTimeout(ctx, handoffPushTimeout)
+		defer cancel()
+
+		if err := peer.Push(pushCtx, b.req, &pb.PushResponse{}); err != nil {
+			log.Println("[YCache] Failed to hand off keys", err)
+		}
+		return true
+	}
+
+	// 每个key都要选择一次节点，避免逐个输出日志
+	pick := g.peers.PickPeer
+	if q, ok := g.peers.(quietPicker); ok {
+		pick = q.pickPeer
+	}
+
+	for i, key := range keys {
+		// 旧generation的数据已经失效
+		if values[i].gen < gen {
+			continue
+		}
+
+		peer, ok := pick(key)
+		if !ok {
+			// 仍然由本节点负责
+			continue
+		}
+
+		pusher, ok := peer.(PeerPusher)
+		if !ok {
+			continue
+		}
+
+		size := int64(len(key) + values[i].Len())
+		if !budget.reserve(size) {
+			break
+		}
+
+		b, ok := batches[pusher]
+		if !ok {
+			b = &batch{req: &pb.PushRequest{Group: g.name}}
+			batches[pusher] = b
+		}
+
+		b.req.Entries = append(b.req.Entries, &pb.Entry{
+			Key:        key,
+			Value:      values[i].ByteSlice(),
+			Expire:     unixNano(values[i].expire),
+			Generation: values[i].gen,
+			Tags:       values[i].tags,
+		})
+		b.bytes += size
+
+		if b.bytes >= handoffBatchBytes && !flush(pusher, b) {
+			return
+		}
+	}
+
+	for peer, b := range batches {
+		if !flush(peer, b) {
+			return
+		}
+	}
+}
+
+// receivePush 接收其他节点移交的数据
+func (g *Group) receivePush(req *pb.PushRequest) int64 {
+	var accepted int64
+	for _, e := range req.GetEntries() {
+		if e.GetKey() == "" {
+			continue
+		}
+
+		g.observeGeneration(e.GetGeneration())
+		value := ByteView{
+			data:   cloneBytes(e.GetValue()),
+			expire: fromUnixNano(e.GetExpire()),
+			gen:    e.GetGeneration(),
+			tags:   e.GetTags(),
+		}
+		if value.expired(time.Now()) || value.gen < g.Generation() {
+			continue
+		}
+
+		g.populateCache(e.GetKey(), value)
+		accepted++
+	}
+
+	return accepted
+}
+
+// startHandoff 节点变化后开始数据移交，取消上一次尚未完成的移交，调用方需持有 p.mu
+func (p *HTTPPool) startHandoff() {
+	if p.opts.HandoffBytes <= 0 {
+		return
+	}
+
+	if p.cancelHandoff != nil {
+		p.cancelHandoff()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p.cancelHandoff = cancel
+	go p.handoff(ctx)
+}
+
+// handoff 把所有使用该HTTP池的Group中不再归本节点负责的热点数据推送给新的负责节点
+func (p *HTTPPool) handoff(ctx context.Context) {
+	// 节点变化往往成批出现，等待稳定后再开始
+	if sleep(ctx, handoffChangeSettle) != nil {
+		return
+	}
+
+	gs := p.groups()
+	budget := &handoffBudget{remaining: p.opts.HandoffBytes, rate: p.opts.HandoffRate}
+	for _, g := range gs {
+		if ctx.Err() != nil {
+			return
+		}
+		g.handoff(ctx, budget)
+	}
+}
+
+// groups 返回使用该HTTP池的Group，包括通过 MigrationPicker 等包装使用的Group
+func (p *HTTPPool) groups() []*Group {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	var gs []*Group
+	for _, g := range groups {
+		if usesPool(g.peers, p) {
+			gs = append(gs, g)
+		}
+	}
+
+	return gs
+}
+
+// usesPool 判断 peers 是否为 p 或者包装了 p
+func usesPool(peers PeerPicker, p *HTTPPool) bool {
+	for peers != nil {
+		if peers == PeerPicker(p) {
+			return true
+		}
+
+		w, ok := peers.(pickerWrapper)
+		if !ok {
+			return false
+		}
+		peers = w.Unwrap()
+	}
+
+	return false
+}
@@ -0,0 +1,152 @@
+package ycache
+
+import (
+	pb "7days/ycache/ycachepb"
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// fakePusher 记录收到的推送
+type fakePusher struct {
+	fakePeer
+	mu      sync.Mutex
+	entries []*pb.Entry
+}
+
+func (f *fakePusher) Push(ctx context.Context, in *pb.PushRequest, out *pb.PushResponse) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.entries = append(f.entries, in.GetEntries()...)
+	out.Accepted = int64(len(in.GetEntries()))
+	return nil
+}
+
+// movedPicker 以"moved"开头的key归其他节点负责
+type movedPicker struct {
+	peer PeerGetter
+}
+
+func (m *movedPicker) PickPeer(key string) (PeerGetter, bool) {
+	if strings.HasPrefix(key, "moved") {
+		return m.peer, true
+	}
+	return nil, false
+}
+
+// warm 写入缓存并访问足够多次，使key进入LRU-K的缓存表并成为最热的数据
+func warm(g *Group, key, value string) {
+	g.populateCache(key, ByteView{data: []byte(value)})
+	for i := 0; i < 3; i++ {
+		g.mainCache.get(key, 0)
+	}
+}
+
+func TestHandoff(t *testing.T) {
+	pusher := &fakePusher{}
+	g := NewGroup("handoff", 2<<10, GetterFunc(func(ctx context.Context, key string) ([]byte, error) {
+		return []byte("local"), nil
+	}))
+	g.RegisterPeers(&movedPicker{peer: pusher})
+
+	warm(g, "moved-cold", "1234")
+	warm(g, "kept", "1234")
+	warm(g, "moved-hot", "1234")
+
+	// 每个key占用 len(key)+len(value) 字节，预算只够推送最热的一个
+	budget := &handoffBudget{remaining: 15, rate: 1 << 30}
+	g.handoff(context.Background(), budget)
+
+	if len(pusher.entries) != 1 || pusher.entries[0].GetKey() != "moved-hot" {
+		t.Fatalf("pushed %v, want only moved-hot", pusher.entries)
+	}
+
+	if budget.remaining != 2 {
+		t.Fatalf("remaining budget = %d, want 2", budget.remaining)
+	}
+}
+
+func TestHandoffRate(t *testing.T) {
+	pusher := &fakePusher{}
+	g := NewGroup("handoff-rate", 2<<10, GetterFunc(func(ctx context.Context, key string) ([]byte, error) {
+		return []byte("local"), nil
+	}))
+	g.RegisterPeers(&movedPicker{peer: pusher})
+	warm(g, "moved", strings.Repeat("x", 95))
+
+	// 100字节按1000字节/秒的速率需要100ms，ctx先结束时放弃推送
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	g.handoff(ctx, &handoffBudget{remaining: 1 << 20, rate: 1000})
+	if len(pusher.entries) != 0 {
+		t.Fatalf("pushed %d entries before the rate limit allowed", len(pusher.entries))
+	}
+}
+
+func TestServePush(t *testing.T) {
+	g := NewGroup("push", 2<<10, GetterFunc(func(ctx context.Context, key string) ([]byte, error) {
+		return []byte("origin"), nil
+	}))
+
+	p := NewHTTPPool("http://self")
+	srv := httptest.NewServer(p)
+	defer srv.Close()
+
+	body, _ := proto.Marshal(&pb.PushRequest{
+		Group:   "push",
+		Entries: []*pb.Entry{{Key: "key", Value: []byte("pushed")}},
+	})
+
+	resp, err := http.Post(srv.URL+defaultBasePath+handoffPushPath, "application/octet-stream", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("push returned %s", resp.Status)
+	}
+
+	// 移交的数据直接命中缓存，不需要回源
+	if view, err := g.Get(context.Background(), "key"); err != nil || view.String() != "pushed" {
+		t.Fatalf("want pushed value, got %q, %v", view.String(), err)
+	}
+}
+
+func TestHandoffGroups(t *testing.T) {
+	p := NewHTTPPool("http://self")
+	getter := GetterFunc(func(ctx context.Context, key string) ([]byte, error) {
+		return []byte("local"), nil
+	})
+
+	direct := NewGroup("handoff-direct", 2<<10, getter)
+	direct.RegisterPeers(p)
+
+	// 通过 MigrationPicker 使用HTTP池的Group同样需要移交数据
+	migrating := NewGroup("handoff-migrating", 2<<10, getter)
+	migrating.RegisterPeers(NewMigrationPicker("http://self", p.Getter, nil))
+
+	other := NewGroup("handoff-other", 2<<10, getter)
+	other.RegisterPeers(NewMigrationPicker("http://self", NewHTTPPool("http://self").Getter, nil))
+
+	found := make(map[*Group]bool)
+	for _, g := range p.groups() {
+		found[g] = true
+	}
+
+	if !found[direct] || !found[migrating] {
+		t.Fatalf("groups using the pool were not found: direct %v, migrating %v", found[direct], found[migrating])
+	}
+	if found[other] {
+		t.Fatal("group using another pool was handed off")
+	}
+}
@@ -0,0 +1,265 @@
+package ycache
+
+import (
+	"7days/ycache/consistenthash"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// 健康检查的默认配置
+const (
+	healthPath                = "_health"
+	defaultHealthCheckTimeout = time.Second
+	defaultFailureThreshold   = 3
+	defaultEjectBackoff       = 5 * time.Second
+	defaultMaxEjectBackoff    = 5 * time.Minute
+)
+
+// peerHealth 记录一个节点的健康状态
+// 节点连续失败 FailureThreshold 次后被暂时移出哈希环(剔除)，
+// 退避时间过后再次探测成功才重新加入，每次剔除的退避时间翻倍。
+type peerHealth struct {
+	ejected   bool      // 是否已被移出哈希环
+	failures  int       // 连续失败次数
+	ejections int       // 连续被剔除的次数，用来计算退避时间
+	retryAt   time.Time // 被剔除后，最早可以重新加入的时间
+	stableAt  time.Time // 重新加入后，超过该时间仍然健康则清零 ejections
+	lastError string
+	lastCheck time.Time
+}
+
+// PeerStatus 节点的运行状态，用于管理接口展示
+type PeerStatus struct {
+	Peer      string     `json:"peer"`
+	Self      bool       `json:"self"`
+	Healthy   bool       `json:"healthy"`
+	Failures  int        `json:"failures"`
+	Ejections int        `json:"ejections"`
+	RetryAt   *time.Time `json:"retry_at,omitempty"`
+	LastError string     `json:"last_error,omitempty"`
+	LastCheck *time.Time `json:"last_check,omitempty"`
+	Inflight  int64      `json:"inflight"`
+	Weight    int        `json:"weight"`
+}
+
+// Status 返回HTTP池中所有节点的状态，按节点地址排序
+func (p *HTTPPool) Status() []PeerStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	status := make([]PeerStatus, 0, len(p.httpGetters))
+	for peer, g := range p.httpGetters {
+		s := PeerStatus{
+			Peer:     peer,
+			Self:     peer == p.self,
+			Healthy:  true,
+			Inflight: atomic.LoadInt64(&g.inflight),
+			Weight:   p.weight(peer),
+		}
+
+		if h, ok := p.health[peer]; ok {
+			s.Healthy = !h.ejected
+			s.Failures = h.failures
+			s.Ejections = h.ejections
+			s.LastError = h.lastError
+			if !h.lastCheck.IsZero() {
+				lastCheck := h.lastCheck
+				s.LastCheck = &lastCheck
+			}
+			if h.ejected {
+				retryAt := h.retryAt
+				s.RetryAt = &retryAt
+			}
+		}
+
+		status = append(status, s)
+	}
+
+	sort.Slice(status, func(i, j int) bool {
+		return status[i].Peer < status[j].Peer
+	})
+
+	return status
+}
+
+// reportSuccess 记录一次成功的请求或探测
+func (p *HTTPPool) reportSuccess(peer string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	h, ok := p.health[peer]
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	h.failures = 0
+	h.lastError = ""
+	h.lastCheck = now
+
+	if h.ejected {
+		if now.Before(h.retryAt) {
+			return
+		}
+
+		p.readmit(peer, h)
+		return
+	}
+
+	if h.ejections > 0 && now.After(h.stableAt) {
+		h.ejections = 0
+	}
+}
+
+// reportFailure 记录一次失败的请求或探测，连续失败达到阈值后剔除节点
+func (p *HTTPPool) reportFailure(peer string, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	h, ok := p.health[peer]
+	if !ok {
+		return
+	}
+
+	h.failures++
+	h.lastError = err.Error()
+	h.lastCheck = time.Now()
+
+	if h.ejected {
+		// 退避后的探测仍然失败，延长剔除时间
+		if !h.lastCheck.Before(h.retryAt) {
+			p.eject(peer, h)
+		}
+		return
+	}
+
+	if h.failures >= p.opts.FailureThreshold {
+		p.eject(peer, h)
+	}
+}
+
+// eject 将节点移出哈希环，调用方需持有 p.mu
+func (p *HTTPPool) eject(peer string, h *peerHealth) {
+	backoff := p.backoff(h.ejections)
+	if !h.ejected {
+		p.peers.Remove(peer)
+		p.Log("Eject peer %s for %v: %s", peer, backoff, h.lastError)
+	}
+
+	h.ejected = true
+	h.ejections++
+	h.retryAt = time.Now().Add(backoff)
+
+	// 没有主动健康检查时，被剔除的节点收不到请求，只能在退避时间过后探测一次
+	if p.opts.HealthCheckInterval <= 0 {
+		time.AfterFunc(backoff, func() {
+			select {
+			case <-p.done:
+			default:
+				p.check(peer)
+			}
+		})
+	}
+}
+
+// readmit 将被剔除的节点重新加入哈希环，调用方需持有 p.mu
+func (p *HTTPPool) readmit(peer string, h *peerHealth) {
+	p.addToRing(peer)
+	h.ejected = false
+	h.stableAt = time.Now().Add(p.backoff(h.ejections))
+	p.Log("Readmit peer %s", peer)
+	p.startHandoff()
+}
+
+// backoff 返回第n+1次剔除的时长
+func (p *HTTPPool) backoff(n int) time.Duration {
+	backoff := p.opts.EjectBackoff << uint(n)
+	if n >= 32 || backoff <= 0 || backoff > p.opts.MaxEjectBackoff {
+		return p.opts.MaxEjectBackoff
+	}
+
+	return backoff
+}
+
+// addToRing 按节点的权重将其加入哈希环，调用方需持有 p.mu
+func (p *HTTPPool) addToRing(peer string) {
+	if w, ok := p.peers.(consistenthash.WeightedSelector); ok {
+		w.AddWeighted(peer, p.weight(peer))
+		return
+	}
+
+	p.peers.Add(peer)
+}
+
+// weight 返回节点的权重，默认为1，调用方需持有 p.mu
+func (p *HTTPPool) weight(peer string) int {
+	if w, ok := p.weights[peer]; ok {
+		return w
+	}
+
+	return 1
+}
+
+// healthCheck 定时探测所有节点
+func (p *HTTPPool) healthCheck() {
+	ticker := time.NewTicker(p.opts.HealthCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+		}
+
+		for _, peer := range p.probeTargets() {
+			go p.check(peer)
+		}
+	}
+}
+
+// check 探测一次节点并记录结果
+func (p *HTTPPool) check(peer string) {
+	if err := p.probe(peer); err != nil {
+		p.reportFailure(peer, err)
+		return
+	}
+
+	p.reportSuccess(peer)
+}
+
+// probeTargets 返回本轮需要探测的节点，被剔除且未到退避时间的节点跳过
+func (p *HTTPPool) probeTargets() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	peers := make([]string, 0, len(p.health))
+	for peer, h := range p.health {
+		if h.ejected && now.Before(h.retryAt) {
+			continue
+		}
+		peers = append(peers, peer)
+	}
+
+	return peers
+}
+
+// probe 请求节点的健康检查接口
+func (p *HTTPPool) probe(peer string) error {
+	client := http.Client{Timeout: p.opts.HealthCheckTimeout}
+	resp, err := client.Get(peer + p.basePath + healthPath)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("health check returned: %v", resp.Status)
+	}
+
+	return nil
+}
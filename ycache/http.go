@@ -3,14 +3,20 @@ package ycache
 import (
 	"7days/ycache/consistenthash"
 	pb "7days/ycache/ycachepb"
+	"bytes"
 	"context"
+	"crypto/subtle"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/golang/protobuf/proto"
 )
@@ -18,24 +24,156 @@ import (
 const (
 	defaultBasePath = "/_ycache/"
 	defaultReplicas = 50
+	peekParam       = "peek" // 只查询缓存、不回源的请求参数
+	generationParam = "generation"
+	generationPath  = "_generation"
+	bumpPath        = "_bump"
+	invalidatePath  = "_invalidate"
+	leavePath       = "_leave"
+	joinPath        = "_join"
+	notFoundHeader  = "X-Ycache-Not-Found" // 响应头，说明key不存在
+	secretHeader    = "X-Ycache-Secret"    // 请求头，写入和控制节点的请求携带的共享密钥
 )
 
 // HTTPPool implements PeerPicker for a pool of HTTP peers.
+//
+// 除GET以外的节点请求(写入、删除、数据移交、generation、标签失效、离开与加入)会修改缓存或哈希环，
+// 没有设置 HTTPPoolOptions.Secret 时任何能访问节点端口的客户端都可以发起这些请求，
+// 节点端口应只在内部网络中开放。
 type HTTPPool struct {
+	inflight int64 // 本节点进行中的本地加载，放在首位保证64位对齐
+
 	// this peer's base URL, e.g. "https://example.com:9999"
 	self        string
 	basePath    string
 	mu          sync.Mutex
-	peers       *consistenthash.Map
+	opts        HTTPPoolOptions
+	peers       consistenthash.Selector
 	httpGetters map[string]*httpGetter
+	weights     map[string]int
+	health      map[string]*peerHealth
+	done        chan struct{}
+
+	cancelHandoff context.CancelFunc // 取消进行中的数据移交
+
+	shutdown sync.Once
+	drainMu  sync.Mutex
+	draining bool           // Shutdown 之后拒绝新的请求，见 shutdown.go
+	serving  sync.WaitGroup // 进行中的请求
+}
+
+// HTTPPoolOptions are the configurations of a HTTPPool.
+type HTTPPoolOptions struct {
+	// BasePath specifies the HTTP path that will serve ycache requests.
+	// If blank, it defaults to "/_ycache/".
+	BasePath string
+
+	// Replicas specifies the number of key replicas on the consistent hash.
+	// If blank, it defaults to 50.
+	Replicas int
+
+	// HashFn specifies the hash function of the consistent hash.
+	// If blank, it defaults to crc32.ChecksumIEEE.
+	HashFn consistenthash.Hash
+
+	// Selector 创建节点选择器，可以选择 Rendezvous、Jump 或 Maglev。
+	// If blank, it defaults to a consistent hash ring built from Replicas and HashFn.
+	Selector func() consistenthash.Selector
+
+	// LoadFactor 开启有界负载模式时的 ε，每个节点最多承担 (1+ε)×平均值 的进行中请求，
+	// 超出后key会溢出到哈希环上的下一个节点。仅对实现了 BoundedSelector 的选择器生效。
+	// If blank, bounded loads are disabled.
+	LoadFactor float64
+
+	// HealthCheckInterval 主动健康检查的间隔。
+	// If blank, only failures of peer requests are used to detect unhealthy peers.
+	HealthCheckInterval time.Duration
+
+	// HealthCheckTimeout 健康检查请求的超时时间。
+	// If blank, it defaults to 1s.
+	HealthCheckTimeout time.Duration
+
+	// FailureThreshold 连续失败多少次后将节点移出哈希环。
+	// If blank, it defaults to 3.
+	FailureThreshold int
+
+	// EjectBackoff 节点第一次被剔除的时长，之后每次翻倍，最多为 MaxEjectBackoff。
+	// If blank, they default to 5s and 5m.
+	EjectBackoff    time.Duration
+	MaxEjectBackoff time.Duration
+
+	// HandoffBytes 节点变化后，最多把多少字节不再归本节点负责的热点数据推送给新的负责节点。
+	// If blank, handoff is disabled.
+	HandoffBytes int64
+
+	// HandoffRate 数据移交的速率上限，单位为字节/秒。
+	// If blank, it defaults to 1MB/s.
+	HandoffRate int64
+
+	// Secret 节点间的共享密钥，除GET以外的节点请求需要在 X-Ycache-Secret 请求头中携带，
+	// 否则返回403。所有节点需要使用相同的值。
+	// If blank, requests are not authenticated.
+	Secret string
 }
 
 // NewHttpPool initializes an HTTP pool of peers.
 func NewHTTPPool(self string) *HTTPPool {
-	return &HTTPPool{
-		self:     self,
-		basePath: defaultBasePath,
+	return NewHTTPPoolOpts(self, nil)
+}
+
+// NewHTTPPoolOpts initializes an HTTP pool of peers with the given options.
+func NewHTTPPoolOpts(self string, o *HTTPPoolOptions) *HTTPPool {
+	p := &HTTPPool{self: self}
+	if o != nil {
+		p.opts = *o
 	}
+
+	if p.opts.BasePath == "" {
+		p.opts.BasePath = defaultBasePath
+	}
+
+	if p.opts.Replicas == 0 {
+		p.opts.Replicas = defaultReplicas
+	}
+
+	if p.opts.Selector == nil {
+		p.opts.Selector = func() consistenthash.Selector {
+			return consistenthash.New(p.opts.Replicas, p.opts.HashFn)
+		}
+	}
+
+	if p.opts.HealthCheckTimeout == 0 {
+		p.opts.HealthCheckTimeout = defaultHealthCheckTimeout
+	}
+
+	if p.opts.FailureThreshold == 0 {
+		p.opts.FailureThreshold = defaultFailureThreshold
+	}
+
+	if p.opts.EjectBackoff == 0 {
+		p.opts.EjectBackoff = defaultEjectBackoff
+	}
+
+	if p.opts.MaxEjectBackoff == 0 {
+		p.opts.MaxEjectBackoff = defaultMaxEjectBackoff
+	}
+
+	if p.opts.HandoffRate == 0 {
+		p.opts.HandoffRate = defaultHandoffRate
+	}
+
+	p.basePath = p.opts.BasePath
+	p.peers = p.opts.Selector()
+	p.httpGetters = make(map[string]*httpGetter)
+	p.weights = make(map[string]int)
+	p.health = make(map[string]*peerHealth)
+	p.done = make(chan struct{})
+
+	if p.opts.HealthCheckInterval > 0 {
+		go p.healthCheck()
+	}
+
+	return p
 }
 
 // log info service name
@@ -51,6 +189,43 @@ func (p *HTTPPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	p.Log("%s, %s", r.Method, r.URL.Host+r.URL.Path)
 
+	// 关闭中的节点返回503，请求方会转向其他副本，健康检查也会将其剔除
+	if !p.startServing() {
+		http.Error(w, "shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	defer p.serving.Done()
+
+	// 读取之外的请求会修改缓存或哈希环，需要共享密钥
+	if r.Method != http.MethodGet && !p.authorized(r) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	switch r.URL.Path[len(p.basePath):] {
+	case healthPath:
+		w.Write([]byte("ok"))
+		return
+	case handoffPushPath:
+		p.servePush(w, r)
+		return
+	case generationPath:
+		p.serveGeneration(w, r)
+		return
+	case bumpPath:
+		p.serveBump(w, r)
+		return
+	case invalidatePath:
+		p.serveInvalidate(w, r)
+		return
+	case leavePath:
+		p.serveLeave(w, r)
+		return
+	case joinPath:
+		p.serveJoin(w, r)
+		return
+	}
+
 	// /<basePath>/<groupname>/<key> required
 	parts := strings.SplitN(r.URL.Path[len(p.basePath):], "/", 2)
 	if len(parts) != 2 {
@@ -67,71 +242,575 @@ func (p *HTTPPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	view, err := group.Get(r.Context(), key)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	group.Stats.ServerRequests.Add(1)
+
+	switch r.Method {
+	case http.MethodPut:
+		p.serveSet(w, r, group, key)
 		return
+	case http.MethodDelete:
+		p.serveRemove(w, r, group, key)
+		return
+	}
+
+	// 请求方的generation更大时先采用它，避免返回已经失效的数据
+	if gen, err := strconv.ParseUint(r.URL.Query().Get(generationParam), 10, 64); err == nil {
+		group.observeGeneration(gen)
 	}
 
-	body, err := proto.Marshal(&pb.Response{Value: view.ByteSlice()})
+	if r.URL.Query().Get(peekParam) != "" {
+		view, ok := group.peek(key)
+		if !ok {
+			http.Error(w, "not cached: "+key, http.StatusNotFound)
+			return
+		}
+
+		p.writeProto(w, &pb.Response{Value: view.ByteSlice(), Generation: group.Generation(), Tags: view.Tags(), Expire: unixNano(view.Expire())})
+		return
+	}
+
+	view, err := group.Get(r.Context(), key)
+	if errors.Is(err, ErrNotFound) {
+		// 标记key不存在，与Group不存在等其他404区分
+		w.Header().Set(notFoundHeader, "1")
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/octet-stream")
-	w.Write(body)
+	p.writeProto(w, &pb.Response{Value: view.ByteSlice(), Generation: group.Generation(), Tags: view.Tags(), Expire: unixNano(view.Expire())})
+}
+
+// authorized 判断请求是否携带了正确的共享密钥
+func (p *HTTPPool) authorized(r *http.Request) bool {
+	if p.opts.Secret == "" {
+		return true
+	}
+
+	return subtle.ConstantTimeCompare([]byte(r.Header.Get(secretHeader)), []byte(p.opts.Secret)) == 1
 }
 
 // Set 更新HTTP池节点列表
+// 只增删有变化的节点，保留下来的节点的httpGetter和权重保持不变
 func (p *HTTPPool) Set(peers ...string) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	p.peers = consistenthash.New(defaultReplicas, nil)
-	p.peers.Add(peers...)
-	p.httpGetters = make(map[string]*httpGetter, len(peers))
+
+	keep := make(map[string]bool, len(peers))
 	for _, peer := range peers {
-		p.httpGetters[peer] = &httpGetter{baseURL: peer + p.basePath}
+		keep[peer] = true
 	}
+
+	var removed []string
+	for peer := range p.httpGetters {
+		if !keep[peer] {
+			removed = append(removed, peer)
+		}
+	}
+
+	p.remove(removed...)
+	p.add(peers...)
+}
+
+// Add 向HTTP池中添加节点，已存在的节点会被忽略
+func (p *HTTPPool) Add(peers ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.add(peers...)
+}
+
+// Remove 从HTTP池中移除节点
+func (p *HTTPPool) Remove(peers ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.remove(peers...)
+}
+
+// SetWeight 设置节点的权重，节点不存在时将其加入HTTP池
+// 选择器没有实现 WeightedSelector 时权重会被忽略
+func (p *HTTPPool) SetWeight(peer string, weight int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if weight < 1 {
+		weight = 1
+	}
+	p.weights[peer] = weight
+
+	if _, ok := p.httpGetters[peer]; !ok {
+		p.add(peer)
+		return
+	}
+
+	// 被剔除的节点在重新加入哈希环时使用新的权重
+	if h, ok := p.health[peer]; ok && h.ejected {
+		return
+	}
+
+	p.addToRing(peer)
+	p.startHandoff()
+}
+
+func (p *HTTPPool) add(peers ...string) {
+	changed := false
+	for _, peer := range peers {
+		if _, ok := p.httpGetters[peer]; ok {
+			continue
+		}
+		changed = true
+
+		p.addToRing(peer)
+		p.httpGetters[peer] = &httpGetter{
+			pool:    p,
+			peer:    peer,
+			baseURL: peer + p.basePath,
+		}
+
+		if peer != p.self {
+			p.health[peer] = &peerHealth{}
+		}
+	}
+
+	if changed {
+		p.startHandoff()
+	}
+}
+
+func (p *HTTPPool) remove(peers ...string) {
+	if len(peers) == 0 {
+		return
+	}
+
+	p.peers.Remove(peers...)
+	for _, peer := range peers {
+		delete(p.httpGetters, peer)
+		delete(p.weights, peer)
+		delete(p.health, peer)
+	}
+
+	p.startHandoff()
 }
 
 // PickPeer 根据key选择一个节点
 func (p *HTTPPool) PickPeer(key string) (PeerGetter, bool) {
+	peer, ok := p.pickPeer(key)
+	if ok {
+		p.Log("Pick peer: %s", peer.(*httpGetter).peer)
+	}
+
+	return peer, ok
+}
+
+// pickPeer 与 PickPeer 相同但不输出日志，用于数据移交等需要为大量key选择节点的场景
+func (p *HTTPPool) pickPeer(key string) (PeerGetter, bool) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	if peer := p.peers.Get(key); peer != "" && peer != p.self {
-		p.Log("Pick peer: %s", peer)
+	if peer := p.pick(key); peer != "" && peer != p.self {
 		return p.httpGetters[peer], true
 	}
 
 	return nil, false
 }
 
-var _ PeerPicker = (*HTTPPool)(nil)
+// PickPeers 根据key按优先级选择最多n个节点
+// 选择器没有实现 MultiSelector 时只返回 PickPeer 选出的节点
+func (p *HTTPPool) PickPeers(key string, n int) []PeerGetter {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	first := p.pick(key)
+	if first == "" || first == p.self {
+		return nil
+	}
+
+	getters := []PeerGetter{p.httpGetters[first]}
+	m, ok := p.peers.(consistenthash.MultiSelector)
+	if !ok {
+		return getters
+	}
+
+	// 多取一个，以免有界负载选出的第一个节点不在副本列表中
+	for _, peer := range m.GetN(key, n+1) {
+		if len(getters) >= n || peer == p.self {
+			break
+		}
+
+		if peer != first {
+			getters = append(getters, p.httpGetters[peer])
+		}
+	}
+
+	return getters
+}
+
+// ListPeers 返回除本节点以外的所有节点，包括被剔除的节点
+func (p *HTTPPool) ListPeers() []PeerGetter {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var getters []PeerGetter
+	for peer, g := range p.httpGetters {
+		if peer != p.self {
+			getters = append(getters, g)
+		}
+	}
+
+	return getters
+}
+
+// Getter 返回访问peer的 PeerGetter，peer不必是HTTP池的成员
+func (p *HTTPPool) Getter(peer string) PeerGetter {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if g, ok := p.httpGetters[peer]; ok {
+		return g
+	}
+
+	return &httpGetter{
+		pool:    p,
+		peer:    peer,
+		baseURL: peer + p.basePath,
+	}
+}
+
+// pick 选出负责key的节点，调用方需持有 p.mu
+func (p *HTTPPool) pick(key string) string {
+	if b, ok := p.peers.(consistenthash.BoundedSelector); ok && p.opts.LoadFactor > 0 {
+		return b.GetBounded(key, p.opts.LoadFactor, p.load)
+	}
+
+	return p.peers.Get(key)
+}
+
+// load 返回节点进行中的请求数，本节点不经过httpGetter，使用进行中的本地加载数
+func (p *HTTPPool) load(peer string) int64 {
+	if peer == p.self {
+		return atomic.LoadInt64(&p.inflight)
+	}
+
+	if g, ok := p.httpGetters[peer]; ok {
+		return atomic.LoadInt64(&g.inflight)
+	}
+
+	return 0
+}
+
+// Inflight 返回每个节点进行中的请求数
+func (p *HTTPPool) Inflight() map[string]int64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	inflight := make(map[string]int64, len(p.httpGetters))
+	for peer := range p.httpGetters {
+		inflight[peer] = p.load(peer)
+	}
+
+	return inflight
+}
+
+// Owners 按优先级返回最多n个负责key的节点，可能包括本节点
+// 选择器没有实现 MultiSelector 时只返回负责key的节点
+func (p *HTTPPool) Owners(key string, n int) []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	first := p.pick(key)
+	if first == "" {
+		return nil
+	}
+
+	owners := []string{first}
+	if m, ok := p.peers.(consistenthash.MultiSelector); ok {
+		for _, peer := range m.GetN(key, n+1) {
+			if len(owners) >= n {
+				break
+			}
+			if peer != first {
+				owners = append(owners, peer)
+			}
+		}
+	}
+
+	return owners
+}
+
+// KeyShare 用samples个样本key估计每个节点负责的key的比例，不考虑有界负载
+// 在哈希环的副本上抽样，不阻塞请求的路由
+func (p *HTTPPool) KeyShare(samples int) map[string]float64 {
+	p.mu.Lock()
+	weights := make(map[string]int, len(p.httpGetters))
+	for peer := range p.httpGetters {
+		if h, ok := p.health[peer]; ok && h.ejected {
+			continue
+		}
+		weights[peer] = p.weight(peer)
+	}
+	p.mu.Unlock()
+
+	ring := p.opts.Selector()
+	for peer, weight := range weights {
+		if w, ok := ring.(consistenthash.WeightedSelector); ok {
+			w.AddWeighted(peer, weight)
+			continue
+		}
+		ring.Add(peer)
+	}
+
+	share := make(map[string]float64)
+	for i := 0; i < samples; i++ {
+		if peer := ring.Get("sample-" + strconv.Itoa(i)); peer != "" {
+			share[peer] += 1 / float64(samples)
+		}
+	}
+
+	return share
+}
+
+// trackLocal 记录一次本节点负责的key的本地加载，返回的函数在加载结束时调用
+func (p *HTTPPool) trackLocal() func() {
+	atomic.AddInt64(&p.inflight, 1)
+	return func() { atomic.AddInt64(&p.inflight, -1) }
+}
+
+var (
+	_ PeerPicker    = (*HTTPPool)(nil)
+	_ ReplicaPicker = (*HTTPPool)(nil)
+	_ PeerLister    = (*HTTPPool)(nil)
+	_ loadTracker   = (*HTTPPool)(nil)
+	_ quietPicker   = (*HTTPPool)(nil)
+)
+
+// servePush 接收其他节点移交的数据
+func (p *HTTPPool) servePush(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	req := &pb.PushRequest{}
+	if err := proto.Unmarshal(body, req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	group := GetGroup(req.GetGroup())
+	if group == nil {
+		http.Error(w, "no such group: "+req.GetGroup(), http.StatusNotFound)
+		return
+	}
+
+	p.writeProto(w, &pb.PushResponse{Accepted: group.receivePush(req)})
+}
+
+// serveGeneration 接收其他节点通知的generation
+func (p *HTTPPool) serveGeneration(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	req := &pb.GenerationRequest{}
+	if err := proto.Unmarshal(body, req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	group := GetGroup(req.GetGroup())
+	if group == nil {
+		http.Error(w, "no such group: "+req.GetGroup(), http.StatusNotFound)
+		return
+	}
+
+	group.observeGeneration(req.GetGeneration())
+	p.writeProto(w, &pb.GenerationResponse{Generation: group.Generation()})
+}
+
+// serveBump 作为负责generation的节点，增加其他节点请求的Group的generation
+func (p *HTTPPool) serveBump(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	req := &pb.GenerationRequest{}
+	if err := proto.Unmarshal(body, req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	group := GetGroup(req.GetGroup())
+	if group == nil {
+		http.Error(w, "no such group: "+req.GetGroup(), http.StatusNotFound)
+		return
+	}
+
+	// 不再转发，即使哈希环不一致也不会在节点之间循环
+	group.observeGeneration(req.GetGeneration())
+	gen, err := group.bumpGeneration(r.Context())
+	if err != nil {
+		p.Log("Failed to announce generation %d of group %s: %v", gen, group.name, err)
+	}
+
+	p.writeProto(w, &pb.GenerationResponse{Generation: gen})
+}
+
+// serveInvalidate 删除其他节点通知的标签对应的数据
+func (p *HTTPPool) serveInvalidate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	req := &pb.InvalidateRequest{}
+	if err := proto.Unmarshal(body, req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	group := GetGroup(req.GetGroup())
+	if group == nil {
+		http.Error(w, "no such group: "+req.GetGroup(), http.StatusNotFound)
+		return
+	}
+
+	p.writeProto(w, &pb.InvalidateResponse{Removed: group.invalidateTagLocally(req.GetTag())})
+}
+
+// serveSet 处理其他节点转发的写入
+func (p *HTTPPool) serveSet(w http.ResponseWriter, r *http.Request, group *Group, key string) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	req := &pb.SetRequest{}
+	if err := proto.Unmarshal(body, req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// 请求方已经选择了本节点，不再转发，避免节点的哈希环不一致时请求在节点间来回转发
+	if err := group.setLocally(r.Context(), key, req.GetValue()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	p.writeProto(w, &pb.SetResponse{})
+}
+
+func (p *HTTPPool) serveRemove(w http.ResponseWriter, r *http.Request, group *Group, key string) {
+	// 与 serveSet 相同，不再转发
+	p.writeProto(w, &pb.RemoveResponse{Removed: group.removeLocally(key)})
+}
+
+// writeProto 以protobuf格式返回响应
+func (p *HTTPPool) writeProto(w http.ResponseWriter, m proto.Message) {
+	body, err := proto.Marshal(m)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Write(body)
+}
 
 type httpGetter struct {
-	baseURL string
+	inflight int64 // 进行中的请求数，放在首位保证64位对齐
+	pool     *HTTPPool
+	peer     string
+	baseURL  string
 }
 
 func (h *httpGetter) Get(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	return h.get(ctx, in, out, false)
+}
+
+// Peek 只查询节点的缓存，未命中时返回404
+func (h *httpGetter) Peek(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	return h.get(ctx, in, out, true)
+}
+
+func (h *httpGetter) get(ctx context.Context, in *pb.Request, out *pb.Response, peek bool) error {
+	atomic.AddInt64(&h.inflight, 1)
+	defer atomic.AddInt64(&h.inflight, -1)
+
+	query := url.Values{}
+	if peek {
+		query.Set(peekParam, "1")
+	}
+	if in.GetGeneration() > 0 {
+		query.Set(generationParam, strconv.FormatUint(in.GetGeneration(), 10))
+	}
+
 	u := fmt.Sprintf(
 		"%v%v/%v",
 		h.baseURL,
 		url.QueryEscape(in.GetGroup()),
 		url.QueryEscape(in.GetKey()),
 	)
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
 
-	resp, err := http.Get(u)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
 	if err != nil {
 		return err
 	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		// 调用方取消或超时不代表节点不可用
+		if ctx.Err() == nil {
+			h.pool.reportFailure(h.peer, err)
+		}
+		return err
+	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("server returned: %v", resp.Status)
+		err := &statusError{code: resp.StatusCode, status: resp.Status, notFound: resp.Header.Get(notFoundHeader) != ""}
+		// 只有网关类错误说明节点本身不可用，其余错误(如key不存在)不影响节点的健康状态
+		if err.unavailable() {
+			h.pool.reportFailure(h.peer, err)
+		} else {
+			h.pool.reportSuccess(h.peer)
+		}
+		return err
 	}
 
+	h.pool.reportSuccess(h.peer)
+
 	bytes, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
 		return fmt.Errorf("reading response body: %v", err)
@@ -144,5 +823,132 @@ func (h *httpGetter) Get(ctx context.Context, in *pb.Request, out *pb.Response)
 	return nil
 }
 
-// do what?
-var _ PeerGetter = (*httpGetter)(nil)
+// Push 把数据推送给节点
+func (h *httpGetter) Push(ctx context.Context, in *pb.PushRequest, out *pb.PushResponse) error {
+	return h.send(ctx, http.MethodPost, h.baseURL+handoffPushPath, in, out)
+}
+
+// SetGeneration 通知节点Group新的generation
+func (h *httpGetter) SetGeneration(ctx context.Context, in *pb.GenerationRequest, out *pb.GenerationResponse) error {
+	return h.send(ctx, http.MethodPost, h.baseURL+generationPath, in, out)
+}
+
+// BumpGeneration 请求负责generation的节点增加Group的generation
+func (h *httpGetter) BumpGeneration(ctx context.Context, in *pb.GenerationRequest, out *pb.GenerationResponse) error {
+	return h.send(ctx, http.MethodPost, h.baseURL+bumpPath, in, out)
+}
+
+// InvalidateTag 通知节点删除带有标签的数据
+func (h *httpGetter) InvalidateTag(ctx context.Context, in *pb.InvalidateRequest, out *pb.InvalidateResponse) error {
+	return h.send(ctx, http.MethodPost, h.baseURL+invalidatePath, in, out)
+}
+
+// Set 把写入转发给节点
+func (h *httpGetter) Set(ctx context.Context, in *pb.SetRequest, out *pb.SetResponse) error {
+	u := fmt.Sprintf(
+		"%v%v/%v",
+		h.baseURL,
+		url.QueryEscape(in.GetGroup()),
+		url.QueryEscape(in.GetKey()),
+	)
+
+	return h.send(ctx, http.MethodPut, u, in, out)
+}
+
+// Remove 通知节点删除key的缓存
+func (h *httpGetter) Remove(ctx context.Context, in *pb.Request, out *pb.RemoveResponse) error {
+	u := fmt.Sprintf(
+		"%v%v/%v",
+		h.baseURL,
+		url.QueryEscape(in.GetGroup()),
+		url.QueryEscape(in.GetKey()),
+	)
+
+	return h.send(ctx, http.MethodDelete, u, in, out)
+}
+
+// Leave 通知节点本节点即将离开
+func (h *httpGetter) Leave(ctx context.Context, in *pb.LeaveRequest, out *pb.LeaveResponse) error {
+	return h.send(ctx, http.MethodPost, h.baseURL+leavePath, in, out)
+}
+
+// Join 通知节点本节点离开后重新开始服务，与 Leave 使用相同的消息
+func (h *httpGetter) Join(ctx context.Context, in *pb.LeaveRequest, out *pb.LeaveResponse) error {
+	return h.send(ctx, http.MethodPost, h.baseURL+joinPath, in, out)
+}
+
+// send 以protobuf格式发送请求体并解析响应
+func (h *httpGetter) send(ctx context.Context, method, u string, in, out proto.Message) error {
+	body, err := proto.Marshal(in)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	if secret := h.pool.opts.Secret; secret != "" {
+		req.Header.Set(secretHeader, secret)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return &statusError{code: resp.StatusCode, status: resp.Status}
+	}
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("reading response body: %v", err)
+	}
+
+	if err = proto.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("decoding response body: %v", err)
+	}
+
+	return nil
+}
+
+var (
+	_ PeerGetter       = (*httpGetter)(nil)
+	_ PeerPusher       = (*httpGetter)(nil)
+	_ PeerPeeker       = (*httpGetter)(nil)
+	_ PeerSetter       = (*httpGetter)(nil)
+	_ GenerationSetter = (*httpGetter)(nil)
+	_ GenerationBumper = (*httpGetter)(nil)
+	_ TagInvalidator   = (*httpGetter)(nil)
+	_ PeerRemover      = (*httpGetter)(nil)
+)
+
+// statusError 节点返回了非200的响应
+type statusError struct {
+	code     int
+	status   string
+	notFound bool // 节点回源后确认key不存在
+}
+
+func (e *statusError) Error() string {
+	return "server returned: " + e.status
+}
+
+// Is 使 errors.Is(err, ErrNotFound) 能识别节点返回的key不存在
+func (e *statusError) Is(target error) bool {
+	return target == ErrNotFound && e.notFound
+}
+
+// unavailable 节点是否处于不可用状态
+func (e *statusError) unavailable() bool {
+	switch e.code {
+	case http.StatusTooManyRequests, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,234 @@
+package ycache
+
+import (
+	pb "7days/ycache/ycachepb"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// keyOwnedBy 找到一个由peer负责的key
+func keyOwnedBy(t *testing.T, p *HTTPPool, peer string) string {
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		if g, ok := p.PickPeer(key); ok && g.(*httpGetter).peer == peer {
+			return key
+		}
+	}
+
+	t.Fatalf("no key is owned by %s", peer)
+	return ""
+}
+
+func peerStatus(p *HTTPPool, peer string) PeerStatus {
+	for _, s := range p.Status() {
+		if s.Peer == peer {
+			return s
+		}
+	}
+
+	return PeerStatus{}
+}
+
+func TestPassiveEjection(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "overloaded", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	p := NewHTTPPoolOpts("http://self", &HTTPPoolOptions{
+		FailureThreshold: 2,
+		EjectBackoff:     time.Hour,
+	})
+	p.Set("http://self", srv.URL)
+
+	key := keyOwnedBy(t, p, srv.URL)
+	for i := 0; i < 2; i++ {
+		g, ok := p.PickPeer(key)
+		if !ok {
+			t.Fatalf("peer ejected after %d failures, want 2", i)
+		}
+
+		if err := g.Get(context.Background(), &pb.Request{Group: "g", Key: key}, &pb.Response{}); err == nil {
+			t.Fatal("expected error from unavailable peer")
+		}
+	}
+
+	if _, ok := p.PickPeer(key); ok {
+		t.Fatal("unhealthy peer is still picked")
+	}
+
+	if s := peerStatus(p, srv.URL); s.Healthy || s.Ejections != 1 || s.RetryAt == nil {
+		t.Fatalf("unexpected status of ejected peer: %+v", s)
+	}
+
+	// 被剔除的节点仍然是HTTP池的成员，Set 不会让它提前回到哈希环
+	p.Set("http://self", srv.URL)
+	if _, ok := p.PickPeer(key); ok {
+		t.Fatal("ejected peer is picked after Set")
+	}
+}
+
+func TestHealthCheckReadmission(t *testing.T) {
+	var healthy int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != defaultBasePath+healthPath || atomic.LoadInt32(&healthy) == 0 {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	p := NewHTTPPoolOpts("http://self", &HTTPPoolOptions{
+		HealthCheckInterval: 5 * time.Millisecond,
+		FailureThreshold:    1,
+		EjectBackoff:        20 * time.Millisecond,
+	})
+	defer close(p.done)
+	p.Set("http://self", srv.URL)
+
+	waitFor := func(what string, cond func(PeerStatus) bool) {
+		deadline := time.Now().Add(2 * time.Second)
+		for !cond(peerStatus(p, srv.URL)) {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for peer to be %s: %+v", what, peerStatus(p, srv.URL))
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	waitFor("ejected", func(s PeerStatus) bool { return !s.Healthy })
+
+	atomic.StoreInt32(&healthy, 1)
+	waitFor("readmitted", func(s PeerStatus) bool { return s.Healthy })
+
+	key := keyOwnedBy(t, p, srv.URL)
+	if g, ok := p.PickPeer(key); !ok || g.(*httpGetter).peer != srv.URL {
+		t.Fatal("readmitted peer is not picked")
+	}
+}
+
+func TestSelfLoad(t *testing.T) {
+	p := NewHTTPPoolOpts("http://self", &HTTPPoolOptions{LoadFactor: 0.25})
+	p.Set("http://self", "http://other")
+
+	started, release := make(chan struct{}), make(chan struct{})
+	g := NewGroup("self-load", 1<<10, GetterFunc(func(ctx context.Context, key string) ([]byte, error) {
+		close(started)
+		<-release
+		return []byte(key), nil
+	}))
+	g.RegisterPeers(p)
+
+	key := ""
+	for i := 0; key == ""; i++ {
+		if _, ok := p.PickPeer(fmt.Sprintf("key-%d", i)); !ok {
+			key = fmt.Sprintf("key-%d", i)
+		}
+	}
+
+	done := make(chan error)
+	go func() {
+		_, err := g.Get(context.Background(), key)
+		done <- err
+	}()
+
+	<-started
+	if n := p.Inflight()["http://self"]; n != 1 {
+		t.Fatalf("self has %d loads in flight, want 1", n)
+	}
+
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if n := p.Inflight()["http://self"]; n != 0 {
+		t.Fatalf("self has %d loads in flight after the load, want 0", n)
+	}
+}
+
+func TestPassiveReadmission(t *testing.T) {
+	var healthy int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&healthy) == 0 {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	p := NewHTTPPoolOpts("http://self", &HTTPPoolOptions{
+		FailureThreshold: 1,
+		EjectBackoff:     20 * time.Millisecond,
+	})
+	defer close(p.done)
+	p.Set("http://self", srv.URL)
+
+	key := keyOwnedBy(t, p, srv.URL)
+	g, _ := p.PickPeer(key)
+	if err := g.Get(context.Background(), &pb.Request{Group: "g", Key: key}, &pb.Response{}); err == nil {
+		t.Fatal("expected error from unavailable peer")
+	}
+	if peerStatus(p, srv.URL).Healthy {
+		t.Fatal("peer is not ejected")
+	}
+
+	// 没有主动健康检查，也没有请求发往被剔除的节点，仍然会在退避后探测并重新加入
+	atomic.StoreInt32(&healthy, 1)
+	deadline := time.Now().Add(2 * time.Second)
+	for !peerStatus(p, srv.URL).Healthy {
+		if time.Now().After(deadline) {
+			t.Fatalf("peer is never readmitted: %+v", peerStatus(p, srv.URL))
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestPoolSecret(t *testing.T) {
+	var pool *HTTPPool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { pool.ServeHTTP(w, r) }))
+	defer srv.Close()
+
+	pool = NewHTTPPoolOpts(srv.URL, &HTTPPoolOptions{Secret: "s3cret"})
+	defer close(pool.done)
+	pool.Set(srv.URL, "http://other")
+
+	// 没有密钥的控制请求被拒绝，健康检查不需要密钥
+	resp, err := http.Post(srv.URL+"/_ycache/_leave", "application/octet-stream", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("leave without the secret: %s, want 403", resp.Status)
+	}
+
+	if err := pool.probe(srv.URL); err != nil {
+		t.Fatalf("health check: %v", err)
+	}
+
+	wrong := NewHTTPPoolOpts("http://other", &HTTPPoolOptions{Secret: "wrong"})
+	defer close(wrong.done)
+	err = wrong.Getter(srv.URL).(*httpGetter).Leave(context.Background(), &pb.LeaveRequest{Peer: "http://other"}, &pb.LeaveResponse{})
+	if err == nil {
+		t.Fatal("leave with a wrong secret succeeded")
+	}
+	if s := peerStatus(pool, "http://other"); !s.Healthy {
+		t.Fatal("peer was ejected by a request with a wrong secret")
+	}
+
+	other := NewHTTPPoolOpts("http://other", &HTTPPoolOptions{Secret: "s3cret"})
+	defer close(other.done)
+	if err := other.Getter(srv.URL).(*httpGetter).Leave(context.Background(), &pb.LeaveRequest{Peer: "http://other"}, &pb.LeaveResponse{}); err != nil {
+		t.Fatal(err)
+	}
+	if s := peerStatus(pool, "http://other"); s.Healthy {
+		t.Fatal("peer is still healthy after leaving with the secret")
+	}
+}
@@ -127,6 +127,12 @@ func (c *LRUKCache) temporaryChecking() {
 	if c.temporaryMaxEntires < c.temporary.Len() {
 		ele := c.temporary.Back()
 		c.removeTemporary(ele)
+
+		// 临时表中的数据被淘汰时同样执行回调
+		if c.OnEvicted != nil {
+			kv := ele.Value.(*temporaryCount)
+			c.OnEvicted(kv.key, kv.value)
+		}
 	}
 }
 
@@ -167,3 +173,56 @@ func (c *LRUKCache) Get(key Key) (value interface{}, ok bool) {
 
 	return nil, false
 }
+
+// Promote 把临时表中的元素直接移入缓存表，用于恢复已经确认为热点的数据
+func (c *LRUKCache) Promote(key Key) {
+	ele, ok := c.temporaryHash[key]
+	if !ok {
+		return
+	}
+
+	c.removeTemporary(ele)
+	c.addToCache(key, ele.Value.(*temporaryCount).entry.value)
+}
+
+// Peek 查询缓存表或临时表中的元素，不增加访问次数也不调整顺序
+func (c *LRUKCache) Peek(key Key) (value interface{}, ok bool) {
+	if ele, hit := c.cache[key]; hit {
+		return ele.Value.(*entry).value, true
+	}
+
+	if ele, hit := c.temporaryHash[key]; hit {
+		return ele.Value.(*temporaryCount).entry.value, true
+	}
+
+	return nil, false
+}
+
+// Range 按从热到冷的顺序遍历缓存表中的元素，fn 返回false时停止
+// 临时表中的数据访问次数不足K次，不参与遍历
+func (c *LRUKCache) Range(fn func(key Key, value interface{}) bool) {
+	for ele := c.ll.Front(); ele != nil; ele = ele.Next() {
+		kv := ele.Value.(*entry)
+		if !fn(kv.key, kv.value) {
+			return
+		}
+	}
+}
+
+// Len 返回缓存表与临时表中元素的总数
+func (c *LRUKCache) Len() int {
+	return c.ll.Len() + c.temporary.Len()
+}
+
+// Remove 从缓存表或临时表中删除元素，不执行回调
+func (c *LRUKCache) Remove(key Key) {
+	if ele, ok := c.cache[key]; ok {
+		c.ll.Remove(ele)
+		delete(c.cache, key)
+		return
+	}
+
+	if ele, ok := c.temporaryHash[key]; ok {
+		c.removeTemporary(ele)
+	}
+}
@@ -39,3 +39,82 @@ func TestLRUKGet(t *testing.T) {
 		}
 	}
 }
+
+func TestLRUKRange(t *testing.T) {
+	lruk := NewLRUKCache(10, 1)
+	for _, key := range []string{"a", "b", "c"} {
+		lruk.Add(key, key)
+		lruk.Get(key)
+	}
+
+	// 最近访问的元素最先遍历
+	lruk.Get("b")
+
+	var keys []Key
+	lruk.Range(func(key Key, value interface{}) bool {
+		keys = append(keys, key)
+		return len(keys) < 2
+	})
+
+	if len(keys) != 2 || keys[0] != "b" {
+		t.Fatalf("Range visited %v, want b first and stop after 2 keys", keys)
+	}
+}
+
+func TestLRUKRemove(t *testing.T) {
+	var evicted []Key
+	lruk := NewLRUKCache(10, 2)
+	lruk.OnEvicted = func(key Key, value interface{}) {
+		evicted = append(evicted, key)
+	}
+
+	// hot 进入缓存表，cold 留在临时表
+	lruk.Add("hot", "1")
+	lruk.Get("hot")
+	lruk.Get("hot")
+	lruk.Add("cold", "2")
+	if n := lruk.Len(); n != 2 {
+		t.Fatalf("Len = %d, want 2", n)
+	}
+
+	lruk.Remove("hot")
+	lruk.Remove("cold")
+
+	for _, key := range []string{"hot", "cold"} {
+		if _, ok := lruk.Get(key); ok {
+			t.Fatalf("%s found after Remove", key)
+		}
+	}
+
+	if len(evicted) != 0 {
+		t.Fatalf("Remove called OnEvicted for %v", evicted)
+	}
+}
+
+func TestLRUKPeek(t *testing.T) {
+	var evicted []Key
+	lruk := NewLRUKCache(1, 2)
+	lruk.OnEvicted = func(key Key, val interface{}) {
+		evicted = append(evicted, key)
+	}
+
+	lruk.Add("hot", 1)
+	lruk.Get("hot")
+	lruk.Get("hot")
+	lruk.Add("cold", 2)
+
+	// Peek 不会让临时表中的数据进入缓存表，也就不会淘汰缓存表中的数据
+	for i := 0; i < 3; i++ {
+		if val, ok := lruk.Peek("cold"); !ok || val != 2 {
+			t.Fatalf("Peek(cold) = %v, %v; want 2, true", val, ok)
+		}
+	}
+
+	if len(evicted) != 0 {
+		t.Fatalf("Peek evicted %v", evicted)
+	}
+
+	if _, ok := lruk.Peek("missing"); ok {
+		t.Fatal("Peek returned a missing key")
+	}
+}
@@ -0,0 +1,349 @@
+// Package memcache 实现 memcached 文本协议的前端，让使用 memcached 客户端的服务无需修改即可访问 ycache
+//
+// 支持的命令：
+//
+//	get <key>*           读取一个或多个key
+//	gets <key>*          同 get，额外返回 cas unique
+//	delete <key> [noreply]  删除key的缓存，不影响后端存储
+//	stats                统计信息
+//	version
+//	quit
+//
+// key 形如 "group:key" 且 group 存在时访问该Group，否则访问 Options.Group。
+// Getter 返回错误时当作未命中处理，与 memcached 客户端对缓存未命中的预期一致。
+package memcache
+
+import (
+	"7days/ycache"
+	"7days/ycache/tcpserver"
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 默认配置
+const (
+	defaultTimeout = 5 * time.Second
+	maxKeyLen      = 250  // memcached 允许的最大key长度
+	maxLineLen     = 2048 // 命令行的最大长度
+	version        = "ycache"
+)
+
+// ErrServerClosed Server 已经关闭
+var ErrServerClosed = errors.New("memcache: server closed")
+
+// Options are the configurations of a Server.
+type Options struct {
+	// Group 没有 "group:" 前缀的key所属的Group。
+	// If blank, every key must be written as "group:key".
+	Group string
+
+	// Timeout 每条命令的超时时间。
+	// If blank, it defaults to 5s.
+	Timeout time.Duration
+}
+
+// Stats 统计信息，字段与 memcached 的 stats 命令对应
+type Stats struct {
+	CurrConnections  int64
+	TotalConnections int64
+	CmdGet           int64 // 请求的key数
+	GetHits          int64
+	GetMisses        int64
+	DeleteHits       int64
+	DeleteMisses     int64
+}
+
+// Server memcached 文本协议的服务端
+type Server struct {
+	opts    Options
+	started time.Time
+	stats   Stats // 通过原子操作读写，连接数由 tcp 记录
+	tcp     *tcpserver.Server
+}
+
+// NewServer 创建服务端
+func NewServer(o *Options) *Server {
+	s := &Server{started: time.Now()}
+	s.tcp = tcpserver.New(s.serveConn, ErrServerClosed)
+	if o != nil {
+		s.opts = *o
+	}
+
+	if s.opts.Timeout == 0 {
+		s.opts.Timeout = defaultTimeout
+	}
+
+	return s
+}
+
+// ListenAndServe 监听TCP地址addr并处理连接
+func (s *Server) ListenAndServe(addr string) error {
+	return s.tcp.ListenAndServe(addr)
+}
+
+// Serve 接受ln上的连接并处理，直到 Close 被调用
+func (s *Server) Serve(ln net.Listener) error {
+	return s.tcp.Serve(ln)
+}
+
+// Close 关闭所有监听与连接
+func (s *Server) Close() error {
+	return s.tcp.Close()
+}
+
+// Stats 返回统计信息
+func (s *Server) Stats() Stats {
+	return Stats{
+		CurrConnections:  s.tcp.Conns(),
+		TotalConnections: s.tcp.Total(),
+		CmdGet:           atomic.LoadInt64(&s.stats.CmdGet),
+		GetHits:          atomic.LoadInt64(&s.stats.GetHits),
+		GetMisses:        atomic.LoadInt64(&s.stats.GetMisses),
+		DeleteHits:       atomic.LoadInt64(&s.stats.DeleteHits),
+		DeleteMisses:     atomic.LoadInt64(&s.stats.DeleteMisses),
+	}
+}
+
+// serveConn 依次处理连接上的命令
+func (s *Server) serveConn(conn net.Conn) {
+	r := bufio.NewReaderSize(conn, maxLineLen)
+	w := bufio.NewWriter(conn)
+
+	for {
+		line, err := readLine(r)
+		if err == errLineTooLong {
+			w.WriteString("CLIENT_ERROR line too long\r\n")
+			w.Flush()
+			return
+		}
+		if err != nil {
+			if err != io.EOF {
+				log.Println("[memcache] Failed to read command:", err)
+			}
+			return
+		}
+
+		if !s.handle(w, strings.Fields(line)) {
+			w.Flush()
+			return
+		}
+
+		if err := w.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// handle 执行一条命令，返回false时关闭连接
+func (s *Server) handle(w *bufio.Writer, args []string) bool {
+	if len(args) == 0 {
+		w.WriteString("ERROR\r\n")
+		return true
+	}
+
+	switch args[0] {
+	case "get":
+		s.get(w, args[1:], false)
+	case "gets":
+		s.get(w, args[1:], true)
+	case "delete":
+		s.delete(w, args[1:])
+	case "stats":
+		s.writeStats(w)
+	case "version":
+		w.WriteString("VERSION " + version + "\r\n")
+	case "quit":
+		return false
+	default:
+		w.WriteString("ERROR\r\n")
+	}
+
+	return true
+}
+
+func (s *Server) get(w *bufio.Writer, keys []string, cas bool) {
+	if len(keys) == 0 || !validKeys(keys) {
+		w.WriteString("CLIENT_ERROR bad command line format\r\n")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.opts.Timeout)
+	defer cancel()
+
+	// 并发读取所有key，按请求的顺序返回
+	values := make([]ycache.ByteView, len(keys))
+	hits := make([]bool, len(keys))
+
+	var wg sync.WaitGroup
+	for i, key := range keys {
+		wg.Add(1)
+		go func(i int, key string) {
+			defer wg.Done()
+
+			g, k := s.resolve(key)
+			if g == nil {
+				return
+			}
+
+			if v, err := g.Get(ctx, k); err == nil {
+				values[i], hits[i] = v, true
+			}
+		}(i, key)
+	}
+	wg.Wait()
+
+	atomic.AddInt64(&s.stats.CmdGet, int64(len(keys)))
+	for i, key := range keys {
+		if !hits[i] {
+			atomic.AddInt64(&s.stats.GetMisses, 1)
+			continue
+		}
+		atomic.AddInt64(&s.stats.GetHits, 1)
+
+		data := values[i].ByteSlice()
+		if cas {
+			fmt.Fprintf(w, "VALUE %s 0 %d %d\r\n", key, len(data), casUnique(data))
+		} else {
+			fmt.Fprintf(w, "VALUE %s 0 %d\r\n", key, len(data))
+		}
+		w.Write(data)
+		w.WriteString("\r\n")
+	}
+
+	w.WriteString("END\r\n")
+}
+
+func (s *Server) delete(w *bufio.Writer, args []string) {
+	noreply := len(args) > 1 && args[len(args)-1] == "noreply"
+	if noreply {
+		args = args[:len(args)-1]
+	}
+
+	// 兼容旧版本客户端发送的 "delete <key> 0"
+	if len(args) == 2 && args[1] == "0" {
+		args = args[:1]
+	}
+
+	if len(args) != 1 || !validKeys(args) {
+		w.WriteString("CLIENT_ERROR bad command line format\r\n")
+		return
+	}
+
+	reply := func(msg string) {
+		if !noreply {
+			w.WriteString(msg + "\r\n")
+		}
+	}
+
+	g, k := s.resolve(args[0])
+	if g == nil {
+		atomic.AddInt64(&s.stats.DeleteMisses, 1)
+		reply("NOT_FOUND")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.opts.Timeout)
+	defer cancel()
+
+	removed, err := g.Remove(ctx, k)
+	if err != nil {
+		reply("SERVER_ERROR " + err.Error())
+		return
+	}
+
+	if !removed {
+		atomic.AddInt64(&s.stats.DeleteMisses, 1)
+		reply("NOT_FOUND")
+		return
+	}
+
+	atomic.AddInt64(&s.stats.DeleteHits, 1)
+	reply("DELETED")
+}
+
+func (s *Server) writeStats(w *bufio.Writer) {
+	st := s.Stats()
+	now := time.Now()
+
+	stat := func(name string, v interface{}) {
+		fmt.Fprintf(w, "STAT %s %v\r\n", name, v)
+	}
+
+	stat("pid", os.Getpid())
+	stat("uptime", int64(now.Sub(s.started).Seconds()))
+	stat("time", now.Unix())
+	stat("version", version)
+	stat("curr_connections", st.CurrConnections)
+	stat("total_connections", st.TotalConnections)
+	stat("cmd_get", st.CmdGet)
+	stat("get_hits", st.GetHits)
+	stat("get_misses", st.GetMisses)
+	stat("delete_hits", st.DeleteHits)
+	stat("delete_misses", st.DeleteMisses)
+	w.WriteString("END\r\n")
+}
+
+// resolve 返回key所属的Group以及Group中的key，找不到Group时返回nil
+func (s *Server) resolve(key string) (*ycache.Group, string) {
+	if i := strings.IndexByte(key, ':'); i > 0 {
+		if g := ycache.GetGroup(key[:i]); g != nil {
+			return g, key[i+1:]
+		}
+	}
+
+	if s.opts.Group == "" {
+		return nil, ""
+	}
+
+	return ycache.GetGroup(s.opts.Group), key
+}
+
+var errLineTooLong = errors.New("memcache: line too long")
+
+// readLine 读取以 \r\n 或 \n 结尾的一行
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		return "", errLineTooLong
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(string(line), "\r\n"), nil
+}
+
+// validKeys key的长度不超过250字节且不包含控制字符
+func validKeys(keys []string) bool {
+	for _, key := range keys {
+		if len(key) > maxKeyLen {
+			return false
+		}
+
+		for i := 0; i < len(key); i++ {
+			if key[i] <= ' ' || key[i] == 0x7f {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// casUnique 根据值计算 gets 返回的 cas unique，值不变时结果不变
+func casUnique(data []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(data)
+	return h.Sum64()
+}
@@ -0,0 +1,126 @@
+package memcache
+
+import (
+	"7days/ycache"
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+)
+
+func startServer(t *testing.T, o *Options) (*bufio.ReadWriter, *Server) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewServer(o)
+	go s.Serve(ln)
+	t.Cleanup(func() { s.Close() })
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn)), s
+}
+
+// roundTrip 发送命令并读取响应，直到读到以end开头的行
+func roundTrip(t *testing.T, rw *bufio.ReadWriter, cmd, end string) string {
+	rw.WriteString(cmd + "\r\n")
+	rw.Flush()
+
+	var b strings.Builder
+	for {
+		line, err := rw.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		b.WriteString(line)
+		if strings.HasPrefix(line, end) {
+			return b.String()
+		}
+	}
+}
+
+func newGroup(name string) *ycache.Group {
+	return ycache.NewGroup(name, 2<<10, ycache.GetterFunc(func(ctx context.Context, key string) ([]byte, error) {
+		if key == "missing" {
+			return nil, fmt.Errorf("%s not exist", key)
+		}
+		return []byte(name + "/" + key), nil
+	}))
+}
+
+func TestGet(t *testing.T) {
+	newGroup("mc-default")
+	newGroup("mc-other")
+	rw, s := startServer(t, &Options{Group: "mc-default"})
+
+	got := roundTrip(t, rw, "get a missing mc-other:b", "END")
+	want := "VALUE a 0 12\r\nmc-default/a\r\nVALUE mc-other:b 0 10\r\nmc-other/b\r\nEND\r\n"
+	if got != want {
+		t.Fatalf("get = %q, want %q", got, want)
+	}
+
+	got = roundTrip(t, rw, "gets a", "END")
+	want = fmt.Sprintf("VALUE a 0 12 %d\r\nmc-default/a\r\nEND\r\n", casUnique([]byte("mc-default/a")))
+	if got != want {
+		t.Fatalf("gets = %q, want %q", got, want)
+	}
+
+	if st := s.Stats(); st.CmdGet != 4 || st.GetHits != 3 || st.GetMisses != 1 {
+		t.Fatalf("stats = %+v", st)
+	}
+
+	if got := roundTrip(t, rw, "get", "CLIENT_ERROR"); got != "CLIENT_ERROR bad command line format\r\n" {
+		t.Fatalf("get without key = %q", got)
+	}
+
+	if got := roundTrip(t, rw, "set a 0 0 1", "ERROR"); got != "ERROR\r\n" {
+		t.Fatalf("set = %q", got)
+	}
+}
+
+func TestNoDefaultGroup(t *testing.T) {
+	newGroup("mc-prefixed")
+	rw, _ := startServer(t, nil)
+
+	if got := roundTrip(t, rw, "get a mc-prefixed:a", "END"); got != "VALUE mc-prefixed:a 0 13\r\nmc-prefixed/a\r\nEND\r\n" {
+		t.Fatalf("get = %q", got)
+	}
+}
+
+func TestDelete(t *testing.T) {
+	newGroup("mc-delete")
+	rw, s := startServer(t, &Options{Group: "mc-delete"})
+
+	roundTrip(t, rw, "get a", "END")
+	if got := roundTrip(t, rw, "delete a", "DELETED"); got != "DELETED\r\n" {
+		t.Fatalf("delete = %q", got)
+	}
+
+	if got := roundTrip(t, rw, "delete a", "NOT_FOUND"); got != "NOT_FOUND\r\n" {
+		t.Fatalf("second delete = %q", got)
+	}
+
+	// noreply 不返回响应，下一条命令的响应紧随其后
+	roundTrip(t, rw, "get b", "END")
+	if got := roundTrip(t, rw, "delete b noreply\r\nversion", "VERSION"); got != "VERSION ycache\r\n" {
+		t.Fatalf("delete noreply = %q", got)
+	}
+
+	if st := s.Stats(); st.DeleteHits != 2 || st.DeleteMisses != 1 {
+		t.Fatalf("stats = %+v", st)
+	}
+
+	got := roundTrip(t, rw, "stats", "END")
+	if !strings.Contains(got, "STAT delete_hits 2\r\n") || !strings.Contains(got, "STAT curr_connections 1\r\n") {
+		t.Fatalf("stats = %q", got)
+	}
+}
@@ -0,0 +1,248 @@
+package ycache
+
+import (
+	"7days/ycache/consistenthash"
+	pb "7days/ycache/ycachepb"
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrMigrating 上一次迁移尚未结束
+var ErrMigrating = errors.New("ycache: migration already in progress")
+
+// MigrationPicker 集群扩缩容期间同时持有新旧两个哈希环的 PeerPicker。
+// 请求按新的哈希环路由；新的负责节点未命中时，先查询旧哈希环上负责节点的缓存，之后才回源。
+//
+//	m := NewMigrationPicker(self, pool.Getter, nil)
+//	m.Set(oldPeers...)
+//	group.RegisterPeers(m)
+//
+//	m.Start(newPeers...) // 开始迁移
+//	m.Status()           // 观察旧节点命中的请求数
+//	m.Finish()           // 结束迁移，丢弃旧的哈希环
+type MigrationPicker struct {
+	fallbacks    int64 // 查询旧节点的次数，放在最前面以保证原子操作的对齐
+	fallbackHits int64 // 由旧节点返回结果的次数
+
+	self   string
+	getter func(peer string) PeerGetter
+	opts   MigrationOptions
+
+	mu        sync.RWMutex
+	current   *consistenthash.Map
+	old       *consistenthash.Map // 不在迁移时为nil
+	peers     []string
+	oldPeers  []string
+	getters   map[string]PeerGetter
+	startedAt time.Time
+}
+
+// MigrationOptions are the configurations of a MigrationPicker.
+type MigrationOptions struct {
+	// Replicas specifies the number of key replicas on the consistent hash.
+	// If blank, it defaults to 50.
+	Replicas int
+
+	// HashFn specifies the hash function of the consistent hash.
+	// If blank, it defaults to crc32.ChecksumIEEE.
+	HashFn consistenthash.Hash
+}
+
+// MigrationStatus 迁移的进度
+type MigrationStatus struct {
+	Migrating    bool       `json:"migrating"`
+	StartedAt    *time.Time `json:"started_at,omitempty"`
+	Peers        []string   `json:"peers"`
+	OldPeers     []string   `json:"old_peers,omitempty"`
+	Fallbacks    int64      `json:"fallbacks"`
+	FallbackHits int64      `json:"fallback_hits"`
+}
+
+// NewMigrationPicker 创建 MigrationPicker，getter 返回访问节点的 PeerGetter，
+// 需要实现 PeerPeeker 才能在迁移期间查询旧节点，例如 HTTPPool.Getter
+func NewMigrationPicker(self string, getter func(peer string) PeerGetter, o *MigrationOptions) *MigrationPicker {
+	m := &MigrationPicker{
+		self:    self,
+		getter:  getter,
+		getters: make(map[string]PeerGetter),
+	}
+	if o != nil {
+		m.opts = *o
+	}
+
+	if m.opts.Replicas == 0 {
+		m.opts.Replicas = defaultReplicas
+	}
+
+	m.current = m.ring()
+	return m
+}
+
+func (m *MigrationPicker) ring(peers ...string) *consistenthash.Map {
+	r := consistenthash.New(m.opts.Replicas, m.opts.HashFn)
+	r.Add(peers...)
+	return r
+}
+
+// Unwrap 返回 getter 所属的 HTTPPool，getter 不是 HTTPPool.Getter 时返回nil
+func (m *MigrationPicker) Unwrap() PeerPicker {
+	if g, ok := m.getter(m.self).(*httpGetter); ok {
+		return g.pool
+	}
+
+	return nil
+}
+
+// Set 直接替换节点列表，不经过迁移
+func (m *MigrationPicker) Set(peers ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.current = m.ring(peers...)
+	m.peers = append([]string(nil), peers...)
+	m.refreshGetters()
+}
+
+// Start 开始迁移到新的节点列表，迁移期间保留当前的哈希环用于查询旧节点
+func (m *MigrationPicker) Start(peers ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.old != nil {
+		return ErrMigrating
+	}
+
+	m.old, m.oldPeers = m.current, m.peers
+	m.current = m.ring(peers...)
+	m.peers = append([]string(nil), peers...)
+	m.startedAt = time.Now()
+	atomic.StoreInt64(&m.fallbacks, 0)
+	atomic.StoreInt64(&m.fallbackHits, 0)
+	m.refreshGetters()
+
+	return nil
+}
+
+// Finish 结束迁移，丢弃旧的哈希环
+func (m *MigrationPicker) Finish() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.old, m.oldPeers = nil, nil
+	m.startedAt = time.Time{}
+	m.refreshGetters()
+}
+
+// refreshGetters 只保留新旧哈希环上节点的 PeerGetter，调用方需持有 m.mu
+func (m *MigrationPicker) refreshGetters() {
+	getters := make(map[string]PeerGetter)
+	for _, peers := range [][]string{m.peers, m.oldPeers} {
+		for _, peer := range peers {
+			if g, ok := m.getters[peer]; ok {
+				getters[peer] = g
+			} else if _, ok := getters[peer]; !ok {
+				getters[peer] = m.getter(peer)
+			}
+		}
+	}
+
+	m.getters = getters
+}
+
+// Status 返回迁移的进度
+func (m *MigrationPicker) Status() MigrationStatus {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	s := MigrationStatus{
+		Migrating:    m.old != nil,
+		Peers:        append([]string(nil), m.peers...),
+		OldPeers:     append([]string(nil), m.oldPeers...),
+		Fallbacks:    atomic.LoadInt64(&m.fallbacks),
+		FallbackHits: atomic.LoadInt64(&m.fallbackHits),
+	}
+
+	if s.Migrating {
+		startedAt := m.startedAt
+		s.StartedAt = &startedAt
+	}
+
+	return s
+}
+
+// PickPeer 根据新的哈希环选择节点
+func (m *MigrationPicker) PickPeer(key string) (PeerGetter, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if peer := m.current.Get(key); peer != "" && peer != m.self {
+		return m.getters[peer], true
+	}
+
+	return nil, false
+}
+
+// ListPeers 返回新旧哈希环上除本节点以外的所有节点
+func (m *MigrationPicker) ListPeers() []PeerGetter {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var getters []PeerGetter
+	for peer, g := range m.getters {
+		if peer != m.self {
+			getters = append(getters, g)
+		}
+	}
+
+	return getters
+}
+
+// PickFallback 迁移期间返回key在旧哈希环上的负责节点
+func (m *MigrationPicker) PickFallback(key string) (PeerPeeker, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.old == nil {
+		return nil, false
+	}
+
+	// 负责节点没有变化，或者旧的负责节点就是本节点时，没有其他缓存可查
+	peer := m.old.Get(key)
+	if peer == "" || peer == m.self || peer == m.current.Get(key) {
+		return nil, false
+	}
+
+	p, ok := m.getters[peer].(PeerPeeker)
+	if !ok {
+		return nil, false
+	}
+
+	return &fallbackPeer{m: m, peer: p}, true
+}
+
+// fallbackPeer 统计旧节点的命中情况
+type fallbackPeer struct {
+	m    *MigrationPicker
+	peer PeerPeeker
+}
+
+func (f *fallbackPeer) Peek(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	atomic.AddInt64(&f.m.fallbacks, 1)
+
+	if err := f.peer.Peek(ctx, in, out); err != nil {
+		return err
+	}
+
+	atomic.AddInt64(&f.m.fallbackHits, 1)
+	return nil
+}
+
+var (
+	_ PeerPicker     = (*MigrationPicker)(nil)
+	_ FallbackPicker = (*MigrationPicker)(nil)
+	_ PeerLister     = (*MigrationPicker)(nil)
+	_ pickerWrapper  = (*MigrationPicker)(nil)
+)
@@ -0,0 +1,136 @@
+package ycache
+
+import (
+	pb "7days/ycache/ycachepb"
+	"context"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// fakeOwner 只在缓存中存放了部分key的节点
+type fakeOwner struct {
+	fakePeer
+	peeks  int32
+	cached map[string]string
+}
+
+func (f *fakeOwner) Peek(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	atomic.AddInt32(&f.peeks, 1)
+
+	v, ok := f.cached[in.GetKey()]
+	if !ok {
+		return errors.New("not cached")
+	}
+
+	out.Value = []byte(v)
+	return nil
+}
+
+// keyMovedTo 找到一个迁移前由from负责、迁移后由to负责的key
+func keyMovedTo(t *testing.T, before, after *MigrationPicker, from, to string) string {
+	for i := 0; i < 10000; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		if before.current.Get(key) == from && after.current.Get(key) == to {
+			return key
+		}
+	}
+
+	t.Fatalf("no key moved from %s to %s", from, to)
+	return ""
+}
+
+func TestMigrationFallback(t *testing.T) {
+	old := &fakeOwner{cached: make(map[string]string)}
+	getter := func(peer string) PeerGetter {
+		if peer == "old" {
+			return old
+		}
+		return &fakePeer{value: "remote"}
+	}
+
+	var loads int32
+	g := NewGroup("migration", 2<<10, GetterFunc(func(ctx context.Context, key string) ([]byte, error) {
+		atomic.AddInt32(&loads, 1)
+		return []byte("origin"), nil
+	}))
+
+	m := NewMigrationPicker("self", getter, nil)
+	m.Set("old")
+	g.RegisterPeers(m)
+
+	after := NewMigrationPicker("self", getter, nil)
+	after.Set("old", "self")
+	hit := keyMovedTo(t, m, after, "old", "self")
+	old.cached[hit] = "cached"
+
+	if err := m.Start("old", "self"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.Start("self"); err != ErrMigrating {
+		t.Fatalf("second Start returned %v, want ErrMigrating", err)
+	}
+
+	// 旧节点命中时不回源
+	if view, err := g.Get(context.Background(), hit); err != nil || view.String() != "cached" {
+		t.Fatalf("want value from old owner, got %q, %v", view.String(), err)
+	}
+
+	// 旧节点未命中时回源
+	var miss string
+	for i := 0; ; i++ {
+		miss = fmt.Sprintf("miss-%d", i)
+		if _, ok := m.PickFallback(miss); ok {
+			break
+		}
+	}
+
+	if view, err := g.Get(context.Background(), miss); err != nil || view.String() != "origin" {
+		t.Fatalf("want value from origin, got %q, %v", view.String(), err)
+	}
+
+	if loads != 1 {
+		t.Fatalf("origin loaded %d times, want 1", loads)
+	}
+
+	s := m.Status()
+	if !s.Migrating || s.StartedAt == nil || s.Fallbacks != 2 || s.FallbackHits != 1 {
+		t.Fatalf("unexpected status during migration: %+v", s)
+	}
+
+	// 结束迁移后不再查询旧节点
+	m.Finish()
+	if _, ok := m.PickFallback(hit); ok {
+		t.Fatal("fallback picked after Finish")
+	}
+
+	if s := m.Status(); s.Migrating || len(s.OldPeers) != 0 {
+		t.Fatalf("unexpected status after migration: %+v", s)
+	}
+}
+
+func TestHTTPPeek(t *testing.T) {
+	g := NewGroup("peek", 2<<10, GetterFunc(func(ctx context.Context, key string) ([]byte, error) {
+		return []byte("origin"), nil
+	}))
+	g.populateCache("cached", ByteView{data: []byte("value")})
+
+	p := NewHTTPPool("http://self")
+	srv := httptest.NewServer(p)
+	defer srv.Close()
+
+	peeker := p.Getter(srv.URL).(PeerPeeker)
+
+	out := &pb.Response{}
+	if err := peeker.Peek(context.Background(), &pb.Request{Group: "peek", Key: "cached"}, out); err != nil || string(out.Value) != "value" {
+		t.Fatalf("want cached value, got %q, %v", out.Value, err)
+	}
+
+	// 未命中时不回源
+	if err := peeker.Peek(context.Background(), &pb.Request{Group: "peek", Key: "missing"}, &pb.Response{}); err == nil {
+		t.Fatal("expected error when peeking an uncached key")
+	}
+}
@@ -12,8 +12,78 @@ type PeerPicker interface {
 	PickPeer(key string) (peer PeerGetter, ok bool)
 }
 
+// ReplicaPicker 可选接口，按优先级返回负责key的多个节点。
+// 第一个节点与 PickPeer 的结果相同，之后的节点作为重试时的副本；
+// 当本节点出现在列表中时列表在此截止，剩下的工作由本地加载完成。
+type ReplicaPicker interface {
+	PickPeers(key string, n int) []PeerGetter
+}
+
+// quietPicker 可选接口，与 PickPeer 相同但不输出日志
+type quietPicker interface {
+	pickPeer(key string) (peer PeerGetter, ok bool)
+}
+
+// loadTracker 可选接口，记录本节点进行中的本地加载。
+// 有界负载模式下本节点的负载与其他节点一样参与计算。
+type loadTracker interface {
+	trackLocal() (done func())
+}
+
+// pickerWrapper 可选接口，包装了其他 PeerPicker 的 PeerPicker 返回被包装的 PeerPicker，
+// 节点变化时HTTP池据此找到需要移交数据的Group
+type pickerWrapper interface {
+	Unwrap() PeerPicker
+}
+
 // PeerGetter is the interface that must be implemented by a peer.
 type PeerGetter interface {
 	Get(ctx context.Context, in *pb.Request, out *pb.Response) error
 	//Get(ctx context.Context, group string, key string) ([]byte, error)
 }
+
+// PeerPusher 可选接口，节点变化后用于把数据移交给新的负责节点
+type PeerPusher interface {
+	Push(ctx context.Context, in *pb.PushRequest, out *pb.PushResponse) error
+}
+
+// PeerPeeker 可选接口，只查询节点的缓存，未命中时不回源
+type PeerPeeker interface {
+	Peek(ctx context.Context, in *pb.Request, out *pb.Response) error
+}
+
+// FallbackPicker 可选接口，返回key在迁移前的负责节点。
+// 本节点负责的key未命中时，先查询旧节点的缓存，之后才回源。
+type FallbackPicker interface {
+	PickFallback(key string) (peer PeerPeeker, ok bool)
+}
+
+// PeerSetter 可选接口，把写入转发给负责key的节点
+type PeerSetter interface {
+	Set(ctx context.Context, in *pb.SetRequest, out *pb.SetResponse) error
+}
+
+// PeerRemover 可选接口，通知负责key的节点删除缓存
+type PeerRemover interface {
+	Remove(ctx context.Context, in *pb.Request, out *pb.RemoveResponse) error
+}
+
+// PeerLister 可选接口，返回所有远程节点
+type PeerLister interface {
+	ListPeers() []PeerGetter
+}
+
+// GenerationSetter 可选接口，通知节点Group新的generation
+type GenerationSetter interface {
+	SetGeneration(ctx context.Context, in *pb.GenerationRequest, out *pb.GenerationResponse) error
+}
+
+// GenerationBumper 可选接口，请求负责generation的节点增加Group的generation
+type GenerationBumper interface {
+	BumpGeneration(ctx context.Context, in *pb.GenerationRequest, out *pb.GenerationResponse) error
+}
+
+// TagInvalidator 可选接口，通知节点删除带有标签的数据
+type TagInvalidator interface {
+	InvalidateTag(ctx context.Context, in *pb.InvalidateRequest, out *pb.InvalidateResponse) error
+}
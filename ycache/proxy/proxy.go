@@ -0,0 +1,447 @@
+// Package proxy 让 ycache 作为上游HTTP源站前面的缓存反向代理
+//
+// Proxy 既是 ycache.Getter：key 由请求的URI与 Options.KeyHeaders 中的请求头组成，
+// 加载时向源站发送GET请求，把响应的状态码、Options.Headers 中的响应头以及响应体作为数据；
+// 也通过 Handler 提供HTTP服务：GET/HEAD 请求从 Group 中读取，其余请求直接转发给源站。
+//
+// 响应按 Cache-Control 决定能否缓存以及缓存多久：
+//   - no-store、no-cache、max-age=0 的响应不缓存，但仍返回给合并的并发请求
+//   - private 或带有 Set-Cookie 的响应不在请求间共享，直接转发给源站
+//   - 有效期依次取 s-maxage、max-age、Expires，都没有时使用 Options.DefaultTTL
+//   - Vary: * 或 Vary 中包含不在 Options.KeyHeaders 中的请求头时不缓存
+package proxy
+
+import (
+	"7days/ycache"
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 默认配置
+const (
+	defaultMaxBodyBytes = 10 << 20
+	defaultTimeout      = 30 * time.Second
+)
+
+// passHeader 标记无法经过缓存的响应，值为原因，Handler 读到这样的数据时把请求直接转发给源站
+const passHeader = "X-Ycache-Pass"
+
+// defaultHeaders 默认保留的响应头
+var defaultHeaders = []string{
+	"Cache-Control",
+	"Content-Disposition",
+	"Content-Encoding",
+	"Content-Language",
+	"Content-Type",
+	"ETag",
+	"Expires",
+	"Last-Modified",
+	"Location",
+	"Vary",
+}
+
+// cacheableStatus 可以缓存的状态码，见 RFC 7231 6.1
+var cacheableStatus = map[int]bool{
+	http.StatusOK:                   true,
+	http.StatusNonAuthoritativeInfo: true,
+	http.StatusNoContent:            true,
+	http.StatusMultipleChoices:      true,
+	http.StatusMovedPermanently:     true,
+	http.StatusNotFound:             true,
+	http.StatusMethodNotAllowed:     true,
+	http.StatusGone:                 true,
+	http.StatusRequestURITooLong:    true,
+	http.StatusNotImplemented:       true,
+}
+
+var (
+	// ErrPrivate 源站的响应只属于单个用户，不能在请求间共享
+	ErrPrivate = errors.New("proxy: private response")
+	// ErrTooLarge 源站的响应体超过了 Options.MaxBodyBytes
+	ErrTooLarge = errors.New("proxy: response body too large")
+)
+
+// Options are the configurations of a Proxy.
+type Options struct {
+	// KeyHeaders 参与组成key的请求头，同时也是转发给源站的全部请求头，
+	// 源站的响应按 Vary 依赖这些请求头时才会被缓存。
+	// If blank, the key is the request URI only.
+	KeyHeaders []string
+
+	// Headers 缓存并返回的源站响应头，Date 总是保留。
+	// If blank, it defaults to Cache-Control, Content-Type, ETag,
+	// Last-Modified and the other representation headers.
+	Headers []string
+
+	// DefaultTTL 源站没有给出有效期时的缓存时间。
+	// If blank, such responses are not cached.
+	DefaultTTL time.Duration
+
+	// MaxBodyBytes 可以缓存的最大响应体，更大的响应直接转发给源站。
+	// If blank, it defaults to 10MB.
+	MaxBodyBytes int64
+
+	// Client 请求源站的HTTP客户端。
+	// If blank, it defaults to a client with a 30s timeout.
+	Client *http.Client
+}
+
+// Proxy 源站的缓存代理
+type Proxy struct {
+	origin  *url.URL
+	opts    Options
+	forward *httputil.ReverseProxy // 不经过缓存的请求
+}
+
+// New 创建源站origin的缓存代理，origin形如 http://example.com/base
+func New(origin string, o *Options) (*Proxy, error) {
+	u, err := url.Parse(origin)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("proxy: invalid origin %q", origin)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/")
+
+	p := &Proxy{origin: u, forward: httputil.NewSingleHostReverseProxy(u)}
+	if o != nil {
+		p.opts = *o
+	}
+
+	keyHeaders := make([]string, len(p.opts.KeyHeaders))
+	for i, h := range p.opts.KeyHeaders {
+		keyHeaders[i] = http.CanonicalHeaderKey(h)
+	}
+	p.opts.KeyHeaders = keyHeaders
+
+	if len(p.opts.Headers) == 0 {
+		p.opts.Headers = defaultHeaders
+	}
+
+	if p.opts.MaxBodyBytes == 0 {
+		p.opts.MaxBodyBytes = defaultMaxBodyBytes
+	}
+
+	if p.opts.Client == nil {
+		p.opts.Client = &http.Client{Timeout: defaultTimeout}
+	}
+
+	return p, nil
+}
+
+// Key 返回请求在 Group 中的key：第一行为请求URI，之后每行一个 KeyHeaders 中的请求头
+func (p *Proxy) Key(r *http.Request) string {
+	var b strings.Builder
+	b.WriteString(r.URL.RequestURI())
+	for _, name := range p.opts.KeyHeaders {
+		b.WriteString("\n" + name + ": " + strings.Join(r.Header.Values(name), ", "))
+	}
+
+	return b.String()
+}
+
+// Get 实现 ycache.Getter，不能在请求间共享的响应返回 ErrPrivate 或 ErrTooLarge
+func (p *Proxy) Get(ctx context.Context, key string) ([]byte, error) {
+	entry, err := p.fetch(ctx, key)
+	return entry.Value, err
+}
+
+// GetEntry 实现 ycache.EntryGetter，根据源站的响应设置过期时间
+// 不能在请求间共享的响应返回一个已经过期、带有 passHeader 的空响应，
+// 其他节点与 Handler 据此直接转发请求，而不是当作加载失败再次回源
+func (p *Proxy) GetEntry(ctx context.Context, key string) (ycache.Entry, error) {
+	entry, err := p.fetch(ctx, key)
+	switch {
+	case errors.Is(err, ErrPrivate):
+		return p.pass("private"), nil
+	case errors.Is(err, ErrTooLarge):
+		return p.pass("too-large"), nil
+	}
+
+	return entry, err
+}
+
+// pass 返回标记了原因的空响应，立即过期，不会被缓存
+func (p *Proxy) pass(reason string) ycache.Entry {
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Header: http.Header{
+			"Date":     {time.Now().UTC().Format(http.TimeFormat)},
+			passHeader: {reason},
+		},
+	}
+
+	return ycache.Entry{Value: p.encode(resp, nil), Expire: time.Now()}
+}
+
+// fetch 请求源站，根据响应设置过期时间
+func (p *Proxy) fetch(ctx context.Context, key string) (ycache.Entry, error) {
+	lines := strings.Split(key, "\n")
+	if !strings.HasPrefix(lines[0], "/") {
+		return ycache.Entry{}, fmt.Errorf("proxy: invalid key %q", key)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.origin.String()+lines[0], nil)
+	if err != nil {
+		return ycache.Entry{}, err
+	}
+
+	// key可以由任何人构造，只转发 KeyHeaders 中的请求头
+	for _, line := range lines[1:] {
+		if i := strings.Index(line, ": "); i > 0 && line[i+2:] != "" && p.keyHeader(http.CanonicalHeaderKey(line[:i])) {
+			req.Header.Set(line[:i], line[i+2:])
+		}
+	}
+
+	resp, err := p.opts.Client.Do(req)
+	if err != nil {
+		return ycache.Entry{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.Header.Get("Set-Cookie") != "" {
+		return ycache.Entry{}, ErrPrivate
+	}
+
+	cc := parseCacheControl(resp.Header)
+	if _, ok := cc["private"]; ok {
+		return ycache.Entry{}, ErrPrivate
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, p.opts.MaxBodyBytes+1))
+	if err != nil {
+		return ycache.Entry{}, err
+	}
+	if int64(len(body)) > p.opts.MaxBodyBytes {
+		return ycache.Entry{}, ErrTooLarge
+	}
+
+	now := time.Now()
+	if resp.Header.Get("Date") == "" {
+		resp.Header.Set("Date", now.UTC().Format(http.TimeFormat))
+	}
+
+	// 不能缓存的响应立即过期，只返回给本次加载的调用方
+	expire := now
+	if p.storable(resp, cc) {
+		if ttl := freshness(resp.Header, cc, p.opts.DefaultTTL); ttl > 0 {
+			expire = now.Add(ttl)
+		}
+	}
+
+	return ycache.Entry{Value: p.encode(resp, body), Expire: expire}, nil
+}
+
+// storable 响应是否可以被共享缓存保存
+func (p *Proxy) storable(resp *http.Response, cc map[string]string) bool {
+	if !cacheableStatus[resp.StatusCode] {
+		return false
+	}
+
+	for _, d := range []string{"no-store", "no-cache"} {
+		if _, ok := cc[d]; ok {
+			return false
+		}
+	}
+
+	// key中只区分了 KeyHeaders，响应依赖其他请求头时不同请求会共享同一个key
+	for _, v := range resp.Header.Values("Vary") {
+		for _, name := range strings.Split(v, ",") {
+			name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+			if name != "" && !p.keyHeader(name) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+func (p *Proxy) keyHeader(name string) bool {
+	for _, h := range p.opts.KeyHeaders {
+		if h == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// encode 把响应编码为HTTP/1.1报文，只保留 Options.Headers、Date 与 passHeader
+func (p *Proxy) encode(resp *http.Response, body []byte) []byte {
+	header := make(http.Header)
+	header.Set("Date", resp.Header.Get("Date"))
+	if v := resp.Header.Get(passHeader); v != "" {
+		header.Set(passHeader, v)
+	}
+	for _, name := range p.opts.Headers {
+		if v := resp.Header.Values(name); len(v) > 0 {
+			header[http.CanonicalHeaderKey(name)] = v
+		}
+	}
+
+	r := &http.Response{
+		StatusCode:    resp.StatusCode,
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		ContentLength: int64(len(body)),
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+	}
+
+	var buf bytes.Buffer
+	r.Write(&buf)
+	return buf.Bytes()
+}
+
+// Response 缓存的源站响应
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+// Decode 解析 Get 返回的数据
+func Decode(data []byte) (*Response, error) {
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(data)), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	resp.Header.Del("Content-Length")
+	return &Response{StatusCode: resp.StatusCode, Header: resp.Header, Body: body}, nil
+}
+
+// Handler 返回通过g提供源站内容的HTTP处理器，g的Getter应为p
+//
+// GET/HEAD 请求从g中读取，响应带有 X-Cache（HIT、PEER或MISS）与 Age；
+// 其他方法、带有 Authorization 的请求以及无法经过缓存的响应直接转发给源站。
+func (p *Proxy) Handler(g *ycache.Group) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead || r.Header.Get("Authorization") != "" {
+			p.forward.ServeHTTP(w, r)
+			return
+		}
+
+		view, source, err := g.GetWithSource(r.Context(), p.Key(r))
+		if err != nil {
+			log.Println("[proxy] Failed to get from cache:", err)
+			p.forward.ServeHTTP(w, r)
+			return
+		}
+
+		resp, err := Decode(view.ByteSlice())
+		if err != nil {
+			log.Println("[proxy] Failed to decode cached response:", err)
+			p.forward.ServeHTTP(w, r)
+			return
+		}
+
+		if resp.Header.Get(passHeader) != "" {
+			p.forward.ServeHTTP(w, r)
+			return
+		}
+
+		header := w.Header()
+		for name, v := range resp.Header {
+			header[name] = v
+		}
+		header.Set("X-Cache", source.CacheStatus())
+		if date, err := http.ParseTime(resp.Header.Get("Date")); err == nil {
+			age := int64(time.Since(date).Seconds())
+			if age < 0 {
+				age = 0
+			}
+			header.Set("Age", strconv.FormatInt(age, 10))
+		}
+		header.Set("Content-Length", strconv.Itoa(len(resp.Body)))
+
+		w.WriteHeader(resp.StatusCode)
+		if r.Method != http.MethodHead {
+			w.Write(resp.Body)
+		}
+	})
+}
+
+// parseCacheControl 解析 Cache-Control，指令名转为小写
+func parseCacheControl(h http.Header) map[string]string {
+	cc := make(map[string]string)
+	for _, v := range h.Values("Cache-Control") {
+		for _, part := range strings.Split(v, ",") {
+			part = strings.TrimSpace(part)
+			if part == "" {
+				continue
+			}
+
+			name, value := part, ""
+			if i := strings.IndexByte(part, '='); i >= 0 {
+				name, value = part[:i], strings.Trim(part[i+1:], `"`)
+			}
+			cc[strings.ToLower(strings.TrimSpace(name))] = value
+		}
+	}
+
+	return cc
+}
+
+// freshness 返回响应的剩余有效期：依次取 s-maxage、max-age、Expires 与 Date 的差，
+// 都没有时为 defaultTTL，并减去源站或上游缓存给出的 Age
+func freshness(h http.Header, cc map[string]string, defaultTTL time.Duration) time.Duration {
+	ttl, ok := maxAge(cc, "s-maxage")
+	if !ok {
+		ttl, ok = maxAge(cc, "max-age")
+	}
+
+	if !ok && h.Get("Expires") != "" {
+		// 无法解析的 Expires 表示已经过期
+		expires, err := http.ParseTime(h.Get("Expires"))
+		date, derr := http.ParseTime(h.Get("Date"))
+		if err != nil || derr != nil {
+			return 0
+		}
+		ttl, ok = expires.Sub(date), true
+	}
+
+	if !ok {
+		return defaultTTL
+	}
+
+	if age, err := strconv.ParseInt(h.Get("Age"), 10, 64); err == nil && age > 0 {
+		ttl -= time.Duration(age) * time.Second
+	}
+
+	return ttl
+}
+
+func maxAge(cc map[string]string, directive string) (time.Duration, bool) {
+	v, ok := cc[directive]
+	if !ok {
+		return 0, false
+	}
+
+	seconds, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || seconds < 0 {
+		return 0, true
+	}
+
+	return time.Duration(seconds) * time.Second, true
+}
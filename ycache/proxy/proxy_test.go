@@ -0,0 +1,260 @@
+package proxy
+
+import (
+	"7days/ycache"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newOrigin 返回测试用的源站，hits 记录每个路径被请求的次数
+func newOrigin(t *testing.T) (*httptest.Server, map[string]*int64) {
+	hits := map[string]*int64{
+		"/static": new(int64), "/nostore": new(int64), "/vary": new(int64),
+		"/cookie": new(int64), "/missing": new(int64), "/nocc": new(int64),
+		"/post": new(int64), "/echo": new(int64),
+	}
+
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if n, ok := hits[r.URL.Path]; ok {
+			atomic.AddInt64(n, 1)
+		}
+
+		switch r.URL.Path {
+		case "/static":
+			w.Header().Set("Cache-Control", "public, max-age=60")
+			w.Header().Set("Content-Type", "text/css")
+			w.Header().Set("X-Internal", "secret")
+			w.Write([]byte("body{}"))
+		case "/nostore":
+			w.Header().Set("Cache-Control", "no-store")
+			w.Write([]byte("fresh"))
+		case "/vary":
+			w.Header().Set("Cache-Control", "max-age=60")
+			w.Header().Set("Vary", r.URL.Query().Get("vary"))
+			w.Write([]byte(r.Header.Get("Accept")))
+		case "/cookie":
+			w.Header().Set("Cache-Control", "max-age=60")
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "1"})
+			w.Write([]byte("mine"))
+		case "/missing":
+			w.Header().Set("Cache-Control", "max-age=60")
+			http.NotFound(w, r)
+		case "/nocc":
+			w.Write([]byte("no freshness"))
+		case "/post":
+			w.Write([]byte(r.Method))
+		case "/echo":
+			w.Header().Set("Cache-Control", "max-age=60")
+			w.Write([]byte(r.Header.Get("Accept") + "|" + r.Header.Get("Authorization")))
+		}
+	}))
+	t.Cleanup(origin.Close)
+
+	return origin, hits
+}
+
+func newProxyServer(t *testing.T, name string, o *Options) (*httptest.Server, map[string]*int64) {
+	origin, hits := newOrigin(t)
+
+	p, err := New(origin.URL, o)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	g := ycache.NewGroup(name, 1<<20, p)
+	srv := httptest.NewServer(p.Handler(g))
+	t.Cleanup(srv.Close)
+
+	return srv, hits
+}
+
+func get(t *testing.T, method, url string, header http.Header) (*http.Response, string) {
+	req, _ := http.NewRequest(method, url, nil)
+	for name, v := range header {
+		req.Header[name] = v
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := ioutil.ReadAll(resp.Body)
+	return resp, string(body)
+}
+
+func TestProxyCache(t *testing.T) {
+	srv, hits := newProxyServer(t, "proxy-cache", nil)
+
+	resp, body := get(t, http.MethodGet, srv.URL+"/static", nil)
+	if body != "body{}" || resp.Header.Get("X-Cache") != "MISS" {
+		t.Fatalf("first get = %q, X-Cache %q", body, resp.Header.Get("X-Cache"))
+	}
+
+	resp, body = get(t, http.MethodGet, srv.URL+"/static", nil)
+	if body != "body{}" || resp.Header.Get("X-Cache") != "HIT" {
+		t.Fatalf("second get = %q, X-Cache %q", body, resp.Header.Get("X-Cache"))
+	}
+	if resp.Header.Get("Content-Type") != "text/css" || resp.Header.Get("Age") == "" {
+		t.Fatalf("headers = %v", resp.Header)
+	}
+	if resp.Header.Get("X-Internal") != "" {
+		t.Fatal("unselected origin header was cached")
+	}
+
+	resp, body = get(t, http.MethodHead, srv.URL+"/static", nil)
+	if body != "" || resp.Header.Get("X-Cache") != "HIT" {
+		t.Fatalf("head = %q, X-Cache %q", body, resp.Header.Get("X-Cache"))
+	}
+
+	if n := atomic.LoadInt64(hits["/static"]); n != 1 {
+		t.Fatalf("origin hits = %d, want 1", n)
+	}
+
+	// 404 同样被缓存
+	for i := 0; i < 2; i++ {
+		if resp, _ := get(t, http.MethodGet, srv.URL+"/missing", nil); resp.StatusCode != http.StatusNotFound {
+			t.Fatalf("status = %d, want 404", resp.StatusCode)
+		}
+	}
+	if n := atomic.LoadInt64(hits["/missing"]); n != 1 {
+		t.Fatalf("origin hits of 404 = %d, want 1", n)
+	}
+}
+
+func TestProxyAdmission(t *testing.T) {
+	srv, hits := newProxyServer(t, "proxy-admission", nil)
+
+	for _, path := range []string{"/nostore", "/nocc", "/cookie", "/post"} {
+		for i := 0; i < 2; i++ {
+			method := http.MethodGet
+			if path == "/post" {
+				method = http.MethodPost
+			}
+
+			resp, body := get(t, method, srv.URL+path, nil)
+			if resp.StatusCode != http.StatusOK || body == "" {
+				t.Fatalf("%s %s = %d %q", method, path, resp.StatusCode, body)
+			}
+			if path == "/cookie" && resp.Header.Get("Set-Cookie") == "" {
+				t.Fatal("Set-Cookie was not passed through")
+			}
+		}
+	}
+
+	// 不可共享的响应在拒绝缓存后再转发一次
+	want := map[string]int64{"/nostore": 2, "/nocc": 2, "/cookie": 4, "/post": 2}
+	for path, n := range want {
+		if got := atomic.LoadInt64(hits[path]); got != n {
+			t.Errorf("origin hits of %s = %d, want %d", path, got, n)
+		}
+	}
+}
+
+func TestProxyDefaultTTL(t *testing.T) {
+	srv, hits := newProxyServer(t, "proxy-default-ttl", &Options{DefaultTTL: time.Minute})
+
+	for i := 0; i < 3; i++ {
+		get(t, http.MethodGet, srv.URL+"/nocc", nil)
+	}
+
+	if n := atomic.LoadInt64(hits["/nocc"]); n != 1 {
+		t.Fatalf("origin hits = %d, want 1", n)
+	}
+}
+
+func TestProxyVary(t *testing.T) {
+	srv, hits := newProxyServer(t, "proxy-vary", &Options{KeyHeaders: []string{"accept"}})
+
+	json := http.Header{"Accept": {"application/json"}}
+	html := http.Header{"Accept": {"text/html"}}
+
+	// Vary 中的请求头都在 KeyHeaders 中，每种 Accept 各回源一次
+	for i := 0; i < 2; i++ {
+		if _, body := get(t, http.MethodGet, srv.URL+"/vary?vary=Accept", json); body != "application/json" {
+			t.Fatalf("json variant = %q", body)
+		}
+		if _, body := get(t, http.MethodGet, srv.URL+"/vary?vary=Accept", html); body != "text/html" {
+			t.Fatalf("html variant = %q", body)
+		}
+	}
+	if n := atomic.LoadInt64(hits["/vary"]); n != 2 {
+		t.Fatalf("origin hits = %d, want 2", n)
+	}
+
+	// 响应依赖不在key中的请求头时不缓存
+	for _, vary := range []string{"Accept-Language", "*"} {
+		atomic.StoreInt64(hits["/vary"], 0)
+		for i := 0; i < 2; i++ {
+			get(t, http.MethodGet, srv.URL+"/vary?vary="+vary, json)
+		}
+		if n := atomic.LoadInt64(hits["/vary"]); n != 2 {
+			t.Fatalf("Vary %s: origin hits = %d, want 2", vary, n)
+		}
+	}
+}
+
+func TestProxyEntry(t *testing.T) {
+	origin, _ := newOrigin(t)
+	p, err := New(origin.URL, &Options{KeyHeaders: []string{"Accept"}, MaxBodyBytes: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 不能共享的响应作为已经过期的数据返回，而不是加载失败
+	for _, key := range []string{"/cookie", "/static"} {
+		entry, err := p.GetEntry(context.Background(), key)
+		if err != nil {
+			t.Fatalf("%s: %v", key, err)
+		}
+
+		resp, err := Decode(entry.Value)
+		if err != nil || resp.Header.Get(passHeader) == "" || len(resp.Body) != 0 || entry.Expire.After(time.Now()) {
+			t.Fatalf("%s = %+v, %v; want an expired pass response", key, resp, err)
+		}
+		if resp.Header.Get("Set-Cookie") != "" {
+			t.Fatalf("%s: pass response leaks Set-Cookie", key)
+		}
+	}
+
+	// key中不在 KeyHeaders 里的请求头不会发送给源站
+	p.opts.MaxBodyBytes = defaultMaxBodyBytes
+	entry, err := p.GetEntry(context.Background(), "/echo\nAccept: text/plain\nAuthorization: Bearer stolen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp, err := Decode(entry.Value); err != nil || string(resp.Body) != "text/plain|" {
+		t.Fatalf("origin saw %q, %v", resp.Body, err)
+	}
+}
+
+func TestFreshness(t *testing.T) {
+	date := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		header http.Header
+		want   time.Duration
+	}{
+		{http.Header{"Cache-Control": {"max-age=60"}}, time.Minute},
+		{http.Header{"Cache-Control": {"max-age=60, s-maxage=120"}}, 2 * time.Minute},
+		{http.Header{"Cache-Control": {"max-age=60"}, "Age": {"20"}}, 40 * time.Second},
+		{http.Header{"Cache-Control": {"max-age=abc"}}, 0},
+		{http.Header{
+			"Date":    {date.Format(http.TimeFormat)},
+			"Expires": {date.Add(time.Hour).Format(http.TimeFormat)},
+		}, time.Hour},
+		{http.Header{"Date": {date.Format(http.TimeFormat)}, "Expires": {"0"}}, 0},
+		{http.Header{}, 5 * time.Second},
+	}
+
+	for _, tt := range tests {
+		if got := freshness(tt.header, parseCacheControl(tt.header), 5*time.Second); got != tt.want {
+			t.Errorf("freshness(%v) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
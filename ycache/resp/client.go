@@ -0,0 +1,121 @@
+package resp
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+)
+
+// Client 最简单的RESP2客户端，一次发送一条命令并等待响应，不能被多个goroutine同时使用
+type Client struct {
+	conn net.Conn
+	r    *bufio.Reader
+	w    *bufio.Writer
+}
+
+// Error 服务端返回的错误
+type Error string
+
+func (e Error) Error() string {
+	return string(e)
+}
+
+// Dial 连接RESP服务端
+func Dial(addr string) (*Client, error) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{conn: conn, r: bufio.NewReaderSize(conn, maxLineLen), w: bufio.NewWriter(conn)}, nil
+}
+
+// Close 关闭连接
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Do 发送命令并返回响应，响应的类型为：
+//
+//	simple string  string
+//	error          Error，作为 error 返回
+//	integer        int64
+//	bulk string    []byte，null 为 nil
+//	array          []interface{}
+func (c *Client) Do(args ...string) (interface{}, error) {
+	fmt.Fprintf(c.w, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(c.w, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+
+	if err := c.w.Flush(); err != nil {
+		return nil, err
+	}
+
+	v, err := c.read()
+	if err != nil {
+		return nil, err
+	}
+
+	if e, ok := v.(Error); ok {
+		return nil, e
+	}
+
+	return v, nil
+}
+
+// read 读取一个响应
+func (c *Client) read() (interface{}, error) {
+	line, err := readLine(c.r)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(line) == 0 {
+		return nil, errors.New("resp: empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return Error(line[1:]), nil
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return []byte(nil), nil
+		}
+
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, buf); err != nil {
+			return nil, err
+		}
+		return buf[:n], nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+
+		values := make([]interface{}, n)
+		for i := range values {
+			if values[i], err = c.read(); err != nil {
+				return nil, err
+			}
+		}
+		return values, nil
+	}
+
+	return nil, fmt.Errorf("resp: unexpected reply %q", line)
+}
@@ -0,0 +1,431 @@
+// Package resp 实现 Redis RESP2 协议的前端，让 Redis 客户端和 redis-cli 可以通过 ycache 读取数据
+//
+// 支持的命令：
+//
+//	GET key              通过 Group.Get 读取，加载失败时返回 nil
+//	MGET key [key ...]
+//	DEL key [key ...]    删除缓存，不影响后端存储，返回删除的数量
+//	EXISTS key [key ...] 返回能够读取到的key的数量
+//	PING [message]
+//	INFO [section]       服务端与当前Group的统计信息，忽略section总是返回全部
+//	SELECT group         选择Group，可以是名称或 Options.Groups 中的下标
+//	QUIT
+//
+// 命令可以是RESP数组，也可以是以空格分隔的一行文本（inline命令）。
+package resp
+
+import (
+	"7days/ycache"
+	"7days/ycache/tcpserver"
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 默认配置
+const (
+	defaultTimeout     = 5 * time.Second
+	defaultConcurrency = 100
+	maxLineLen         = 64 << 10 // 与Redis一致的inline命令与长度行的最大长度
+	maxBulkLen         = 1 << 20  // 参数都是key，不需要Redis的512MB
+	maxArgs            = 1 << 20
+	version            = "ycache"
+)
+
+// ErrServerClosed Server 已经关闭
+var ErrServerClosed = errors.New("resp: server closed")
+
+// Options are the configurations of a Server.
+type Options struct {
+	// Groups 可以通过 SELECT <下标> 选择的Group，新连接默认使用第一个。
+	// SELECT 也可以使用任意已注册的Group的名称。
+	// If blank, a connection must SELECT a group by name before GET.
+	Groups []string
+
+	// Timeout 每条命令的超时时间。
+	// If blank, it defaults to 5s.
+	Timeout time.Duration
+
+	// MaxConcurrency 一条 MGET 或 EXISTS 命令最多同时读取多少个key。
+	// If blank, it defaults to 100.
+	MaxConcurrency int
+}
+
+// Server RESP2 协议的服务端
+type Server struct {
+	commands int64 // 累计执行的命令数，通过原子操作读写
+	opts     Options
+	started  time.Time
+	tcp      *tcpserver.Server
+}
+
+// NewServer 创建服务端
+func NewServer(o *Options) *Server {
+	s := &Server{started: time.Now()}
+	s.tcp = tcpserver.New(s.serveConn, ErrServerClosed)
+	if o != nil {
+		s.opts = *o
+	}
+
+	if s.opts.Timeout == 0 {
+		s.opts.Timeout = defaultTimeout
+	}
+
+	if s.opts.MaxConcurrency == 0 {
+		s.opts.MaxConcurrency = defaultConcurrency
+	}
+
+	return s
+}
+
+// ListenAndServe 监听TCP地址addr并处理连接
+func (s *Server) ListenAndServe(addr string) error {
+	return s.tcp.ListenAndServe(addr)
+}
+
+// Serve 接受ln上的连接并处理，直到 Close 被调用
+func (s *Server) Serve(ln net.Listener) error {
+	return s.tcp.Serve(ln)
+}
+
+// Close 关闭所有监听与连接
+func (s *Server) Close() error {
+	return s.tcp.Close()
+}
+
+// session 一个连接的状态
+type session struct {
+	group *ycache.Group
+	w     *bufio.Writer
+}
+
+// serveConn 依次处理连接上的命令
+func (s *Server) serveConn(conn net.Conn) {
+	sess := &session{w: bufio.NewWriter(conn)}
+	if len(s.opts.Groups) > 0 {
+		sess.group = ycache.GetGroup(s.opts.Groups[0])
+	}
+
+	r := bufio.NewReaderSize(conn, maxLineLen)
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			if perr, ok := err.(protocolError); ok {
+				writeError(sess.w, "ERR Protocol error: "+string(perr))
+				sess.w.Flush()
+			} else if err != io.EOF {
+				log.Println("[resp] Failed to read command:", err)
+			}
+			return
+		}
+
+		if len(args) == 0 {
+			continue
+		}
+
+		atomic.AddInt64(&s.commands, 1)
+		quit := s.handle(sess, args)
+		if err := sess.w.Flush(); err != nil || quit {
+			return
+		}
+	}
+}
+
+// handle 执行一条命令，返回true时关闭连接
+func (s *Server) handle(sess *session, args []string) (quit bool) {
+	w := sess.w
+	name := strings.ToUpper(args[0])
+	args = args[1:]
+
+	arity := func(min int) bool {
+		if len(args) < min {
+			writeError(w, fmt.Sprintf("ERR wrong number of arguments for '%s' command", strings.ToLower(name)))
+			return false
+		}
+		return true
+	}
+
+	switch name {
+	case "PING":
+		if len(args) > 0 {
+			writeBulk(w, []byte(args[0]))
+		} else {
+			writeSimple(w, "PONG")
+		}
+	case "QUIT":
+		writeSimple(w, "OK")
+		return true
+	case "SELECT":
+		if arity(1) {
+			s.selectGroup(sess, args[0])
+		}
+	case "GET":
+		if arity(1) && s.requireGroup(sess) {
+			values := s.get(sess.group, args[:1])
+			writeBulk(w, values[0])
+		}
+	case "MGET":
+		if arity(1) && s.requireGroup(sess) {
+			values := s.get(sess.group, args)
+			fmt.Fprintf(w, "*%d\r\n", len(values))
+			for _, v := range values {
+				writeBulk(w, v)
+			}
+		}
+	case "EXISTS":
+		if arity(1) && s.requireGroup(sess) {
+			n := 0
+			for _, v := range s.get(sess.group, args) {
+				if v != nil {
+					n++
+				}
+			}
+			writeInt(w, int64(n))
+		}
+	case "DEL":
+		if arity(1) && s.requireGroup(sess) {
+			s.del(sess, args)
+		}
+	case "INFO":
+		s.info(sess)
+	case "COMMAND":
+		// redis-cli 启动时查询命令列表，返回空列表即可
+		w.WriteString("*0\r\n")
+	default:
+		writeError(w, fmt.Sprintf("ERR unknown command '%s'", strings.ToLower(name)))
+	}
+
+	return false
+}
+
+func (s *Server) requireGroup(sess *session) bool {
+	if sess.group == nil {
+		writeError(sess.w, "ERR no group selected, use SELECT <group>")
+		return false
+	}
+	return true
+}
+
+func (s *Server) selectGroup(sess *session, name string) {
+	if i, err := strconv.Atoi(name); err == nil {
+		if i < 0 || i >= len(s.opts.Groups) {
+			writeError(sess.w, "ERR DB index is out of range")
+			return
+		}
+		name = s.opts.Groups[i]
+	}
+
+	g := ycache.GetGroup(name)
+	if g == nil {
+		writeError(sess.w, "ERR no such group '"+name+"'")
+		return
+	}
+
+	sess.group = g
+	writeSimple(sess.w, "OK")
+}
+
+// get 并发读取所有key，最多同时读取 Options.MaxConcurrency 个，加载失败的key对应nil
+func (s *Server) get(g *ycache.Group, keys []string) [][]byte {
+	ctx, cancel := context.WithTimeout(context.Background(), s.opts.Timeout)
+	defer cancel()
+
+	values := make([][]byte, len(keys))
+	sem := make(chan struct{}, s.opts.MaxConcurrency)
+
+	var wg sync.WaitGroup
+	for i, key := range keys {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, key string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			if v, err := g.Get(ctx, key); err == nil {
+				values[i] = v.ByteSlice()
+			}
+		}(i, key)
+	}
+	wg.Wait()
+
+	return values
+}
+
+func (s *Server) del(sess *session, keys []string) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.opts.Timeout)
+	defer cancel()
+
+	var n int64
+	for _, key := range keys {
+		removed, err := sess.group.Remove(ctx, key)
+		if err != nil {
+			writeError(sess.w, "ERR "+err.Error())
+			return
+		}
+		if removed {
+			n++
+		}
+	}
+
+	writeInt(sess.w, n)
+}
+
+func (s *Server) info(sess *session) {
+	var b strings.Builder
+	line := func(name string, v interface{}) {
+		fmt.Fprintf(&b, "%s:%v\r\n", name, v)
+	}
+
+	b.WriteString("# Server\r\n")
+	line("redis_version", version)
+	line("process_id", os.Getpid())
+	line("uptime_in_seconds", int64(time.Since(s.started).Seconds()))
+
+	b.WriteString("\r\n# Clients\r\n")
+	line("connected_clients", s.tcp.Conns())
+
+	b.WriteString("\r\n# Stats\r\n")
+	line("total_connections_received", s.tcp.Total())
+	line("total_commands_processed", atomic.LoadInt64(&s.commands))
+
+	if g := sess.group; g != nil {
+		st, cs := &g.Stats, g.CacheStats()
+
+		b.WriteString("\r\n# Group\r\n")
+		line("group", g.Name())
+		line("generation", g.Generation())
+		line("gets", st.Gets.Get())
+		line("cache_hits", st.CacheHits.Get())
+		line("loads", st.Loads.Get())
+		line("loads_deduped", st.LoadsDeduped.Get())
+		line("peer_loads", st.PeerLoads.Get())
+		line("peer_errors", st.PeerErrors.Get())
+		line("local_loads", st.LocalLoads.Get())
+		line("local_load_errs", st.LocalLoadErrs.Get())
+		line("server_requests", st.ServerRequests.Get())
+		line("items", cs.Items)
+		line("evictions", cs.Evictions)
+	}
+
+	writeBulk(sess.w, []byte(b.String()))
+}
+
+// protocolError 客户端发送了不合法的数据，返回错误后关闭连接
+type protocolError string
+
+func (e protocolError) Error() string {
+	return string(e)
+}
+
+// readCommand 读取一条RESP数组命令或inline命令
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(line) == 0 || line[0] != '*' {
+		return strings.Fields(line), nil
+	}
+
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n > maxArgs {
+		return nil, protocolError("invalid multibulk length")
+	}
+
+	// 与Redis一致，*0 与 *-1 是空命令，直接忽略
+	if n <= 0 {
+		return nil, nil
+	}
+
+	// n 来自客户端，不按它预先分配内存
+	var args []string
+	for i := 0; i < n; i++ {
+		line, err := readLine(r)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(line) == 0 || line[0] != '$' {
+			return nil, protocolError(fmt.Sprintf("expected '$', got '%s'", line))
+		}
+
+		size, err := strconv.Atoi(line[1:])
+		if err != nil || size < 0 || size > maxBulkLen {
+			return nil, protocolError("invalid bulk length")
+		}
+
+		// 同样不按size预先分配内存，随读取到的数据增长
+		var b strings.Builder
+		if _, err := io.CopyN(&b, r, int64(size)); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+
+		var crlf [2]byte
+		if _, err := io.ReadFull(r, crlf[:]); err != nil {
+			return nil, err
+		}
+		if crlf[0] != '\r' || crlf[1] != '\n' {
+			return nil, protocolError("bulk string is not terminated by CRLF")
+		}
+
+		args = append(args, b.String())
+	}
+
+	return args, nil
+}
+
+// readLine 读取以 \r\n 或 \n 结尾的一行，一行的长度不超过r的缓冲区
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		return "", protocolError("too big inline request")
+	}
+	if err != nil {
+		if err == io.EOF && len(line) > 0 {
+			return "", io.ErrUnexpectedEOF
+		}
+		return "", err
+	}
+
+	return strings.TrimRight(string(line), "\r\n"), nil
+}
+
+func writeSimple(w *bufio.Writer, s string) {
+	w.WriteString("+" + s + "\r\n")
+}
+
+func writeError(w *bufio.Writer, s string) {
+	w.WriteString("-" + s + "\r\n")
+}
+
+func writeInt(w *bufio.Writer, n int64) {
+	w.WriteString(":" + strconv.FormatInt(n, 10) + "\r\n")
+}
+
+// writeBulk 写入bulk string，b为nil时写入 null bulk string
+func writeBulk(w *bufio.Writer, b []byte) {
+	if b == nil {
+		w.WriteString("$-1\r\n")
+		return
+	}
+
+	w.WriteString("$" + strconv.Itoa(len(b)) + "\r\n")
+	w.Write(b)
+	w.WriteString("\r\n")
+}
@@ -0,0 +1,228 @@
+package resp
+
+import (
+	"7days/ycache"
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func startServer(t *testing.T, o *Options) (addr string) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewServer(o)
+	go s.Serve(ln)
+	t.Cleanup(func() { s.Close() })
+
+	return ln.Addr().String()
+}
+
+func dial(t *testing.T, addr string) *Client {
+	c, err := Dial(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func newGroup(name string) *ycache.Group {
+	return ycache.NewGroup(name, 2<<10, ycache.GetterFunc(func(ctx context.Context, key string) ([]byte, error) {
+		if key == "missing" {
+			return nil, fmt.Errorf("%s not exist", key)
+		}
+		return []byte(name + "/" + key), nil
+	}))
+}
+
+func do(t *testing.T, c *Client, args ...string) interface{} {
+	v, err := c.Do(args...)
+	if err != nil {
+		t.Fatalf("%v: %v", args, err)
+	}
+	return v
+}
+
+func TestCommands(t *testing.T) {
+	newGroup("resp-a")
+	newGroup("resp-b")
+	c := dial(t, startServer(t, &Options{Groups: []string{"resp-a", "resp-b"}}))
+
+	if v := do(t, c, "PING"); v != "PONG" {
+		t.Fatalf("PING = %v", v)
+	}
+
+	if v := do(t, c, "get", "k"); string(v.([]byte)) != "resp-a/k" {
+		t.Fatalf("GET = %q", v)
+	}
+
+	if v := do(t, c, "GET", "missing"); v.([]byte) != nil {
+		t.Fatalf("GET missing = %q", v)
+	}
+
+	want := []interface{}{[]byte("resp-a/x"), []byte(nil), []byte("resp-a/y")}
+	if v := do(t, c, "MGET", "x", "missing", "y"); !reflect.DeepEqual(v, want) {
+		t.Fatalf("MGET = %q", v)
+	}
+
+	if v := do(t, c, "EXISTS", "x", "missing"); v != int64(1) {
+		t.Fatalf("EXISTS = %v", v)
+	}
+
+	if v := do(t, c, "DEL", "x", "y", "z"); v != int64(2) {
+		t.Fatalf("DEL = %v", v)
+	}
+
+	// 按下标和名称选择Group
+	do(t, c, "SELECT", "1")
+	if v := do(t, c, "GET", "k"); string(v.([]byte)) != "resp-b/k" {
+		t.Fatalf("GET after SELECT 1 = %q", v)
+	}
+
+	do(t, c, "SELECT", "resp-a")
+	if v := do(t, c, "GET", "k"); string(v.([]byte)) != "resp-a/k" {
+		t.Fatalf("GET after SELECT resp-a = %q", v)
+	}
+
+	info := string(do(t, c, "INFO").([]byte))
+	for _, s := range []string{"group:resp-a\r\n", "gets:", "cache_hits:2\r\n", "connected_clients:1\r\n"} {
+		if !strings.Contains(info, s) {
+			t.Fatalf("INFO does not contain %q:\n%s", s, info)
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	c := dial(t, startServer(t, nil))
+
+	cases := []struct {
+		args []string
+		err  string
+	}{
+		{[]string{"GET", "k"}, "ERR no group selected"},
+		{[]string{"SELECT", "0"}, "ERR DB index is out of range"},
+		{[]string{"SELECT", "resp-none"}, "ERR no such group"},
+		{[]string{"GET"}, "ERR wrong number of arguments for 'get' command"},
+		{[]string{"SET", "k", "v"}, "ERR unknown command 'set'"},
+	}
+
+	for _, tc := range cases {
+		_, err := c.Do(tc.args...)
+		if _, ok := err.(Error); !ok || !strings.HasPrefix(err.Error(), tc.err) {
+			t.Fatalf("%v = %v, want %s", tc.args, err, tc.err)
+		}
+	}
+}
+
+func TestInlineCommand(t *testing.T) {
+	newGroup("resp-inline")
+	conn, err := net.Dial("tcp", startServer(t, &Options{Groups: []string{"resp-inline"}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	fmt.Fprint(conn, "PING\r\nGET k\r\n")
+	r := bufio.NewReader(conn)
+
+	var lines []string
+	for i := 0; i < 3; i++ {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, line)
+	}
+
+	if got := strings.Join(lines, ""); got != "+PONG\r\n$13\r\nresp-inline/k\r\n" {
+		t.Fatalf("got %q", got)
+	}
+}
+
+func TestEmptyMultibulk(t *testing.T) {
+	conn, err := net.Dial("tcp", startServer(t, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// 长度为0或负数的数组是空命令，连接继续处理之后的命令
+	fmt.Fprint(conn, "*-1\r\n*0\r\n*-100\r\n*1\r\n$4\r\nPING\r\n")
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if line != "+PONG\r\n" {
+		t.Fatalf("got %q", line)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	addr := startServer(t, nil)
+
+	for name, req := range map[string]string{
+		"inline": strings.Repeat("a", maxLineLen+1) + "\r\n",
+		"bulk":   fmt.Sprintf("*1\r\n$%d\r\n", maxBulkLen+1),
+	} {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+
+		// 超过限制时不等待读取完整的命令，返回错误后关闭连接
+		go fmt.Fprint(conn, req)
+		line, err := bufio.NewReader(conn).ReadString('\n')
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !strings.HasPrefix(line, "-ERR Protocol error") {
+			t.Fatalf("%s: got %q", name, line)
+		}
+	}
+}
+
+func TestMGetConcurrency(t *testing.T) {
+	var mu sync.Mutex
+	var running, max int
+	ycache.NewGroup("resp-concurrency", 2<<10, ycache.GetterFunc(func(ctx context.Context, key string) ([]byte, error) {
+		mu.Lock()
+		running++
+		if running > max {
+			max = running
+		}
+		mu.Unlock()
+
+		time.Sleep(5 * time.Millisecond)
+
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return []byte(key), nil
+	}))
+	c := dial(t, startServer(t, &Options{Groups: []string{"resp-concurrency"}, MaxConcurrency: 2}))
+
+	keys := make([]string, 10)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key-%d", i)
+	}
+	if v := do(t, c, append([]string{"MGET"}, keys...)...); len(v.([]interface{})) != len(keys) {
+		t.Fatalf("MGET returned %d values, want %d", len(v.([]interface{})), len(keys))
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if max > 2 {
+		t.Fatalf("%d keys were loaded concurrently, want at most 2", max)
+	}
+}
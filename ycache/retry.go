@@ -0,0 +1,236 @@
+package ycache
+
+import (
+	"7days/ycache/circuit"
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+)
+
+// 从远程节点获取数据的默认策略
+const (
+	defaultBaseBackoff      = 10 * time.Millisecond
+	defaultMaxBackoff       = 200 * time.Millisecond
+	defaultBreakerThreshold = 5
+	defaultBreakerTimeout   = 10 * time.Second
+)
+
+// RetryPolicy 从远程节点获取数据时的重试与熔断策略
+type RetryPolicy struct {
+	// Attempts 最多尝试的节点数，请求失败后依次尝试负责该key的下一个副本，
+	// 需要 PeerPicker 实现 ReplicaPicker。
+	// If blank, it defaults to 1.
+	Attempts int
+
+	// BaseBackoff 与 MaxBackoff 决定重试前等待的时间，
+	// 第n次重试随机等待 [0, min(MaxBackoff, BaseBackoff×2^n)) 。
+	// If blank, they default to 10ms and 200ms.
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+
+	// Timeout 调用方没有设置deadline时单次请求的超时时间。
+	// 调用方设置了deadline时，剩余的时间平分给剩下的每次尝试。
+	// If blank, requests without a deadline never time out.
+	Timeout time.Duration
+
+	// BreakerThreshold 节点连续失败多少次后熔断。
+	// If blank, it defaults to 5.
+	BreakerThreshold int
+
+	// BreakerTimeout 熔断多久之后放行一个探测请求。
+	// If blank, it defaults to 10s.
+	BreakerTimeout time.Duration
+}
+
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.Attempts < 1 {
+		p.Attempts = 1
+	}
+
+	if p.BaseBackoff == 0 {
+		p.BaseBackoff = defaultBaseBackoff
+	}
+
+	if p.MaxBackoff == 0 {
+		p.MaxBackoff = defaultMaxBackoff
+	}
+
+	if p.BreakerThreshold == 0 {
+		p.BreakerThreshold = defaultBreakerThreshold
+	}
+
+	if p.BreakerTimeout == 0 {
+		p.BreakerTimeout = defaultBreakerTimeout
+	}
+
+	return p
+}
+
+// SetRetryPolicy 设置从远程节点获取数据的重试与熔断策略
+// 已经创建的熔断器保持原来的配置
+func (g *Group) SetRetryPolicy(policy RetryPolicy) {
+	g.retryMu.Lock()
+	defer g.retryMu.Unlock()
+	g.retry = policy.withDefaults()
+}
+
+func (g *Group) retryPolicy() RetryPolicy {
+	g.retryMu.Lock()
+	defer g.retryMu.Unlock()
+	return g.retry
+}
+
+// breaker 返回节点对应的熔断器
+func (g *Group) breaker(peer PeerGetter) *circuit.Breaker {
+	g.retryMu.Lock()
+	defer g.retryMu.Unlock()
+
+	if g.breakers == nil {
+		g.breakers = make(map[PeerGetter]*circuit.Breaker)
+	}
+
+	b, ok := g.breakers[peer]
+	if !ok {
+		g.pruneBreakers()
+		b = circuit.New(g.retry.BreakerThreshold, g.retry.BreakerTimeout)
+		g.breakers[peer] = b
+	}
+
+	return b
+}
+
+// pruneBreakers 删除已经不在节点列表中的节点的熔断器，调用方需持有 g.retryMu
+// 节点变化后出现新的节点时才会调用，避免节点发现不断变化时熔断器越来越多
+func (g *Group) pruneBreakers() {
+	l, ok := g.peers.(PeerLister)
+	if !ok {
+		return
+	}
+
+	current := make(map[PeerGetter]bool)
+	for _, peer := range l.ListPeers() {
+		current[peer] = true
+	}
+
+	for peer := range g.breakers {
+		if !current[peer] {
+			delete(g.breakers, peer)
+		}
+	}
+}
+
+// pickPeers 选出负责key的远程节点，按优先级排列
+func (g *Group) pickPeers(key string, policy RetryPolicy) []PeerGetter {
+	if r, ok := g.peers.(ReplicaPicker); ok && policy.Attempts > 1 {
+		return r.PickPeers(key, policy.Attempts)
+	}
+
+	if peer, ok := g.peers.PickPeer(key); ok {
+		return []PeerGetter{peer}
+	}
+
+	return nil
+}
+
+// getFromPeers 依次从节点获取数据，跳过已经熔断的节点
+func (g *Group) getFromPeers(ctx context.Context, peers []PeerGetter, key string) (ByteView, error) {
+	policy := g.retryPolicy()
+	if len(peers) > policy.Attempts {
+		peers = peers[:policy.Attempts]
+	}
+
+	err := circuit.ErrOpen
+	attempts := 0
+	for i, peer := range peers {
+		b := g.breaker(peer)
+		if !b.Allow() {
+			continue
+		}
+
+		if attempts > 0 {
+			if err := sleep(ctx, backoff(policy, attempts-1)); err != nil {
+				b.Release()
+				return ByteView{}, err
+			}
+		}
+		attempts++
+
+		var value ByteView
+		attemptCtx, cancel := attemptContext(ctx, policy, len(peers)-i)
+		value, err = g.getFromPeer(attemptCtx, peer, key)
+		cancel()
+
+		if err == nil {
+			b.Success()
+			return value, nil
+		}
+
+		if !isPeerFailure(err) {
+			// 节点正常响应了错误(如key不存在)，换一个节点也得不到结果
+			b.Success()
+			return ByteView{}, err
+		}
+
+		// 调用方取消或超时不代表节点不可用
+		if ctx.Err() != nil {
+			b.Release()
+			return ByteView{}, ctx.Err()
+		}
+		b.Failure()
+	}
+
+	return ByteView{}, err
+}
+
+// attemptContext 为单次请求设置超时时间
+// 调用方设置了deadline时，剩余时间平分给剩下的 left 次尝试
+func attemptContext(ctx context.Context, policy RetryPolicy, left int) (context.Context, context.CancelFunc) {
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout := time.Until(deadline) / time.Duration(left)
+		return context.WithTimeout(ctx, timeout)
+	}
+
+	if policy.Timeout > 0 {
+		return context.WithTimeout(ctx, policy.Timeout)
+	}
+
+	return context.WithCancel(ctx)
+}
+
+// backoff 返回第n次重试前随机等待的时长 (full jitter)
+func backoff(policy RetryPolicy, n int) time.Duration {
+	max := policy.BaseBackoff << uint(n)
+	if n >= 32 || max <= 0 || max > policy.MaxBackoff {
+		max = policy.MaxBackoff
+	}
+
+	if max <= 0 {
+		return 0
+	}
+
+	return time.Duration(rand.Int63n(int64(max)))
+}
+
+// sleep 等待d，ctx结束时提前返回
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// isPeerFailure 判断错误是否说明节点不可用，只有这类错误会触发熔断和重试
+func isPeerFailure(err error) bool {
+	var se *statusError
+	if errors.As(err, &se) {
+		return se.unavailable()
+	}
+
+	return true
+}
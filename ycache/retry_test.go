@@ -0,0 +1,217 @@
+package ycache
+
+import (
+	"7days/ycache/circuit"
+	pb "7days/ycache/ycachepb"
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakePeer 用于测试的 PeerGetter
+type fakePeer struct {
+	calls int32
+	delay time.Duration // 返回前等待的时间，ctx结束时提前返回
+	err   error
+	value string
+}
+
+func (f *fakePeer) Get(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	atomic.AddInt32(&f.calls, 1)
+
+	if f.delay > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(f.delay):
+		}
+	}
+
+	if f.err != nil {
+		return f.err
+	}
+
+	out.Value = []byte(f.value)
+	return nil
+}
+
+// fakePicker 所有key都由同一组副本负责
+type fakePicker struct {
+	peers []PeerGetter
+}
+
+func (f *fakePicker) PickPeer(key string) (PeerGetter, bool) {
+	return f.peers[0], true
+}
+
+func (f *fakePicker) PickPeers(key string, n int) []PeerGetter {
+	if n > len(f.peers) {
+		n = len(f.peers)
+	}
+	return f.peers[:n]
+}
+
+func newRetryGroup(name string, policy RetryPolicy, peers ...PeerGetter) *Group {
+	g := NewGroup(name, 2<<10, GetterFunc(func(ctx context.Context, key string) ([]byte, error) {
+		return []byte("local"), nil
+	}))
+	g.SetRetryPolicy(policy)
+	g.RegisterPeers(&fakePicker{peers: peers})
+	return g
+}
+
+func TestRetryNextReplica(t *testing.T) {
+	down := &fakePeer{err: errors.New("connection refused")}
+	up := &fakePeer{value: "replica"}
+	g := newRetryGroup("retry-replica", RetryPolicy{Attempts: 2, BaseBackoff: time.Millisecond}, down, up)
+
+	view, err := g.Get(context.Background(), "key")
+	if err != nil || view.String() != "replica" {
+		t.Fatalf("want value from replica, got %q, %v", view.String(), err)
+	}
+
+	if down.calls != 1 || up.calls != 1 {
+		t.Fatalf("calls = %d, %d; want 1, 1", down.calls, up.calls)
+	}
+}
+
+func TestRetryNotFound(t *testing.T) {
+	// 节点正常响应的错误不会重试，也不会触发熔断
+	missing := &fakePeer{err: &statusError{code: 500, status: "500 Internal Server Error"}}
+	other := &fakePeer{value: "replica"}
+	g := newRetryGroup("retry-not-found", RetryPolicy{Attempts: 2, BreakerThreshold: 1}, missing, other)
+
+	view, err := g.Get(context.Background(), "key")
+	if err != nil || view.String() != "local" {
+		t.Fatalf("want local value, got %q, %v", view.String(), err)
+	}
+
+	if other.calls != 0 {
+		t.Fatalf("replica called %d times, want 0", other.calls)
+	}
+
+	if state := g.breaker(missing).State(); state != circuit.Closed {
+		t.Fatalf("breaker is %v, want closed", state)
+	}
+}
+
+func TestBreakerSkipsPeer(t *testing.T) {
+	down := &fakePeer{err: errors.New("connection refused")}
+	g := newRetryGroup("retry-breaker", RetryPolicy{BreakerThreshold: 2, BreakerTimeout: time.Hour}, down)
+
+	for i, key := range []string{"a", "b", "c", "d"} {
+		view, err := g.Get(context.Background(), key)
+		if err != nil || view.String() != "local" {
+			t.Fatalf("request %d: want local value, got %q, %v", i, view.String(), err)
+		}
+	}
+
+	// 熔断后不再请求该节点
+	if down.calls != 2 {
+		t.Fatalf("peer called %d times, want 2", down.calls)
+	}
+
+	if state := g.breaker(down).State(); state != circuit.Open {
+		t.Fatalf("breaker is %v, want open", state)
+	}
+}
+
+func TestCancelDuringBackoff(t *testing.T) {
+	down := &fakePeer{err: errors.New("connection refused")}
+	probe := &fakePeer{value: "replica"}
+	g := newRetryGroup("retry-cancel", RetryPolicy{Attempts: 2, BaseBackoff: time.Hour, MaxBackoff: time.Hour, BreakerThreshold: 1, BreakerTimeout: time.Millisecond}, down, probe)
+
+	g.breaker(probe).Failure()
+	time.Sleep(2 * time.Millisecond)
+
+	// 重试前的等待被取消，半开状态下放行的探测请求没有发出
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	g.Get(ctx, "key")
+
+	if probe.calls != 0 {
+		t.Fatalf("peer called %d times, want 0", probe.calls)
+	}
+
+	if !g.breaker(probe).Allow() {
+		t.Fatal("breaker still rejects the peer after the cancelled probe")
+	}
+}
+
+func TestAttemptTimeoutFromDeadline(t *testing.T) {
+	slow := &fakePeer{delay: time.Hour}
+	fast := &fakePeer{value: "replica"}
+	g := newRetryGroup("retry-deadline", RetryPolicy{Attempts: 2, BaseBackoff: time.Millisecond}, slow, fast)
+
+	// 两次尝试平分200ms，慢节点最多占用100ms，剩下的时间留给副本
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	view, err := g.Get(ctx, "key")
+	if err != nil || view.String() != "replica" {
+		t.Fatalf("want value from replica, got %q, %v", view.String(), err)
+	}
+
+	if elapsed := time.Since(start); elapsed > 180*time.Millisecond {
+		t.Fatalf("request took %v, the slow peer should have been cut off", elapsed)
+	}
+}
+
+func TestAttemptTimeoutWithoutDeadline(t *testing.T) {
+	slow := &fakePeer{delay: time.Hour}
+	g := newRetryGroup("retry-timeout", RetryPolicy{Timeout: 20 * time.Millisecond}, slow)
+
+	view, err := g.Get(context.Background(), "key")
+	if err != nil || view.String() != "local" {
+		t.Fatalf("want local value, got %q, %v", view.String(), err)
+	}
+}
+
+func TestPeerNotFound(t *testing.T) {
+	owner := &fakePeer{err: &statusError{code: http.StatusNotFound, status: "404 Not Found", notFound: true}}
+	g := newRetryGroup("retry-not-found", RetryPolicy{Attempts: 2}, owner, &fakePeer{value: "replica"})
+
+	// 负责节点确认key不存在，不再尝试其他副本或回源
+	_, source, err := g.GetWithSource(context.Background(), "key")
+	if !errors.Is(err, ErrNotFound) || source != SourceLoad {
+		t.Fatalf("GetWithSource = %v, %v; want ErrNotFound", source, err)
+	}
+
+	if g.Stats.LocalLoads.Get() != 0 || owner.calls != 1 {
+		t.Fatalf("local loads %v, owner calls %d", &g.Stats.LocalLoads, owner.calls)
+	}
+
+	up := newRetryGroup("retry-source", RetryPolicy{}, &fakePeer{value: "remote"})
+	if _, source, _ := up.GetWithSource(context.Background(), "key"); source != SourcePeer {
+		t.Fatalf("source = %v, want peer", source)
+	}
+}
+
+func TestBreakersPruned(t *testing.T) {
+	pool := NewHTTPPool("http://self")
+	defer close(pool.done)
+	pool.Set("http://self", "http://a", "http://b")
+
+	g := NewGroup("retry-prune", 2<<10, GetterFunc(func(ctx context.Context, key string) ([]byte, error) {
+		return []byte("local"), nil
+	}))
+	g.RegisterPeers(pool)
+
+	g.breaker(pool.Getter("http://a"))
+	g.breaker(pool.Getter("http://b"))
+
+	// 节点列表变化后，新节点的熔断器创建时删除离开的节点的熔断器
+	pool.Set("http://self", "http://b", "http://c")
+	g.breaker(pool.Getter("http://c"))
+
+	if len(g.breakers) != 2 {
+		t.Fatalf("%d breakers, want the ones of b and c", len(g.breakers))
+	}
+	if _, ok := g.breakers[pool.Getter("http://a")]; ok {
+		t.Fatal("breaker of the removed peer was kept")
+	}
+}
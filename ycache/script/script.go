@@ -0,0 +1,390 @@
+// Package script 用 Starlark 脚本定义 Group 及其 Getter
+//
+// 脚本中的全局变量声明 Group：
+//
+//	group = "users"       # Group 名称，必填
+//	capacity = 64 << 20   # 缓存大小（字节），必填
+//	ttl = 60              # 数据的有效期（秒），可以是小数，省略或为0时永不过期
+//
+//	def get(key):         # 必填，返回 string 或 bytes，返回 None 表示key不存在
+//	    resp = fetch("http://users.internal/users/" + key)
+//	    if resp.status == 404:
+//	        return None
+//	    return json.encode(json.decode(resp.body)["profile"])
+//
+// 脚本可以使用的内置函数：
+//
+//	fetch(url, headers={})  GET请求，返回 struct(status, headers, body)
+//	read_file(path)         读取文件，相对路径基于脚本所在的目录
+//	json.encode/decode/indent
+//	struct(**kwargs)
+//
+// load 是 Starlark 的关键字，因此加载数据的函数名为 get。
+// 脚本的执行步数受 Options.MaxSteps 限制。脚本文件变化时重新加载，
+// 新的 get 与 ttl 立即生效，group 与 capacity 只在创建 Group 时生效。
+package script
+
+import (
+	"7days/ycache"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkjson"
+	"go.starlark.net/starlarkstruct"
+)
+
+// 默认配置
+const (
+	defaultMaxSteps     = 1000000
+	defaultPollInterval = 5 * time.Second
+	defaultFetchTimeout = 30 * time.Second
+	maxFetchBody        = 10 << 20
+)
+
+// ctxKey 保存在 starlark.Thread 中的 context，fetch 使用它取消请求
+const ctxKey = "ycache.ctx"
+
+// Options are the configurations of a Script.
+type Options struct {
+	// MaxSteps 执行脚本以及每次调用 get 允许的最大步数。
+	// If blank, it defaults to 1000000.
+	MaxSteps uint64
+
+	// PollInterval 检查脚本文件是否变化的间隔。
+	// If blank, it defaults to 5s.
+	PollInterval time.Duration
+
+	// Client fetch 使用的HTTP客户端。
+	// If blank, it defaults to a client with a 30s timeout.
+	Client *http.Client
+}
+
+// program 执行脚本得到的 Group 定义
+type program struct {
+	group    string
+	capacity int
+	ttl      time.Duration
+	get      starlark.Callable
+}
+
+// Script 由脚本定义的 Group，同时作为它的 Getter
+type Script struct {
+	path  string
+	opts  Options
+	group *ycache.Group
+
+	mu      sync.RWMutex
+	prog    *program
+	modTime time.Time
+	size    int64
+
+	once sync.Once
+	done chan struct{}
+}
+
+// Load 执行脚本文件path，创建其中声明的 Group 并开始监听文件的变化
+func Load(path string, o *Options) (*Script, error) {
+	s := &Script{path: path, done: make(chan struct{})}
+	if o != nil {
+		s.opts = *o
+	}
+
+	if s.opts.MaxSteps == 0 {
+		s.opts.MaxSteps = defaultMaxSteps
+	}
+
+	if s.opts.PollInterval <= 0 {
+		s.opts.PollInterval = defaultPollInterval
+	}
+
+	if s.opts.Client == nil {
+		s.opts.Client = &http.Client{Timeout: defaultFetchTimeout}
+	}
+
+	if _, err := s.reload(); err != nil {
+		return nil, err
+	}
+	s.group = ycache.NewGroup(s.prog.group, s.prog.capacity, s)
+
+	go s.watch()
+
+	return s, nil
+}
+
+// Group 返回脚本声明的 Group
+func (s *Script) Group() *ycache.Group {
+	return s.group
+}
+
+// Close 停止监听脚本文件
+func (s *Script) Close() {
+	s.once.Do(func() {
+		close(s.done)
+	})
+}
+
+func (s *Script) watch() {
+	ticker := time.NewTicker(s.opts.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+		}
+
+		if changed, err := s.reload(); err != nil {
+			log.Printf("[script] keep last version, reloading %s: %v", s.path, err)
+		} else if changed {
+			log.Printf("[script] reloaded %s", s.path)
+		}
+	}
+}
+
+// reload 文件有变化时重新执行脚本，脚本有错误时保留上一个版本
+func (s *Script) reload() (bool, error) {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return false, err
+	}
+
+	s.mu.RLock()
+	unchanged := s.prog != nil && info.ModTime().Equal(s.modTime) && info.Size() == s.size
+	s.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	src, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		return false, err
+	}
+
+	prog, err := s.compile(src)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// 失败时也记录修改时间，文件再次变化之前不会重复报错
+	s.modTime, s.size = info.ModTime(), info.Size()
+	if err != nil {
+		return false, err
+	}
+
+	if s.prog != nil {
+		if prog.group != s.prog.group {
+			return false, fmt.Errorf("group cannot be renamed from %q to %q", s.prog.group, prog.group)
+		}
+		if prog.capacity != s.prog.capacity {
+			log.Printf("[script] capacity of %s takes effect after restart", prog.group)
+		}
+	}
+
+	s.prog = prog
+	return true, nil
+}
+
+// compile 执行脚本并读取其中的 Group 定义
+func (s *Script) compile(src []byte) (*program, error) {
+	thread := s.newThread("exec " + s.path)
+	globals, err := starlark.ExecFile(thread, s.path, src, s.builtins())
+	if err != nil {
+		return nil, err
+	}
+	// 冻结后 get 可以被并发调用
+	globals.Freeze()
+
+	prog := &program{}
+
+	name, ok := globals["group"].(starlark.String)
+	if !ok || name == "" {
+		return nil, errors.New("group must be a non-empty string")
+	}
+	prog.group = string(name)
+
+	capacity, ok := globals["capacity"].(starlark.Int)
+	if !ok {
+		return nil, errors.New("capacity must be an int")
+	}
+	n, ok := capacity.Int64()
+	if !ok || n <= 0 {
+		return nil, errors.New("capacity must be positive")
+	}
+	prog.capacity = int(n)
+
+	if v, ok := globals["ttl"]; ok {
+		seconds, ok := starlark.AsFloat(v)
+		if !ok || seconds < 0 {
+			return nil, errors.New("ttl must be a non-negative number of seconds")
+		}
+		prog.ttl = time.Duration(seconds * float64(time.Second))
+	}
+
+	get, ok := globals["get"].(*starlark.Function)
+	if !ok || get.NumParams() != 1 {
+		return nil, errors.New("get must be a function of one parameter")
+	}
+	prog.get = get
+
+	return prog, nil
+}
+
+// Get 实现 ycache.Getter
+func (s *Script) Get(ctx context.Context, key string) ([]byte, error) {
+	entry, err := s.GetEntry(ctx, key)
+	return entry.Value, err
+}
+
+// GetEntry 实现 ycache.EntryGetter，调用脚本中的 get
+func (s *Script) GetEntry(ctx context.Context, key string) (ycache.Entry, error) {
+	s.mu.RLock()
+	prog := s.prog
+	s.mu.RUnlock()
+
+	thread := s.newThread("get " + key)
+	thread.SetLocal(ctxKey, ctx)
+
+	// ctx 取消时中止脚本的执行
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			thread.Cancel(ctx.Err().Error())
+		case <-done:
+		}
+	}()
+
+	v, err := starlark.Call(thread, prog.get, starlark.Tuple{starlark.String(key)}, nil)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ycache.Entry{}, ctx.Err()
+		}
+		return ycache.Entry{}, err
+	}
+
+	var entry ycache.Entry
+	switch v := v.(type) {
+	case starlark.NoneType:
+		return ycache.Entry{}, fmt.Errorf("%s: %w", key, ycache.ErrNotFound)
+	case starlark.String:
+		entry.Value = []byte(v)
+	case starlark.Bytes:
+		entry.Value = []byte(v)
+	default:
+		return ycache.Entry{}, fmt.Errorf("get returned %s, want string, bytes or None", v.Type())
+	}
+
+	if prog.ttl > 0 {
+		entry.Expire = time.Now().Add(prog.ttl)
+	}
+
+	return entry, nil
+}
+
+func (s *Script) newThread(name string) *starlark.Thread {
+	thread := &starlark.Thread{
+		Name: name,
+		Print: func(_ *starlark.Thread, msg string) {
+			log.Printf("[script] %s: %s", s.path, msg)
+		},
+	}
+	thread.SetMaxExecutionSteps(s.opts.MaxSteps)
+
+	return thread
+}
+
+// builtins 脚本可以使用的内置函数
+func (s *Script) builtins() starlark.StringDict {
+	return starlark.StringDict{
+		"fetch":     starlark.NewBuiltin("fetch", s.fetch),
+		"read_file": starlark.NewBuiltin("read_file", s.readFile),
+		"json":      starlarkjson.Module,
+		"struct":    starlark.NewBuiltin("struct", starlarkstruct.Make),
+	}
+}
+
+// fetch(url, headers={}) 发送GET请求，返回 struct(status, headers, body)
+func (s *Script) fetch(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var url string
+	var headers *starlark.Dict
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "url", &url, "headers?", &headers); err != nil {
+		return nil, err
+	}
+
+	ctx, _ := thread.Local(ctxKey).(context.Context)
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", b.Name(), err)
+	}
+
+	if headers != nil {
+		for _, item := range headers.Items() {
+			name, ok1 := starlark.AsString(item[0])
+			value, ok2 := starlark.AsString(item[1])
+			if !ok1 || !ok2 {
+				return nil, fmt.Errorf("%s: headers must map strings to strings", b.Name())
+			}
+			req.Header.Set(name, value)
+		}
+	}
+
+	resp, err := s.opts.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", b.Name(), err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxFetchBody+1))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", b.Name(), err)
+	}
+	if len(body) > maxFetchBody {
+		return nil, fmt.Errorf("%s: response body exceeds %d bytes", b.Name(), maxFetchBody)
+	}
+
+	respHeaders := starlark.NewDict(len(resp.Header))
+	for name := range resp.Header {
+		respHeaders.SetKey(starlark.String(name), starlark.String(resp.Header.Get(name)))
+	}
+
+	return starlarkstruct.FromStringDict(starlarkstruct.Default, starlark.StringDict{
+		"status":  starlark.MakeInt(resp.StatusCode),
+		"headers": respHeaders,
+		"body":    starlark.String(body),
+	}), nil
+}
+
+// read_file(path) 读取文件内容，相对路径基于脚本所在的目录
+func (s *Script) readFile(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var path string
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "path", &path); err != nil {
+		return nil, err
+	}
+
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(filepath.Dir(s.path), path)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", b.Name(), err)
+	}
+
+	return starlark.String(data), nil
+}
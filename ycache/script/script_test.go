@@ -0,0 +1,189 @@
+package script
+
+import (
+	"7days/ycache"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeScript 写入脚本，并修改文件的修改时间以保证 reload 能发现变化
+func writeScript(t *testing.T, path, src string) {
+	if err := ioutil.WriteFile(path, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	mtime := time.Now().Add(time.Duration(len(src)) * time.Second)
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestScript(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/users/tom" {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"name": "Tom", "age": 30}`))
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer origin.Close()
+
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "motd.txt"), []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "users.star")
+	writeScript(t, path, `
+group = "script-users"
+capacity = 1 << 20
+ttl = 60
+
+def get(key):
+    if key == "motd":
+        return read_file("motd.txt")
+    resp = fetch("`+origin.URL+`/users/" + key, headers={"Accept": "application/json"})
+    if resp.status == 404:
+        return None
+    return json.encode({"user": json.decode(resp.body)["name"]})
+`)
+
+	s, err := Load(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	g := s.Group()
+	if g != ycache.GetGroup("script-users") {
+		t.Fatal("group was not registered")
+	}
+
+	view, err := g.Get(context.Background(), "tom")
+	if err != nil || view.String() != `{"user":"Tom"}` {
+		t.Fatalf("Get(tom) = %q, %v", view.String(), err)
+	}
+	if view.Expire().IsZero() {
+		t.Fatal("ttl was not applied")
+	}
+
+	if view, err := g.Get(context.Background(), "motd"); err != nil || view.String() != "hello" {
+		t.Fatalf("Get(motd) = %q, %v", view.String(), err)
+	}
+
+	if _, err := g.Get(context.Background(), "jerry"); !errors.Is(err, ycache.ErrNotFound) {
+		t.Fatalf("Get(jerry) error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestScriptStepLimit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "loop.star")
+	writeScript(t, path, `
+group = "script-loop"
+capacity = 1 << 20
+
+def get(key):
+    n = 0
+    for i in range(100000000):
+        n += i
+    return str(n)
+`)
+
+	s, err := Load(path, &Options{MaxSteps: 10000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	_, err = s.Group().Get(context.Background(), "k")
+	if err == nil || !strings.Contains(err.Error(), "too many steps") {
+		t.Fatalf("error = %v, want too many steps", err)
+	}
+}
+
+func TestScriptReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "reload.star")
+	writeScript(t, path, `
+group = "script-reload"
+capacity = 1 << 20
+
+def get(key):
+    return "v1:" + key
+`)
+
+	s, err := Load(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if b, _ := s.Get(context.Background(), "k"); string(b) != "v1:k" {
+		t.Fatalf("Get = %q, want v1:k", b)
+	}
+
+	// 脚本有错误时保留上一个版本
+	writeScript(t, path, `group = "script-reload"
+capacity = 1 << 20
+def get(key): return undefined`)
+	if _, err := s.reload(); err == nil {
+		t.Fatal("reloading a broken script succeeded")
+	}
+
+	writeScript(t, path, `
+group = "script-renamed"
+capacity = 1 << 20
+
+def get(key):
+    return "v2:" + key
+`)
+	if _, err := s.reload(); err == nil {
+		t.Fatal("renaming the group succeeded")
+	}
+
+	if b, _ := s.Get(context.Background(), "k"); string(b) != "v1:k" {
+		t.Fatalf("Get = %q, want v1:k", b)
+	}
+
+	writeScript(t, path, `
+group = "script-reload"
+capacity = 1 << 20
+
+def get(key):
+    return bytes("v2:" + key)
+`)
+	if changed, err := s.reload(); !changed || err != nil {
+		t.Fatalf("reload = %v, %v", changed, err)
+	}
+
+	if b, err := s.Get(context.Background(), "k"); string(b) != "v2:k" {
+		t.Fatalf("Get = %q, %v, want v2:k", b, err)
+	}
+}
+
+func TestScriptInvalid(t *testing.T) {
+	tests := map[string]string{
+		"no group":     "capacity = 1\ndef get(key): return key",
+		"no capacity":  "group = 'g'\ndef get(key): return key",
+		"bad ttl":      "group = 'g'\ncapacity = 1\nttl = -1\ndef get(key): return key",
+		"no get":       "group = 'g'\ncapacity = 1",
+		"syntax error": "group = ",
+	}
+
+	dir := t.TempDir()
+	for name, src := range tests {
+		path := filepath.Join(dir, strings.Replace(name, " ", "_", -1)+".star")
+		writeScript(t, path, src)
+		if _, err := Load(path, nil); err == nil {
+			t.Errorf("%s: Load succeeded", name)
+		}
+	}
+}
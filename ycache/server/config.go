@@ -0,0 +1,430 @@
+package server
+
+import (
+	"7days/ycache"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Config 服务端的配置，可以用YAML或JSON编写，字段名相同
+type Config struct {
+	// Self 本节点在哈希环中的地址，如 http://10.0.0.1:8001
+	Self string `yaml:"self" json:"self"`
+
+	Listen    Listen    `yaml:"listen" json:"listen"`
+	Discovery Discovery `yaml:"discovery" json:"discovery"`
+	Pool      Pool      `yaml:"pool" json:"pool"`
+
+	Groups []GroupConfig `yaml:"groups" json:"groups"`
+
+	// Scripts 定义 Group 的 Starlark 脚本，见 script 包
+	Scripts []string `yaml:"scripts" json:"scripts"`
+
+	// Proxy 缓存反向代理，见 proxy 包，为nil时不启动
+	Proxy *ProxyConfig `yaml:"proxy" json:"proxy"`
+}
+
+// Listen 各个服务的监听地址，为空的服务不启动
+type Listen struct {
+	// Peer 节点间通信的地址，为空时使用 Self 中的 host:port
+	Peer string `yaml:"peer" json:"peer"`
+	// API REST API，见 api 包
+	API string `yaml:"api" json:"api"`
+	// Admin 管理接口，没有鉴权，应只监听内部地址，为空时不启动
+	Admin    string `yaml:"admin" json:"admin"`
+	Memcache string `yaml:"memcache" json:"memcache"`
+	RESP     string `yaml:"resp" json:"resp"`
+}
+
+// Discovery 节点发现的方式，最多只能设置一种，都为空时只有本节点
+type Discovery struct {
+	// Peers 固定的节点列表，SIGHUP 时重新读取
+	Peers []string `yaml:"peers" json:"peers"`
+	// File 节点列表文件，见 discovery.File
+	File string `yaml:"file" json:"file"`
+	// DNS name:port 查询A/AAAA记录，_service._proto.name 查询SRV记录
+	DNS    string  `yaml:"dns" json:"dns"`
+	Gossip *Gossip `yaml:"gossip" json:"gossip"`
+}
+
+// Gossip 通过 gossip 协议维护节点列表
+type Gossip struct {
+	Bind  string   `yaml:"bind" json:"bind"`
+	Seeds []string `yaml:"seeds" json:"seeds"`
+}
+
+// Pool 见 ycache.HTTPPoolOptions
+type Pool struct {
+	HealthCheckInterval Duration `yaml:"health_check_interval" json:"health_check_interval"`
+	HandoffBytes        int64    `yaml:"handoff_bytes" json:"handoff_bytes"`
+	// Secret 节点间写入和控制请求的共享密钥，为空时任何能访问节点端口的客户端都可以
+	// 写入缓存、使缓存失效或把节点移出哈希环
+	Secret string `yaml:"secret" json:"secret"`
+}
+
+// GroupConfig 一个 Group 的配置
+type GroupConfig struct {
+	Name     string `yaml:"name" json:"name"`
+	Capacity int    `yaml:"capacity" json:"capacity"`
+	// TTL Getter 没有指定过期时间的数据的有效期，为0时永不过期
+	TTL    Duration     `yaml:"ttl" json:"ttl"`
+	Policy PolicyConfig `yaml:"policy" json:"policy"`
+	Getter GetterConfig `yaml:"getter" json:"getter"`
+
+	// Disk 磁盘缓存的目录，为空时不使用磁盘。目录需要不存在、为空或之前由磁盘缓存使用过，其中的段文件会被清空
+	Disk string `yaml:"disk" json:"disk"`
+	// Snapshot 快照文件，启动时恢复，退出时写入
+	Snapshot string `yaml:"snapshot" json:"snapshot"`
+}
+
+// PolicyConfig 从其他节点加载数据的重试与熔断策略，见 ycache.RetryPolicy
+type PolicyConfig struct {
+	Attempts         int      `yaml:"attempts" json:"attempts"`
+	BaseBackoff      Duration `yaml:"base_backoff" json:"base_backoff"`
+	MaxBackoff       Duration `yaml:"max_backoff" json:"max_backoff"`
+	Timeout          Duration `yaml:"timeout" json:"timeout"`
+	BreakerThreshold int      `yaml:"breaker_threshold" json:"breaker_threshold"`
+	BreakerTimeout   Duration `yaml:"breaker_timeout" json:"breaker_timeout"`
+}
+
+// 支持的 Getter 类型
+const (
+	GetterStatic = "static" // 配置中的固定数据
+	GetterHTTP   = "http"   // 请求后端的HTTP接口
+	GetterFile   = "file"   // 读取目录中以key命名的文件
+)
+
+// GetterConfig Getter 的类型及其参数
+type GetterConfig struct {
+	Type string `yaml:"type" json:"type"`
+
+	// Values static 的数据
+	Values map[string]string `yaml:"values" json:"values"`
+
+	// URL http 请求的地址，其中的 {key} 替换为转义后的key
+	URL string `yaml:"url" json:"url"`
+	// Headers http 请求附带的请求头
+	Headers map[string]string `yaml:"headers" json:"headers"`
+
+	// Dir file 读取的目录
+	Dir string `yaml:"dir" json:"dir"`
+}
+
+// ProxyConfig 见 proxy.Options
+type ProxyConfig struct {
+	Origin     string   `yaml:"origin" json:"origin"`
+	Addr       string   `yaml:"addr" json:"addr"`
+	Group      string   `yaml:"group" json:"group"`
+	Capacity   int      `yaml:"capacity" json:"capacity"`
+	KeyHeaders []string `yaml:"key_headers" json:"key_headers"`
+	DefaultTTL Duration `yaml:"default_ttl" json:"default_ttl"`
+}
+
+// Duration 以 "5s"、"1m30s" 的形式书写的时间间隔
+type Duration time.Duration
+
+func (d *Duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+
+	return d.parse(s)
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"5s\", got %s", data)
+	}
+
+	return d.parse(s)
+}
+
+func (d *Duration) parse(s string) error {
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(v)
+	return nil
+}
+
+// LoadConfig 读取并校验配置文件，扩展名为 .json 时按JSON解析，否则按YAML解析
+func LoadConfig(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, err := ParseConfig(data, filepath.Ext(path) == ".json")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return cfg, nil
+}
+
+// ParseConfig 解析并校验配置，不认识的字段视为错误
+func ParseConfig(data []byte, isJSON bool) (*Config, error) {
+	cfg := &Config{}
+	if isJSON {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(cfg); err != nil {
+			return nil, fmt.Errorf("decoding config: %v", err)
+		}
+	} else if err := yaml.UnmarshalStrict(data, cfg); err != nil {
+		return nil, fmt.Errorf("decoding config: %v", err)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// ValidationError 配置中的所有错误，每项形如 "groups[0].capacity: must be positive"
+type ValidationError []string
+
+func (e ValidationError) Error() string {
+	return "invalid config:\n\t" + strings.Join(e, "\n\t")
+}
+
+// Validate 校验配置并填充默认值，返回的错误为 ValidationError
+func (c *Config) Validate() error {
+	var errs ValidationError
+	report := func(field, format string, args ...interface{}) {
+		errs = append(errs, field+": "+fmt.Sprintf(format, args...))
+	}
+
+	if c.Self == "" {
+		report("self", "is required")
+	} else if u, err := parsePeerURL(c.Self); err != nil {
+		report("self", "%v", err)
+	} else if c.Listen.Peer == "" {
+		c.Listen.Peer = u.Host
+	}
+
+	// 监听地址不能重复
+	addrs := make(map[string]string)
+	checkAddr := func(field, addr string) {
+		if addr == "" {
+			return
+		}
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			report(field, "%v", err)
+			return
+		}
+		if other, ok := addrs[addr]; ok {
+			report(field, "%s is also used by %s", addr, other)
+			return
+		}
+		addrs[addr] = field
+	}
+	checkAddr("listen.peer", c.Listen.Peer)
+	checkAddr("listen.api", c.Listen.API)
+	checkAddr("listen.admin", c.Listen.Admin)
+	checkAddr("listen.memcache", c.Listen.Memcache)
+	checkAddr("listen.resp", c.Listen.RESP)
+
+	c.validateDiscovery(report)
+
+	if c.Pool.HealthCheckInterval < 0 {
+		report("pool.health_check_interval", "must not be negative")
+	}
+	if c.Pool.HandoffBytes < 0 {
+		report("pool.handoff_bytes", "must not be negative")
+	}
+
+	if len(c.Groups) == 0 && len(c.Scripts) == 0 && c.Proxy == nil {
+		report("groups", "at least one group, script or proxy is required")
+	}
+
+	names := make(map[string]int)
+	for i := range c.Groups {
+		g := &c.Groups[i]
+		field := fmt.Sprintf("groups[%d]", i)
+		g.validate(field, report)
+
+		if j, ok := names[g.Name]; ok && g.Name != "" {
+			report(field+".name", "%q is also used by groups[%d]", g.Name, j)
+		} else {
+			names[g.Name] = i
+		}
+	}
+
+	for i, path := range c.Scripts {
+		if path == "" {
+			report(fmt.Sprintf("scripts[%d]", i), "must not be empty")
+		}
+	}
+
+	if p := c.Proxy; p != nil {
+		if u, err := url.Parse(p.Origin); err != nil || u.Host == "" || u.Scheme != "http" && u.Scheme != "https" {
+			report("proxy.origin", "must be an http or https URL, got %q", p.Origin)
+		}
+		if p.Addr == "" {
+			report("proxy.addr", "is required")
+		}
+		checkAddr("proxy.addr", p.Addr)
+
+		if p.Group == "" {
+			p.Group = "proxy"
+		}
+		if _, ok := names[p.Group]; ok {
+			report("proxy.group", "%q is also used by a group", p.Group)
+		}
+		if p.Capacity == 0 {
+			p.Capacity = defaultProxyCapacity
+		} else if p.Capacity < 0 {
+			report("proxy.capacity", "must be positive")
+		}
+		if p.DefaultTTL < 0 {
+			report("proxy.default_ttl", "must not be negative")
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func (c *Config) validateDiscovery(report func(field, format string, args ...interface{})) {
+	d := &c.Discovery
+
+	var methods []string
+	if len(d.Peers) > 0 {
+		methods = append(methods, "peers")
+	}
+	if d.File != "" {
+		methods = append(methods, "file")
+	}
+	if d.DNS != "" {
+		methods = append(methods, "dns")
+	}
+	if d.Gossip != nil {
+		methods = append(methods, "gossip")
+	}
+	if len(methods) > 1 {
+		report("discovery", "only one of peers, file, dns and gossip may be set, got %s", strings.Join(methods, ", "))
+	}
+
+	seen := make(map[string]bool)
+	for i, peer := range d.Peers {
+		field := fmt.Sprintf("discovery.peers[%d]", i)
+		if _, err := parsePeerURL(peer); err != nil {
+			report(field, "%v", err)
+		} else if seen[peer] {
+			report(field, "duplicate peer %s", peer)
+		}
+		seen[peer] = true
+	}
+
+	if d.DNS != "" && !strings.HasPrefix(d.DNS, "_") {
+		if _, _, err := net.SplitHostPort(d.DNS); err != nil {
+			report("discovery.dns", "must be name:port or an SRV name like _http._tcp.name: %v", err)
+		}
+	}
+
+	if d.Gossip != nil {
+		if d.Gossip.Bind == "" {
+			report("discovery.gossip.bind", "is required")
+		} else if _, _, err := net.SplitHostPort(d.Gossip.Bind); err != nil {
+			report("discovery.gossip.bind", "%v", err)
+		}
+	}
+}
+
+func (g *GroupConfig) validate(field string, report func(field, format string, args ...interface{})) {
+	switch {
+	case g.Name == "":
+		report(field+".name", "is required")
+	case strings.ContainsAny(g.Name, "/ \t\n") || strings.HasPrefix(g.Name, "_"):
+		report(field+".name", "%q must not contain '/' or spaces or start with '_'", g.Name)
+	}
+
+	if g.Capacity <= 0 {
+		report(field+".capacity", "must be positive")
+	}
+
+	if g.TTL < 0 {
+		report(field+".ttl", "must not be negative")
+	}
+
+	p := g.Policy
+	if p.Attempts < 0 || p.BreakerThreshold < 0 {
+		report(field+".policy", "attempts and breaker_threshold must not be negative")
+	}
+	if p.BaseBackoff < 0 || p.MaxBackoff < 0 || p.Timeout < 0 || p.BreakerTimeout < 0 {
+		report(field+".policy", "durations must not be negative")
+	}
+
+	getter := field + ".getter"
+	switch g.Getter.Type {
+	case GetterStatic:
+		if g.Getter.Values == nil {
+			report(getter+".values", "is required for getter type %q", GetterStatic)
+		}
+	case GetterHTTP:
+		u, err := url.Parse(g.Getter.URL)
+		switch {
+		case g.Getter.URL == "":
+			report(getter+".url", "is required for getter type %q", GetterHTTP)
+		case err != nil || u.Host == "" || u.Scheme != "http" && u.Scheme != "https":
+			report(getter+".url", "must be an http or https URL, got %q", g.Getter.URL)
+		case !strings.Contains(g.Getter.URL, "{key}"):
+			report(getter+".url", "must contain {key}")
+		}
+	case GetterFile:
+		if g.Getter.Dir == "" {
+			report(getter+".dir", "is required for getter type %q", GetterFile)
+		}
+	case "":
+		report(getter+".type", "is required, one of %s, %s, %s", GetterStatic, GetterHTTP, GetterFile)
+	default:
+		report(getter+".type", "unknown type %q, want one of %s, %s, %s", g.Getter.Type, GetterStatic, GetterHTTP, GetterFile)
+	}
+}
+
+// retryPolicy 转换为 ycache.RetryPolicy
+func (p PolicyConfig) retryPolicy() ycache.RetryPolicy {
+	return ycache.RetryPolicy{
+		Attempts:         p.Attempts,
+		BaseBackoff:      time.Duration(p.BaseBackoff),
+		MaxBackoff:       time.Duration(p.MaxBackoff),
+		Timeout:          time.Duration(p.Timeout),
+		BreakerThreshold: p.BreakerThreshold,
+		BreakerTimeout:   time.Duration(p.BreakerTimeout),
+	}
+}
+
+// parsePeerURL 校验节点地址，形如 http://host:port
+func parsePeerURL(peer string) (*url.URL, error) {
+	u, err := url.Parse(peer)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" || u.Port() == "" {
+		return nil, fmt.Errorf("%q must be an http URL with a port, like http://10.0.0.1:8001", peer)
+	}
+
+	if u.Path != "" && u.Path != "/" {
+		return nil, fmt.Errorf("%q must not have a path", peer)
+	}
+
+	return u, nil
+}
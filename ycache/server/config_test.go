@@ -0,0 +1,139 @@
+package server
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testYAML = `
+self: http://localhost:8001
+listen:
+  api: localhost:9999
+discovery:
+  peers: [http://localhost:8001, http://localhost:8002]
+pool:
+  health_check_interval: 5s
+groups:
+  - name: names
+    capacity: 2048
+    ttl: 1m
+    policy:
+      attempts: 2
+      timeout: 500ms
+    getter:
+      type: static
+      values:
+        Tom: "630"
+`
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	yamlPath := filepath.Join(dir, "ycache.yaml")
+	jsonPath := filepath.Join(dir, "ycache.json")
+
+	if err := ioutil.WriteFile(yamlPath, []byte(testYAML), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(jsonPath, []byte(`{
+		"self": "http://localhost:8001",
+		"listen": {"api": "localhost:9999"},
+		"discovery": {"peers": ["http://localhost:8001", "http://localhost:8002"]},
+		"pool": {"health_check_interval": "5s"},
+		"groups": [{
+			"name": "names", "capacity": 2048, "ttl": "1m",
+			"policy": {"attempts": 2, "timeout": "500ms"},
+			"getter": {"type": "static", "values": {"Tom": "630"}}
+		}]
+	}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{yamlPath, jsonPath} {
+		cfg, err := LoadConfig(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if cfg.Listen.Peer != "localhost:8001" {
+			t.Errorf("%s: listen.peer = %q, want the address of self", path, cfg.Listen.Peer)
+		}
+		if time.Duration(cfg.Pool.HealthCheckInterval) != 5*time.Second {
+			t.Errorf("%s: health_check_interval = %v", path, cfg.Pool.HealthCheckInterval)
+		}
+
+		g := cfg.Groups[0]
+		if g.Name != "names" || g.Capacity != 2048 || time.Duration(g.TTL) != time.Minute {
+			t.Errorf("%s: group = %+v", path, g)
+		}
+		if p := g.Policy.retryPolicy(); p.Attempts != 2 || p.Timeout != 500*time.Millisecond {
+			t.Errorf("%s: policy = %+v", path, p)
+		}
+		if g.Getter.Values["Tom"] != "630" {
+			t.Errorf("%s: getter = %+v", path, g.Getter)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	_, err := ParseConfig([]byte(`
+self: localhost:8001
+listen:
+  api: localhost:9999
+  admin: localhost:9999
+discovery:
+  peers: [http://localhost:8002]
+  dns: ycache.local:8001
+groups:
+  - name: names
+    capacity: 0
+    getter:
+      type: http
+      url: http://backend/users
+  - name: names
+    capacity: 10
+    ttl: -1s
+    getter:
+      type: redis
+`), false)
+
+	var verr ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("error = %v, want ValidationError", err)
+	}
+
+	want := []string{
+		"self: ",
+		"listen.admin: localhost:9999 is also used by listen.api",
+		"discovery: only one of peers, file, dns and gossip may be set, got peers, dns",
+		"groups[0].capacity: must be positive",
+		"groups[0].getter.url: must contain {key}",
+		"groups[1].ttl: must not be negative",
+		`groups[1].getter.type: unknown type "redis"`,
+		`groups[1].name: "names" is also used by groups[0]`,
+	}
+	for _, w := range want {
+		found := false
+		for _, e := range verr {
+			if strings.HasPrefix(e, w) {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("missing error %q in:\n%v", w, err)
+		}
+	}
+}
+
+func TestParseConfigUnknownField(t *testing.T) {
+	if _, err := ParseConfig([]byte("self: http://localhost:8001\ngroupz: []\n"), false); err == nil || !strings.Contains(err.Error(), "groupz") {
+		t.Fatalf("error = %v, want unknown field groupz", err)
+	}
+
+	if _, err := ParseConfig([]byte(`{"self": "http://localhost:8001", "pool": {"health_check_interval": 5}}`), true); err == nil {
+		t.Fatal("numeric duration was accepted")
+	}
+}
@@ -0,0 +1,147 @@
+package server
+
+import (
+	"7days/ycache"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxHTTPBody http Getter 允许的最大响应体
+const maxHTTPBody = 10 << 20
+
+// newGetter 根据配置创建 Getter，配置已经校验过
+func newGetter(c GetterConfig) ycache.Getter {
+	switch c.Type {
+	case GetterHTTP:
+		return &httpGetter{url: c.URL, headers: c.Headers, client: &http.Client{Timeout: 30 * time.Second}}
+	case GetterFile:
+		return fileGetter(c.Dir)
+	}
+
+	return staticGetter(c.Values)
+}
+
+// staticGetter 配置中的固定数据
+type staticGetter map[string]string
+
+func (s staticGetter) Get(ctx context.Context, key string) ([]byte, error) {
+	v, ok := s[key]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", key, ycache.ErrNotFound)
+	}
+
+	return []byte(v), nil
+}
+
+// httpGetter 请求 url 中 {key} 替换为key之后的地址，404视为key不存在
+type httpGetter struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+}
+
+func (h *httpGetter) Get(ctx context.Context, key string) ([]byte, error) {
+	u := strings.Replace(h.url, "{key}", url.PathEscape(key), -1)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for name, value := range h.headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%s: %w", key, ycache.ErrNotFound)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("backend returned: %v", resp.Status)
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxHTTPBody+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > maxHTTPBody {
+		return nil, fmt.Errorf("backend response exceeds %d bytes", maxHTTPBody)
+	}
+
+	return body, nil
+}
+
+// fileGetter 读取目录中以key命名的文件，key可以包含子目录但不能离开该目录
+type fileGetter string
+
+func (dir fileGetter) Get(ctx context.Context, key string) ([]byte, error) {
+	name := filepath.FromSlash(key)
+	if filepath.IsAbs(name) || filepath.Clean(name) != name || strings.HasPrefix(name, "..") {
+		return nil, fmt.Errorf("invalid key %q", key)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(string(dir), name))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%s: %w", key, ycache.ErrNotFound)
+	}
+
+	return data, err
+}
+
+// reloadableGetter Group 的 Getter，SIGHUP 重新加载配置时替换其中的 Getter 与 TTL
+type reloadableGetter struct {
+	mu     sync.RWMutex
+	getter ycache.Getter
+	ttl    time.Duration
+}
+
+func (r *reloadableGetter) set(getter ycache.Getter, ttl time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.getter, r.ttl = getter, ttl
+}
+
+func (r *reloadableGetter) Get(ctx context.Context, key string) ([]byte, error) {
+	entry, err := r.GetEntry(ctx, key)
+	return entry.Value, err
+}
+
+// GetEntry 实现 ycache.EntryGetter，Getter 没有指定过期时间时使用配置的TTL
+func (r *reloadableGetter) GetEntry(ctx context.Context, key string) (ycache.Entry, error) {
+	r.mu.RLock()
+	getter, ttl := r.getter, r.ttl
+	r.mu.RUnlock()
+
+	var entry ycache.Entry
+	if eg, ok := getter.(ycache.EntryGetter); ok {
+		var err error
+		if entry, err = eg.GetEntry(ctx, key); err != nil {
+			return ycache.Entry{}, err
+		}
+	} else {
+		value, err := getter.Get(ctx, key)
+		if err != nil {
+			return ycache.Entry{}, err
+		}
+		entry.Value = value
+	}
+
+	if entry.Expire.IsZero() && ttl > 0 {
+		entry.Expire = time.Now().Add(ttl)
+	}
+
+	return entry, nil
+}
@@ -0,0 +1,542 @@
+// Package server 根据配置文件运行 ycache 节点
+//
+// 配置定义各个服务的监听地址、本节点的地址、节点发现的方式以及任意多个 Group，见 Config。
+// Reload 应用新的配置：Getter、TTL、重试策略与固定的节点列表立即生效，
+// 可以新增 Group；监听地址、节点发现的方式以及 Group 的容量等需要重启才能生效。
+// Shutdown 使节点离开集群，等待进行中的请求与加载完成后写入快照并停止。
+package server
+
+import (
+	"7days/ycache"
+	"7days/ycache/api"
+	"7days/ycache/discovery"
+	"7days/ycache/disk"
+	"7days/ycache/gossip"
+	"7days/ycache/memcache"
+	"7days/ycache/proxy"
+	"7days/ycache/resp"
+	"7days/ycache/script"
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultProxyCapacity 缓存反向代理的 Group 的默认容量
+const defaultProxyCapacity = 64 << 20
+
+// group 配置中定义的 Group
+type group struct {
+	*ycache.Group
+	getter *reloadableGetter
+	cfg    GroupConfig
+}
+
+// Server 根据配置运行的节点
+type Server struct {
+	pool *ycache.HTTPPool
+
+	mu      sync.Mutex
+	cfg     *Config
+	groups  map[string]*group
+	scripts []*script.Script
+	proxy   *proxy.Proxy
+	closers []func() // 节点发现等后台任务
+	gossip  *gossip.Node
+
+	closing     bool // 已经调用了 Shutdown 或 Close
+	httpServers []*http.Server
+	memcache    *memcache.Server
+	resp        *resp.Server
+}
+
+// New 按配置创建所有 Group 并开始发现节点，cfg 需已通过 Validate
+func New(cfg *Config) (*Server, error) {
+	s := &Server{
+		cfg:    cfg,
+		groups: make(map[string]*group),
+		pool: ycache.NewHTTPPoolOpts(cfg.Self, &ycache.HTTPPoolOptions{
+			HealthCheckInterval: time.Duration(cfg.Pool.HealthCheckInterval),
+			HandoffBytes:        cfg.Pool.HandoffBytes,
+			Secret:              cfg.Pool.Secret,
+		}),
+	}
+
+	// 在加入哈希环之前恢复缓存
+	for _, gc := range cfg.Groups {
+		store, err := openDisk(gc)
+		if err != nil {
+			s.Close()
+			return nil, err
+		}
+		s.addGroup(gc, store)
+	}
+
+	for _, path := range cfg.Scripts {
+		sc, err := script.Load(path, nil)
+		if err != nil {
+			s.Close()
+			return nil, fmt.Errorf("loading script %s: %w", path, err)
+		}
+		s.scripts = append(s.scripts, sc)
+
+		if _, ok := s.groups[sc.Group().Name()]; ok {
+			s.Close()
+			return nil, fmt.Errorf("script %s: group %q is also defined in the config", path, sc.Group().Name())
+		}
+		sc.Group().RegisterPeers(s.pool)
+	}
+
+	if pc := cfg.Proxy; pc != nil {
+		// NewGroup 会替换同名的 Group，脚本的 Group 名称在加载前无法校验
+		for i, sc := range s.scripts {
+			if sc.Group().Name() == pc.Group {
+				s.Close()
+				return nil, fmt.Errorf("script %s: group %q is also used by the proxy", cfg.Scripts[i], pc.Group)
+			}
+		}
+
+		p, err := proxy.New(pc.Origin, &proxy.Options{
+			KeyHeaders: pc.KeyHeaders,
+			DefaultTTL: time.Duration(pc.DefaultTTL),
+		})
+		if err != nil {
+			s.Close()
+			return nil, err
+		}
+		s.proxy = p
+		ycache.NewGroup(pc.Group, pc.Capacity, p).RegisterPeers(s.pool)
+	}
+
+	if err := s.discover(); err != nil {
+		s.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Pool 返回节点池
+func (s *Server) Pool() *ycache.HTTPPool {
+	return s.pool
+}
+
+// openDisk 打开 Group 配置的磁盘存储，没有配置时返回nil
+func openDisk(gc GroupConfig) (*disk.Store, error) {
+	if gc.Disk == "" {
+		return nil, nil
+	}
+
+	store, err := disk.Open(gc.Disk, nil)
+	if err != nil {
+		return nil, fmt.Errorf("group %s: opening disk: %w", gc.Name, err)
+	}
+
+	return store, nil
+}
+
+// addGroup 创建配置中的 Group，store 为 openDisk 打开的磁盘存储
+func (s *Server) addGroup(gc GroupConfig, store *disk.Store) {
+	g := &group{getter: &reloadableGetter{}, cfg: gc}
+	g.getter.set(newGetter(gc.Getter), time.Duration(gc.TTL))
+
+	g.Group = ycache.NewGroup(gc.Name, gc.Capacity, g.getter)
+	g.SetRetryPolicy(gc.Policy.retryPolicy())
+
+	if store != nil {
+		g.SetDiskStore(store)
+	}
+
+	if gc.Snapshot != "" {
+		if err := g.RestoreFile(gc.Snapshot); err != nil && !os.IsNotExist(err) {
+			log.Printf("[server] Failed to restore snapshot of %s: %v", gc.Name, err)
+		}
+	}
+
+	g.RegisterPeers(s.pool)
+	s.groups[gc.Name] = g
+}
+
+// discover 按配置的方式维护节点列表
+func (s *Server) discover() error {
+	d := s.cfg.Discovery
+
+	switch {
+	case d.Gossip != nil:
+		node, err := gossip.New(gossip.Config{
+			Name:     s.cfg.Self,
+			BindAddr: d.Gossip.Bind,
+			OnChange: func(members []string) {
+				log.Println("[gossip] members changed:", members)
+				s.pool.Set(members...)
+			},
+		})
+		if err != nil {
+			return err
+		}
+		s.gossip = node
+		s.closers = append(s.closers, func() { node.Close() })
+
+		if len(d.Gossip.Seeds) > 0 {
+			return node.Join(d.Gossip.Seeds...)
+		}
+
+	case d.DNS != "":
+		cfg := discovery.DNSConfig{Name: d.DNS, SRV: strings.HasPrefix(d.DNS, "_")}
+		if !cfg.SRV {
+			host, port, _ := net.SplitHostPort(d.DNS)
+			cfg.Name = host
+			cfg.Port, _ = strconv.Atoi(port)
+		}
+
+		dns, err := discovery.NewDNS(cfg, s.pool)
+		if err != nil {
+			return err
+		}
+		s.closers = append(s.closers, dns.Close)
+
+	case d.File != "":
+		f, err := discovery.NewFile(d.File, 0, s.pool)
+		if err != nil {
+			return err
+		}
+		s.closers = append(s.closers, f.Close)
+
+	default:
+		s.pool.Set(staticPeers(s.cfg)...)
+	}
+
+	return nil
+}
+
+// staticPeers 配置中固定的节点列表，总是包含本节点
+func staticPeers(cfg *Config) []string {
+	for _, peer := range cfg.Discovery.Peers {
+		if peer == cfg.Self {
+			return cfg.Discovery.Peers
+		}
+	}
+
+	return append([]string{cfg.Self}, cfg.Discovery.Peers...)
+}
+
+// ListenAndServe 启动配置中的所有服务，任意一个服务退出时返回其错误
+// Shutdown 或 Close 之后返回 http.ErrServerClosed
+func (s *Server) ListenAndServe() error {
+	s.mu.Lock()
+	if s.closing {
+		s.mu.Unlock()
+		return http.ErrServerClosed
+	}
+	cfg := s.cfg
+
+	peerMux := http.NewServeMux()
+	peerMux.Handle("/_ycache/", s.pool)
+	peerMux.Handle("/_events", ycache.NewEventHandler())
+
+	errc := make(chan error, 8)
+	serveHTTP := func(name, addr string, h http.Handler) {
+		srv := &http.Server{Addr: addr, Handler: h}
+		s.httpServers = append(s.httpServers, srv)
+
+		log.Printf("[server] %s is running at %s", name, addr)
+		go func() { errc <- fmt.Errorf("%s: %w", name, srv.ListenAndServe()) }()
+	}
+
+	// 先开始监听再通知其他节点，收到通知的节点会立即把请求发给本节点
+	ln, err := net.Listen("tcp", cfg.Listen.Peer)
+	if err != nil {
+		s.mu.Unlock()
+		return fmt.Errorf("ycache: %w", err)
+	}
+	peerSrv := &http.Server{Handler: peerMux}
+	s.httpServers = append(s.httpServers, peerSrv)
+	log.Printf("[server] ycache is running at %s", cfg.Listen.Peer)
+	go func() { errc <- fmt.Errorf("ycache: %w", peerSrv.Serve(ln)) }()
+
+	// 离开后重启的节点需要其他节点把它重新加入哈希环
+	go s.pool.Join(context.Background())
+
+	// 管理接口没有鉴权，只在单独的地址上提供服务
+	if cfg.Listen.Admin != "" {
+		admin := ycache.NewAdmin(s.pool)
+		admin.HandleSnapshotFiles(s.snapshotFile)
+
+		mux := http.NewServeMux()
+		mux.Handle("/_admin/", http.StripPrefix("/_admin", admin))
+		serveHTTP("admin", cfg.Listen.Admin, mux)
+	}
+
+	if cfg.Listen.API != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/v1/", api.New(nil))
+		serveHTTP("api", cfg.Listen.API, mux)
+	}
+
+	if s.proxy != nil {
+		serveHTTP("proxy", cfg.Proxy.Addr, s.proxy.Handler(ycache.GetGroup(cfg.Proxy.Group)))
+	}
+
+	var names []string
+	for _, gc := range cfg.Groups {
+		names = append(names, gc.Name)
+	}
+
+	if cfg.Listen.Memcache != "" {
+		var def string
+		if len(names) > 0 {
+			def = names[0]
+		}
+		s.memcache = memcache.NewServer(&memcache.Options{Group: def})
+		log.Printf("[server] memcache is running at %s", cfg.Listen.Memcache)
+		go func(m *memcache.Server) {
+			errc <- fmt.Errorf("memcache: %w", m.ListenAndServe(cfg.Listen.Memcache))
+		}(s.memcache)
+	}
+
+	if cfg.Listen.RESP != "" {
+		s.resp = resp.NewServer(&resp.Options{Groups: names})
+		log.Printf("[server] resp is running at %s", cfg.Listen.RESP)
+		go func(r *resp.Server) {
+			errc <- fmt.Errorf("resp: %w", r.ListenAndServe(cfg.Listen.RESP))
+		}(s.resp)
+	}
+	s.mu.Unlock()
+
+	err = <-errc
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closing {
+		return http.ErrServerClosed
+	}
+	return err
+}
+
+// Reload 应用新的配置，cfg 需已通过 Validate。需要重启才能生效的变化只记录日志
+func (s *Server) Reload(cfg *Config) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// 先检查并准备新增的 Group，失败时不改变任何状态
+	stores := make(map[string]*disk.Store)
+	abort := func(err error) error {
+		for _, store := range stores {
+			if store != nil {
+				store.Close()
+			}
+		}
+		return err
+	}
+
+	for _, gc := range cfg.Groups {
+		if _, ok := s.groups[gc.Name]; ok {
+			continue
+		}
+
+		// 脚本和代理定义的 Group 同样注册在 ycache 中
+		if ycache.GetGroup(gc.Name) != nil {
+			return abort(fmt.Errorf("group %q is already defined by a script or the proxy", gc.Name))
+		}
+
+		store, err := openDisk(gc)
+		if err != nil {
+			return abort(err)
+		}
+		stores[gc.Name] = store
+	}
+
+	old := s.cfg
+	restart := func(what string) {
+		log.Printf("[server] %s changed, restart to apply", what)
+	}
+
+	if cfg.Self != old.Self {
+		restart("self")
+	}
+	if cfg.Listen != old.Listen {
+		restart("listen")
+	}
+	if cfg.Pool != old.Pool {
+		restart("pool")
+	}
+	if !reflect.DeepEqual(cfg.Scripts, old.Scripts) {
+		restart("scripts")
+	}
+	if !reflect.DeepEqual(cfg.Proxy, old.Proxy) {
+		restart("proxy")
+	}
+
+	// 只有固定的节点列表可以直接更新
+	oldPeers, newPeers := old.Discovery.Peers, cfg.Discovery.Peers
+	old.Discovery.Peers, cfg.Discovery.Peers = nil, nil
+	sameMethod := reflect.DeepEqual(old.Discovery, cfg.Discovery)
+	old.Discovery.Peers, cfg.Discovery.Peers = oldPeers, newPeers
+
+	switch {
+	case !sameMethod:
+		restart("discovery")
+	case old.Discovery.File == "" && old.Discovery.DNS == "" && old.Discovery.Gossip == nil &&
+		!reflect.DeepEqual(oldPeers, newPeers):
+		peers := staticPeers(cfg)
+		log.Println("[server] peers changed:", peers)
+		s.pool.Set(peers...)
+	}
+
+	seen := make(map[string]bool)
+	for _, gc := range cfg.Groups {
+		seen[gc.Name] = true
+
+		g, ok := s.groups[gc.Name]
+		if !ok {
+			s.addGroup(gc, stores[gc.Name])
+			log.Printf("[server] group %s added", gc.Name)
+			continue
+		}
+
+		if gc.Capacity != g.cfg.Capacity || gc.Disk != g.cfg.Disk || gc.Snapshot != g.cfg.Snapshot {
+			restart("capacity, disk or snapshot of group " + gc.Name)
+		}
+
+		g.getter.set(newGetter(gc.Getter), time.Duration(gc.TTL))
+		g.SetRetryPolicy(gc.Policy.retryPolicy())
+		g.cfg = gc
+	}
+
+	for name := range s.groups {
+		if !seen[name] {
+			log.Printf("[server] group %s was removed from the config, it is served until restart", name)
+		}
+	}
+
+	s.cfg = cfg
+	return nil
+}
+
+// snapshotFile 返回 Group 配置的快照文件，脚本和代理的 Group 没有快照文件
+func (s *Server) snapshotFile(name string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if g, ok := s.groups[name]; ok {
+		return g.cfg.Snapshot
+	}
+
+	return ""
+}
+
+// SaveSnapshots 把配置了快照文件的 Group 写入快照
+func (s *Server) SaveSnapshots() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for name, g := range s.groups {
+		if g.cfg.Snapshot == "" {
+			continue
+		}
+
+		if err := g.SnapshotFile(g.cfg.Snapshot); err != nil {
+			log.Printf("[server] Failed to write snapshot of %s: %v", name, err)
+		}
+	}
+}
+
+// Shutdown 优雅地停止节点
+// 先离开集群并等待其他节点转发来的请求完成，再停止 HTTP 服务并等待进行中的请求，
+// 然后关闭所有 Group（等待进行中的加载、写入待写入的数据）并写入快照，最后关闭所有服务。
+// ctx 结束时放弃剩余的等待，仍然写入快照并关闭所有服务，返回遇到的第一个错误
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.closing = true
+	servers := s.httpServers
+	node := s.gossip
+	s.mu.Unlock()
+
+	var first error
+	fail := func(err error) {
+		log.Println("[server]", err)
+		if first == nil {
+			first = err
+		}
+	}
+
+	if node != nil {
+		if err := node.Leave(); err != nil {
+			fail(fmt.Errorf("leaving gossip: %w", err))
+		}
+	}
+
+	if err := s.pool.Shutdown(ctx); err != nil {
+		fail(fmt.Errorf("draining peer requests: %w", err))
+	}
+
+	for _, srv := range servers {
+		if err := srv.Shutdown(ctx); err != nil {
+			fail(fmt.Errorf("shutting down %s: %w", srv.Addr, err))
+		}
+	}
+
+	for _, g := range s.allGroups() {
+		if err := g.Close(ctx); err != nil {
+			fail(fmt.Errorf("closing group %s: %w", g.Name(), err))
+		}
+	}
+
+	s.SaveSnapshots()
+	s.Close()
+
+	return first
+}
+
+// allGroups 返回配置、脚本与反向代理中的所有 Group
+func (s *Server) allGroups() []*ycache.Group {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var gs []*ycache.Group
+	for _, g := range s.groups {
+		gs = append(gs, g.Group)
+	}
+	for _, sc := range s.scripts {
+		gs = append(gs, sc.Group())
+	}
+	if s.proxy != nil {
+		gs = append(gs, ycache.GetGroup(s.cfg.Proxy.Group))
+	}
+
+	return gs
+}
+
+// Close 立即关闭所有服务并停止节点发现
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closing = true
+
+	for _, srv := range s.httpServers {
+		srv.Close()
+	}
+	if s.memcache != nil {
+		s.memcache.Close()
+	}
+	if s.resp != nil {
+		s.resp.Close()
+	}
+
+	for _, sc := range s.scripts {
+		sc.Close()
+	}
+	for _, close := range s.closers {
+		close()
+	}
+
+	return nil
+}
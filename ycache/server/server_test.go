@@ -0,0 +1,277 @@
+package server
+
+import (
+	"7days/ycache"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newTestServer(t *testing.T, src string) *Server {
+	cfg, err := ParseConfig([]byte(src), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+
+	return s
+}
+
+func TestServerGetters(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/users/Tom" || r.Header.Get("X-Token") != "secret" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("630"))
+	}))
+	defer backend.Close()
+
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "a.txt"), []byte("file"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	newTestServer(t, `
+self: http://localhost:18001
+groups:
+  - name: server-static
+    capacity: 10
+    ttl: 1m
+    getter: {type: static, values: {Tom: "630"}}
+  - name: server-http
+    capacity: 10
+    getter:
+      type: http
+      url: `+backend.URL+`/users/{key}
+      headers: {X-Token: secret}
+  - name: server-file
+    capacity: 10
+    getter: {type: file, dir: `+dir+`}
+`)
+
+	ctx := context.Background()
+	tests := []struct {
+		group, key, want string
+		notFound         bool
+	}{
+		{"server-static", "Tom", "630", false},
+		{"server-static", "Jack", "", true},
+		{"server-http", "Tom", "630", false},
+		{"server-http", "Jack", "", true},
+		{"server-file", "a.txt", "file", false},
+		{"server-file", "b.txt", "", true},
+	}
+
+	for _, tt := range tests {
+		view, err := ycache.GetGroup(tt.group).Get(ctx, tt.key)
+		if tt.notFound {
+			if !errors.Is(err, ycache.ErrNotFound) {
+				t.Errorf("%s/%s: error = %v, want ErrNotFound", tt.group, tt.key, err)
+			}
+			continue
+		}
+		if err != nil || view.String() != tt.want {
+			t.Errorf("%s/%s = %q, %v, want %q", tt.group, tt.key, view.String(), err, tt.want)
+		}
+	}
+
+	if view, _ := ycache.GetGroup("server-static").Get(ctx, "Tom"); view.Expire().IsZero() {
+		t.Error("ttl was not applied")
+	}
+
+	if _, err := ycache.GetGroup("server-file").Get(ctx, "../a.txt"); err == nil || !strings.Contains(err.Error(), "invalid key") {
+		t.Errorf("reading outside of dir: error = %v", err)
+	}
+}
+
+func TestServerReload(t *testing.T) {
+	s := newTestServer(t, `
+self: http://localhost:18001
+discovery:
+  peers: [http://localhost:18001]
+groups:
+  - name: server-reload
+    capacity: 10
+    getter: {type: static, values: {a: "1", b: "1"}}
+`)
+
+	ctx := context.Background()
+	g := ycache.GetGroup("server-reload")
+	if view, _ := g.Get(ctx, "a"); view.String() != "1" {
+		t.Fatalf("Get(a) = %q, want 1", view.String())
+	}
+
+	cfg, err := ParseConfig([]byte(`
+self: http://localhost:18001
+discovery:
+  peers: [http://localhost:18001, http://localhost:18002]
+groups:
+  - name: server-reload
+    capacity: 10
+    getter: {type: static, values: {a: "2", b: "2"}}
+  - name: server-added
+    capacity: 10
+    getter: {type: static, values: {c: "3"}}
+`), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Reload(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	// 已缓存的数据不变，新加载的数据使用新的 Getter
+	if view, _ := g.Get(ctx, "a"); view.String() != "1" {
+		t.Errorf("Get(a) = %q, want the cached 1", view.String())
+	}
+	if view, _ := g.Get(ctx, "b"); view.String() != "2" {
+		t.Errorf("Get(b) = %q, want 2", view.String())
+	}
+
+	added := ycache.GetGroup("server-added")
+	if added == nil {
+		t.Fatal("group was not added")
+	}
+	if view, _ := added.Get(ctx, "c"); view.String() != "3" {
+		t.Errorf("Get(c) = %q, want 3", view.String())
+	}
+
+	if peers := s.Pool().Status(); len(peers) != 2 {
+		t.Errorf("peers = %v, want 2 peers", peers)
+	}
+}
+
+func TestServerShutdown(t *testing.T) {
+	snapshot := filepath.Join(t.TempDir(), "shutdown.snapshot")
+	s := newTestServer(t, `
+self: http://127.0.0.1:0
+groups:
+  - name: server-shutdown
+    capacity: 1024
+    snapshot: `+snapshot+`
+    getter: {type: static, values: {a: "1"}}
+`)
+
+	errc := make(chan error, 1)
+	go func() { errc <- s.ListenAndServe() }()
+
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-errc; !errors.Is(err, http.ErrServerClosed) {
+		t.Errorf("ListenAndServe = %v, want ErrServerClosed", err)
+	}
+
+	if _, err := ycache.GetGroup("server-shutdown").Get(context.Background(), "a"); !errors.Is(err, ycache.ErrGroupClosed) {
+		t.Errorf("Get after Shutdown = %v, want ErrGroupClosed", err)
+	}
+	if _, err := os.Stat(snapshot); err != nil {
+		t.Errorf("snapshot was not written: %v", err)
+	}
+}
+
+func TestServerReloadConflict(t *testing.T) {
+	s := newTestServer(t, `
+self: http://localhost:18001
+discovery:
+  peers: [http://localhost:18001]
+groups:
+  - name: server-conflict
+    capacity: 10
+    getter: {type: static, values: {a: "1"}}
+proxy:
+  origin: http://localhost:18080
+  addr: localhost:18081
+  group: server-conflict-proxy
+  capacity: 10
+`)
+	proxyGroup := ycache.GetGroup("server-conflict-proxy")
+
+	// 代理的修改需要重启，新的配置中同名的 Group 不能替换代理的 Group
+	cfg, err := ParseConfig([]byte(`
+self: http://localhost:18001
+discovery:
+  peers: [http://localhost:18001, http://localhost:18002]
+groups:
+  - name: server-conflict
+    capacity: 10
+    getter: {type: static, values: {a: "2"}}
+  - name: server-conflict-proxy
+    capacity: 10
+    getter: {type: static, values: {b: "2"}}
+`), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Reload(cfg); err == nil {
+		t.Fatal("Reload succeeded, want a conflict error")
+	}
+
+	if ycache.GetGroup("server-conflict-proxy") != proxyGroup {
+		t.Error("the proxy group was replaced")
+	}
+	if view, _ := ycache.GetGroup("server-conflict").Get(context.Background(), "a"); view.String() != "1" {
+		t.Errorf("Get(a) = %q, want the old getter's 1", view.String())
+	}
+	if peers := s.Pool().Status(); len(peers) != 1 {
+		t.Errorf("peers = %v, want the old single peer", peers)
+	}
+	if s.cfg.Proxy == nil {
+		t.Error("config was replaced")
+	}
+}
+
+func TestServerScriptProxyConflict(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "proxy.star")
+	if err := ioutil.WriteFile(path, []byte(`
+group = "server-script-proxy"
+capacity = 1 << 10
+
+def get(key):
+    return "script"
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := ParseConfig([]byte(`
+self: http://localhost:18001
+discovery:
+  peers: [http://localhost:18001]
+scripts: [`+path+`]
+proxy:
+  origin: http://localhost:18080
+  addr: localhost:18081
+  group: server-script-proxy
+`), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 代理不能替换脚本定义的同名 Group
+	s, err := New(cfg)
+	if err == nil {
+		s.Close()
+		t.Fatal("New succeeded, want a conflict error")
+	}
+	if !strings.Contains(err.Error(), "server-script-proxy") {
+		t.Fatalf("New = %v, want an error about the group name", err)
+	}
+
+	if view, err := ycache.GetGroup("server-script-proxy").Get(context.Background(), "k"); err != nil || view.String() != "script" {
+		t.Errorf("Get(k) = %q, %v; want the script's value", view.String(), err)
+	}
+}
@@ -0,0 +1,339 @@
+package ycache
+
+import (
+	pb "7days/ycache/ycachepb"
+	"context"
+	"errors"
+	"hash/fnv"
+	"log"
+	"sync"
+	"time"
+)
+
+// 写入的默认配置
+const (
+	defaultWriteBatchSize     = 100
+	defaultWriteFlushInterval = time.Second
+	defaultWriteMaxPending    = 10000
+	writeLockStripes          = 64
+)
+
+// ErrWriteQueueFull write-behind模式下等待写入的key过多
+var ErrWriteQueueFull = errors.New("ycache: write-behind queue is full")
+
+// Setter 把数据写入后端存储
+type Setter interface {
+	Set(ctx context.Context, key string, value []byte) error
+}
+
+// SetterFunc 用以实现Setter的方法
+type SetterFunc func(ctx context.Context, key string, value []byte) error
+
+func (f SetterFunc) Set(ctx context.Context, key string, value []byte) error {
+	return f(ctx, key, value)
+}
+
+// BatchSetter 可选接口，write-behind模式下一次写入多个key
+type BatchSetter interface {
+	SetBatch(ctx context.Context, keys []string, values [][]byte) error
+}
+
+// WriteMode 写入后端存储的方式
+type WriteMode int
+
+const (
+	// WriteThrough 同步写入后端存储，成功后才更新缓存
+	WriteThrough WriteMode = iota
+	// WriteBehind 立即更新缓存，之后批量异步写入后端存储
+	WriteBehind
+)
+
+// WriteOptions are the configurations of the write path.
+type WriteOptions struct {
+	// Mode 写入后端存储的方式。
+	// If blank, it defaults to WriteThrough.
+	Mode WriteMode
+
+	// BatchSize write-behind模式下累积多少个key后立即写入。
+	// If blank, it defaults to 100.
+	BatchSize int
+
+	// FlushInterval write-behind模式下写入的最长间隔。
+	// If blank, it defaults to 1s.
+	FlushInterval time.Duration
+
+	// MaxPending write-behind模式下最多有多少个key等待写入，超出后 Set 返回 ErrWriteQueueFull。
+	// If blank, it defaults to 10000.
+	MaxPending int
+}
+
+// writer 把数据写入后端存储，保证同一个key的写入顺序
+type writer struct {
+	setter Setter
+	opts   WriteOptions
+
+	// write-through模式下按key加锁，同一个key的写入依次完成
+	locks [writeLockStripes]sync.Mutex
+
+	// write-behind模式下等待写入的数据，同一个key只保留最新的值
+	mu      sync.Mutex
+	pending map[string][]byte
+	order   []string // 按首次写入的顺序排列的key
+	kick    chan struct{}
+	done    chan struct{} // Group 关闭后停止定期写入
+	stopped sync.Once
+
+	// 同一时刻只有一批数据在写入，新的值总是在旧的值之后写入
+	flushMu sync.Mutex
+}
+
+// RegisterSetter 注册写入后端存储的Setter
+func (g *Group) RegisterSetter(setter Setter, o *WriteOptions) {
+	if g.writer != nil {
+		panic("RegisterSetter called more than once")
+	}
+
+	w := &writer{
+		setter:  setter,
+		pending: make(map[string][]byte),
+		kick:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+	if o != nil {
+		w.opts = *o
+	}
+
+	if w.opts.BatchSize == 0 {
+		w.opts.BatchSize = defaultWriteBatchSize
+	}
+
+	if w.opts.FlushInterval == 0 {
+		w.opts.FlushInterval = defaultWriteFlushInterval
+	}
+
+	if w.opts.MaxPending == 0 {
+		w.opts.MaxPending = defaultWriteMaxPending
+	}
+
+	if w.opts.Mode == WriteBehind {
+		go w.run()
+	}
+
+	g.writer = w
+}
+
+// Set 写入key的值，由负责该key的节点更新缓存并写入后端存储
+// 没有注册Setter时只更新缓存
+func (g *Group) Set(ctx context.Context, key string, value []byte) error {
+	if key == "" {
+		return errors.New("key is required")
+	}
+
+	if g.isClosed() {
+		return ErrGroupClosed
+	}
+
+	if g.peers != nil {
+		if peer, ok := g.peers.PickPeer(key); ok {
+			if setter, ok := peer.(PeerSetter); ok {
+				return setter.Set(ctx, &pb.SetRequest{Group: g.name, Key: key, Value: value}, &pb.SetResponse{})
+			}
+		}
+	}
+
+	return g.setLocally(ctx, key, value)
+}
+
+// Flush 等待write-behind模式下所有待写入的数据写入后端存储
+func (g *Group) Flush(ctx context.Context) error {
+	if g.writer == nil || g.writer.opts.Mode != WriteBehind {
+		return nil
+	}
+
+	return g.writer.flush(ctx)
+}
+
+// Remove 删除key的缓存，由负责该key的节点执行，返回缓存中是否有该key
+// 只删除缓存，不影响后端存储，之后的 Get 会重新加载
+func (g *Group) Remove(ctx context.Context, key string) (bool, error) {
+	if key == "" {
+		return false, errors.New("key is required")
+	}
+
+	if g.peers != nil {
+		if peer, ok := g.peers.PickPeer(key); ok {
+			if remover, ok := peer.(PeerRemover); ok {
+				out := &pb.RemoveResponse{}
+				err := remover.Remove(ctx, &pb.Request{Group: g.name, Key: key, Generation: g.Generation()}, out)
+				return out.GetRemoved(), err
+			}
+		}
+	}
+
+	return g.removeLocally(key), nil
+}
+
+// removeLocally 删除本节点中key的缓存，不转发给其他节点
+func (g *Group) removeLocally(key string) bool {
+	removed := g.mainCache.remove(key, g.Generation())
+	g.publish(Event{Type: EventRemove, Key: key})
+	return removed
+}
+
+// setLocally 在本节点更新缓存并写入后端存储，不转发给其他节点
+func (g *Group) setLocally(ctx context.Context, key string, value []byte) error {
+	if g.isClosed() {
+		return ErrGroupClosed
+	}
+
+	view := ByteView{data: cloneBytes(value), gen: g.Generation()}
+
+	w := g.writer
+	if w == nil {
+		g.update(key, view)
+		return nil
+	}
+
+	if w.opts.Mode == WriteBehind {
+		// 入队与更新缓存在同一把锁内完成，保证缓存与待写入的值顺序一致
+		w.mu.Lock()
+		defer w.mu.Unlock()
+
+		if err := w.enqueue(key, view.data); err != nil {
+			return err
+		}
+
+		g.update(key, view)
+		return nil
+	}
+
+	l := w.lock(key)
+	l.Lock()
+	defer l.Unlock()
+
+	if err := w.setter.Set(ctx, key, view.data); err != nil {
+		return err
+	}
+
+	g.update(key, view)
+	return nil
+}
+
+// update 更新缓存并发出 EventSet
+func (g *Group) update(key string, view ByteView) {
+	g.mainCache.set(key, view)
+	g.publish(Event{Type: EventSet, Key: key, Value: view.ByteSlice(), Generation: view.gen})
+}
+
+func (w *writer) lock(key string) *sync.Mutex {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return &w.locks[h.Sum32()%writeLockStripes]
+}
+
+// enqueue 加入待写入的队列，调用方需持有 w.mu
+func (w *writer) enqueue(key string, value []byte) error {
+	if _, ok := w.pending[key]; !ok {
+		if len(w.pending) >= w.opts.MaxPending {
+			return ErrWriteQueueFull
+		}
+		w.order = append(w.order, key)
+	}
+
+	w.pending[key] = value
+	if len(w.pending) >= w.opts.BatchSize {
+		select {
+		case w.kick <- struct{}{}:
+		default:
+		}
+	}
+
+	return nil
+}
+
+// run write-behind模式下定期写入待写入的数据
+func (w *writer) run() {
+	ticker := time.NewTicker(w.opts.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+		case <-w.kick:
+		}
+
+		if err := w.flush(context.Background()); err != nil {
+			log.Println("[YCache] Failed to write behind", err)
+		}
+	}
+}
+
+// stop 停止定期写入
+func (w *writer) stop() {
+	w.stopped.Do(func() { close(w.done) })
+}
+
+// flush 分批写入当前所有待写入的数据，写入失败的数据重新加入队列
+func (w *writer) flush(ctx context.Context) error {
+	w.flushMu.Lock()
+	defer w.flushMu.Unlock()
+
+	w.mu.Lock()
+	keys, pending := w.order, w.pending
+	w.order, w.pending = nil, make(map[string][]byte)
+	w.mu.Unlock()
+
+	for start := 0; start < len(keys); start += w.opts.BatchSize {
+		end := start + w.opts.BatchSize
+		if end > len(keys) {
+			end = len(keys)
+		}
+
+		batch := keys[start:end]
+		values := make([][]byte, len(batch))
+		for i, key := range batch {
+			values[i] = pending[key]
+		}
+
+		if err := w.write(ctx, batch, values); err != nil {
+			w.requeue(keys[start:], pending)
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (w *writer) write(ctx context.Context, keys []string, values [][]byte) error {
+	if b, ok := w.setter.(BatchSetter); ok {
+		return b.SetBatch(ctx, keys, values)
+	}
+
+	for i, key := range keys {
+		if err := w.setter.Set(ctx, key, values[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// requeue 把写入失败的数据放回队列的最前面，已经有更新的值的key不再放回
+func (w *writer) requeue(keys []string, values map[string][]byte) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var order []string
+	for _, key := range keys {
+		if _, ok := w.pending[key]; ok {
+			continue
+		}
+
+		w.pending[key] = values[key]
+		order = append(order, key)
+	}
+
+	w.order = append(order, w.order...)
+}
@@ -0,0 +1,328 @@
+package ycache
+
+import (
+	pb "7days/ycache/ycachepb"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeStore 记录写入的后端存储
+type fakeStore struct {
+	mu      sync.Mutex
+	data    map[string]string
+	writes  []string // 依次写入的 key=value
+	batches int
+	err     error
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{data: make(map[string]string)}
+}
+
+func (f *fakeStore) Set(ctx context.Context, key string, value []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.err != nil {
+		return f.err
+	}
+
+	f.data[key] = string(value)
+	f.writes = append(f.writes, key+"="+string(value))
+	return nil
+}
+
+func (f *fakeStore) get(key string) (string, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	v, ok := f.data[key]
+	return v, ok
+}
+
+func (f *fakeStore) fail(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.err = err
+}
+
+// fakeBatchStore 实现 BatchSetter
+type fakeBatchStore struct {
+	*fakeStore
+}
+
+func (f fakeBatchStore) SetBatch(ctx context.Context, keys []string, values [][]byte) error {
+	f.mu.Lock()
+	f.batches++
+	f.mu.Unlock()
+
+	for i, key := range keys {
+		if err := f.Set(ctx, key, values[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func newSetterGroup(name string, setter Setter, o *WriteOptions) *Group {
+	g := NewGroup(name, 2<<10, GetterFunc(func(ctx context.Context, key string) ([]byte, error) {
+		return []byte("origin"), nil
+	}))
+	g.RegisterSetter(setter, o)
+	return g
+}
+
+func TestWriteThrough(t *testing.T) {
+	store := newFakeStore()
+	g := newSetterGroup("write-through", store, nil)
+
+	if err := g.Set(context.Background(), "key", []byte("v1")); err != nil {
+		t.Fatal(err)
+	}
+
+	if v, ok := store.get("key"); !ok || v != "v1" {
+		t.Fatalf("store has %q, want v1", v)
+	}
+
+	if v, err := g.Get(context.Background(), "key"); err != nil || v.String() != "v1" {
+		t.Fatalf("Get = %q, %v; want v1", v.String(), err)
+	}
+
+	// 写入后端存储失败时不更新缓存
+	store.fail(errors.New("store is down"))
+	if err := g.Set(context.Background(), "key", []byte("v2")); err == nil {
+		t.Fatal("expected error from failing store")
+	}
+
+	if v, _ := g.Get(context.Background(), "key"); v.String() != "v1" {
+		t.Fatalf("Get = %q after failed write, want v1", v.String())
+	}
+}
+
+func TestWriteBehind(t *testing.T) {
+	store := fakeBatchStore{newFakeStore()}
+	g := newSetterGroup("write-behind", store, &WriteOptions{
+		Mode:          WriteBehind,
+		BatchSize:     2,
+		FlushInterval: time.Hour,
+	})
+
+	ctx := context.Background()
+	g.Set(ctx, "a", []byte("1"))
+	g.Set(ctx, "a", []byte("2"))
+
+	// 缓存立即更新，后端存储稍后写入
+	if v, err := g.Get(ctx, "a"); err != nil || v.String() != "2" {
+		t.Fatalf("Get = %q, %v; want 2", v.String(), err)
+	}
+
+	if _, ok := store.get("a"); ok {
+		t.Fatal("store was written before the batch was full")
+	}
+
+	g.Set(ctx, "b", []byte("3"))
+	g.Set(ctx, "c", []byte("4"))
+	if err := g.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// 同一个key只写入最新的值，按首次写入的顺序分批写入
+	want := []string{"a=2", "b=3", "c=4"}
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if len(store.writes) != len(want) {
+		t.Fatalf("writes = %v, want %v", store.writes, want)
+	}
+	for i := range want {
+		if store.writes[i] != want[i] {
+			t.Fatalf("writes = %v, want %v", store.writes, want)
+		}
+	}
+
+	if store.batches != 2 {
+		t.Fatalf("%d batches, want 2", store.batches)
+	}
+}
+
+func TestWriteBehindRetry(t *testing.T) {
+	store := newFakeStore()
+	g := newSetterGroup("write-behind-retry", store, &WriteOptions{
+		Mode:          WriteBehind,
+		FlushInterval: time.Hour,
+		MaxPending:    2,
+	})
+
+	ctx := context.Background()
+	store.fail(errors.New("store is down"))
+	g.Set(ctx, "a", []byte("1"))
+	if err := g.Flush(ctx); err == nil {
+		t.Fatal("expected error from failing store")
+	}
+
+	// 写入失败的值留在队列中，更新的值覆盖它
+	g.Set(ctx, "a", []byte("2"))
+	g.Set(ctx, "b", []byte("3"))
+	if err := g.Set(ctx, "c", []byte("4")); err != ErrWriteQueueFull {
+		t.Fatalf("Set returned %v, want ErrWriteQueueFull", err)
+	}
+
+	store.fail(nil)
+	if err := g.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if v, _ := store.get("a"); v != "2" {
+		t.Fatalf("store has a=%q, want 2", v)
+	}
+	if v, _ := store.get("b"); v != "3" {
+		t.Fatalf("store has b=%q, want 3", v)
+	}
+}
+
+// fakeSetterPeer 记录转发的写入
+type fakeSetterPeer struct {
+	fakePeer
+	sets []*pb.SetRequest
+}
+
+func (f *fakeSetterPeer) Set(ctx context.Context, in *pb.SetRequest, out *pb.SetResponse) error {
+	f.sets = append(f.sets, in)
+	return nil
+}
+
+func TestSetForwardsToOwner(t *testing.T) {
+	store := newFakeStore()
+	owner := &fakeSetterPeer{}
+	g := newSetterGroup("set-forward", store, nil)
+	g.RegisterPeers(&fakePicker{peers: []PeerGetter{owner}})
+
+	if err := g.Set(context.Background(), "key", []byte("value")); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(owner.sets) != 1 || owner.sets[0].GetKey() != "key" || string(owner.sets[0].GetValue()) != "value" {
+		t.Fatalf("forwarded %v", owner.sets)
+	}
+
+	// 不负责该key的节点不写入后端存储
+	if _, ok := store.get("key"); ok {
+		t.Fatal("store written by a node that does not own the key")
+	}
+}
+
+func TestHTTPSet(t *testing.T) {
+	store := newFakeStore()
+	g := newSetterGroup("http-set", store, nil)
+
+	p := NewHTTPPool("http://self")
+	srv := httptest.NewServer(p)
+	defer srv.Close()
+
+	setter := p.Getter(srv.URL).(PeerSetter)
+	if err := setter.Set(context.Background(), &pb.SetRequest{Group: "http-set", Key: "key", Value: []byte("value")}, &pb.SetResponse{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if v, _ := store.get("key"); v != "value" {
+		t.Fatalf("store has %q, want value", v)
+	}
+
+	if v, ok := g.peek("key"); !ok || v.String() != "value" {
+		t.Fatalf("cache has %q, %v", v.String(), ok)
+	}
+}
+
+func TestHTTPRemove(t *testing.T) {
+	store := newFakeStore()
+	g := newSetterGroup("http-remove", store, nil)
+	g.Set(context.Background(), "key", []byte("value"))
+
+	p := NewHTTPPool("http://self")
+	srv := httptest.NewServer(p)
+	defer srv.Close()
+
+	remover := p.Getter(srv.URL).(PeerRemover)
+	for _, want := range []bool{true, false} {
+		out := &pb.RemoveResponse{}
+		if err := remover.Remove(context.Background(), &pb.Request{Group: "http-remove", Key: "key"}, out); err != nil {
+			t.Fatal(err)
+		}
+
+		if out.Removed != want {
+			t.Fatalf("removed = %v, want %v", out.Removed, want)
+		}
+	}
+
+	if _, ok := g.peek("key"); ok {
+		t.Fatal("removed key is still cached")
+	}
+
+	// 只删除缓存，不影响后端存储
+	if v, _ := store.get("key"); v != "value" {
+		t.Fatalf("store has %q, want value", v)
+	}
+}
+
+func TestHTTPSetNotForwarded(t *testing.T) {
+	store := newFakeStore()
+	g := newSetterGroup("http-set-loop", store, nil)
+
+	var requests int32
+	p := NewHTTPPool("http://self")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		p.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	// 节点的哈希环不一致：本节点认为key归对方负责，对方同样认为key归本节点负责
+	g.RegisterPeers(&fakePicker{peers: []PeerGetter{p.Getter(srv.URL)}})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := g.Set(ctx, "key", []byte("value")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := g.Remove(ctx, "key"); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := atomic.LoadInt32(&requests); n != 2 {
+		t.Fatalf("%d peer requests, want one for Set and one for Remove", n)
+	}
+	if v, _ := store.get("key"); v != "value" {
+		t.Fatalf("store has %q, want value", v)
+	}
+}
+
+func TestSetDuringLoad(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	g := NewGroup("set-during-load", 2<<10, GetterFunc(func(ctx context.Context, key string) ([]byte, error) {
+		close(started)
+		<-release
+		return []byte("old"), nil
+	}))
+
+	loaded := make(chan string)
+	go func() {
+		v, _ := g.Get(context.Background(), "key")
+		loaded <- v.String()
+	}()
+	<-started
+
+	// 加载开始之后写入的值不会被加载得到的旧值覆盖
+	if err := g.Set(context.Background(), "key", []byte("new")); err != nil {
+		t.Fatal(err)
+	}
+	close(release)
+	<-loaded
+
+	if v, err := g.Get(context.Background(), "key"); err != nil || v.String() != "new" {
+		t.Fatalf("Get after Set = %q, %v; want new", v.String(), err)
+	}
+}
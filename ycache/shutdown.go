@@ -0,0 +1,245 @@
+package ycache
+
+import (
+	pb "7days/ycache/ycachepb"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// leaveTimeout 通知一个节点本节点离开或加入的超时时间
+const leaveTimeout = time.Second
+
+// ErrGroupClosed Group 关闭后，未命中缓存的 Get 与 Set 返回该错误
+var ErrGroupClosed = errors.New("ycache: group is closed")
+
+// Shutdown 使本节点优雅地离开集群
+// 先通知其他节点把本节点移出哈希环，再拒绝新的节点请求（返回503，请求方会转向其他副本），
+// 然后把本节点移出自己的哈希环并移交热点数据，最后等待进行中的节点请求完成。
+// ctx 结束时不再等待并返回 ctx.Err()。健康检查与之后的数据移交随之停止
+func (p *HTTPPool) Shutdown(ctx context.Context) error {
+	p.shutdown.Do(func() {
+		p.announceLeave(ctx)
+
+		p.drainMu.Lock()
+		p.draining = true
+		p.drainMu.Unlock()
+		close(p.done)
+
+		// 之后本节点的加载也转向新的负责节点
+		p.mu.Lock()
+		if p.cancelHandoff != nil {
+			p.cancelHandoff()
+			p.cancelHandoff = nil
+		}
+		p.peers.Remove(p.self)
+		handoff := p.opts.HandoffBytes > 0
+		p.mu.Unlock()
+
+		if handoff {
+			p.handoff(ctx)
+		}
+	})
+
+	return wait(ctx, &p.serving)
+}
+
+// announceLeave 并发通知其他节点本节点离开，失败的节点会通过健康检查发现本节点下线
+func (p *HTTPPool) announceLeave(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, peer := range p.ListPeers() {
+		wg.Add(1)
+		go func(peer *httpGetter) {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(ctx, leaveTimeout)
+			defer cancel()
+
+			if err := peer.Leave(ctx, &pb.LeaveRequest{Peer: p.self}, &pb.LeaveResponse{}); err != nil {
+				p.Log("Failed to announce leaving to %s: %v", peer.peer, err)
+			}
+		}(peer.(*httpGetter))
+	}
+	wg.Wait()
+}
+
+// Join 通知其他节点本节点开始服务，应在开始监听之后调用。
+// 本节点之前通过 Shutdown 离开时，其他节点仍把它当作被剔除的节点，收到通知后将其重新加入哈希环；
+// 通知失败的节点要等到健康检查成功才会重新加入
+func (p *HTTPPool) Join(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, peer := range p.ListPeers() {
+		wg.Add(1)
+		go func(peer *httpGetter) {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(ctx, leaveTimeout)
+			defer cancel()
+
+			if err := peer.Join(ctx, &pb.LeaveRequest{Peer: p.self}, &pb.LeaveResponse{}); err != nil {
+				p.Log("Failed to announce joining to %s: %v", peer.peer, err)
+			}
+		}(peer.(*httpGetter))
+	}
+	wg.Wait()
+}
+
+// startServing 开始处理一个请求，Shutdown 之后返回false
+func (p *HTTPPool) startServing() bool {
+	p.drainMu.Lock()
+	defer p.drainMu.Unlock()
+
+	if p.draining {
+		return false
+	}
+
+	p.serving.Add(1)
+	return true
+}
+
+// serveLeave 把离开的节点移出哈希环
+func (p *HTTPPool) serveLeave(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	req := &pb.LeaveRequest{}
+	if err := proto.Unmarshal(body, req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	p.leave(req.GetPeer())
+	p.writeProto(w, &pb.LeaveResponse{})
+}
+
+// serveJoin 把重新开始服务的节点加入哈希环
+func (p *HTTPPool) serveJoin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	req := &pb.LeaveRequest{}
+	if err := proto.Unmarshal(body, req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	p.join(req.GetPeer())
+	p.writeProto(w, &pb.LeaveResponse{})
+}
+
+// leave 把离开的节点当作被剔除的节点移出哈希环
+// 节点仍然保留在HTTP池中，重启后通过 Join 或健康检查重新加入
+func (p *HTTPPool) leave(peer string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	h, ok := p.health[peer]
+	if !ok || h.ejected {
+		return
+	}
+
+	p.peers.Remove(peer)
+	h.ejected = true
+	h.lastError = "left the pool"
+	h.lastCheck = time.Now()
+	h.retryAt = h.lastCheck
+	p.Log("Peer %s left", peer)
+	p.startHandoff()
+}
+
+// join 把宣告加入的节点重新加入哈希环，不在HTTP池中的节点由节点发现决定是否加入
+func (p *HTTPPool) join(peer string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	h, ok := p.health[peer]
+	if !ok || !h.ejected {
+		return
+	}
+
+	h.failures = 0
+	h.ejections = 0
+	h.lastError = ""
+	h.lastCheck = time.Now()
+	p.Log("Peer %s joined", peer)
+	p.readmit(peer, h)
+}
+
+// Close 关闭Group，之后缓存命中的 Get 仍然正常返回
+// 未命中缓存的 Get 与 Set 返回 ErrGroupClosed；等待进行中的加载完成，
+// 再写入write-behind模式下待写入的数据。ctx 结束时不再等待并返回 ctx.Err()
+func (g *Group) Close(ctx context.Context) error {
+	g.closeMu.Lock()
+	g.closed = true
+	g.closeMu.Unlock()
+
+	if err := wait(ctx, &g.loading); err != nil {
+		return err
+	}
+
+	if err := g.Flush(ctx); err != nil {
+		return err
+	}
+
+	if g.writer != nil {
+		g.writer.stop()
+	}
+
+	return nil
+}
+
+// startLoad 开始一次加载，Group 关闭后返回false
+func (g *Group) startLoad() bool {
+	g.closeMu.Lock()
+	defer g.closeMu.Unlock()
+
+	if g.closed {
+		return false
+	}
+
+	g.loading.Add(1)
+	return true
+}
+
+func (g *Group) isClosed() bool {
+	g.closeMu.Lock()
+	defer g.closeMu.Unlock()
+	return g.closed
+}
+
+// wait 等待wg完成，ctx结束时返回ctx.Err()
+func wait(ctx context.Context, wg *sync.WaitGroup) error {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
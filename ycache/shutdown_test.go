@@ -0,0 +1,176 @@
+package ycache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPoolShutdown(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	NewGroup("shutdown", 2<<10, GetterFunc(func(ctx context.Context, key string) ([]byte, error) {
+		close(started)
+		<-release
+		return []byte("slow"), nil
+	}))
+
+	var leaving, staying *HTTPPool
+	leavingSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { leaving.ServeHTTP(w, r) }))
+	defer leavingSrv.Close()
+	stayingSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { staying.ServeHTTP(w, r) }))
+	defer stayingSrv.Close()
+
+	leaving = NewHTTPPool(leavingSrv.URL)
+	leaving.Set(leavingSrv.URL, stayingSrv.URL)
+	staying = NewHTTPPool(stayingSrv.URL)
+	defer close(staying.done)
+	staying.Set(leavingSrv.URL, stayingSrv.URL)
+
+	// 进行中的请求在 Shutdown 期间完成
+	slow := make(chan string)
+	go func() {
+		resp, err := http.Get(leavingSrv.URL + "/_ycache/shutdown/key")
+		if err != nil {
+			slow <- err.Error()
+			return
+		}
+		ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		slow <- resp.Status
+	}()
+	<-started
+
+	done := make(chan error)
+	go func() { done <- leaving.Shutdown(context.Background()) }()
+
+	select {
+	case err := <-done:
+		t.Fatalf("Shutdown returned %v before the in-flight request finished", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if got := <-slow; got != "200 OK" {
+		t.Fatalf("in-flight request = %q", got)
+	}
+
+	if s := peerStatus(staying, leavingSrv.URL); s.Healthy {
+		t.Fatalf("departed peer is still healthy: %+v", s)
+	}
+	if g, ok := staying.PickPeer("key"); ok {
+		t.Fatalf("key is routed to %s after the peer left", g.(*httpGetter).peer)
+	}
+
+	resp, err := http.Get(leavingSrv.URL + "/_ycache/_health")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("health check after Shutdown: %s, want 503", resp.Status)
+	}
+}
+
+func TestGroupClose(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	g := NewGroup("group-close", 2<<10, GetterFunc(func(ctx context.Context, key string) ([]byte, error) {
+		if key == "slow" {
+			close(started)
+			<-release
+		}
+		return []byte("v-" + key), nil
+	}))
+	store := newFakeStore()
+	g.RegisterSetter(store, &WriteOptions{Mode: WriteBehind, FlushInterval: time.Hour})
+
+	ctx := context.Background()
+	if err := g.Set(ctx, "written", []byte("w")); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := make(chan error)
+	go func() {
+		_, err := g.Get(ctx, "slow")
+		loaded <- err
+	}()
+	<-started
+
+	timeout, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if err := g.Close(timeout); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Close with an in-flight load = %v, want DeadlineExceeded", err)
+	}
+
+	if _, err := g.Get(ctx, "other"); !errors.Is(err, ErrGroupClosed) {
+		t.Errorf("Get after Close = %v, want ErrGroupClosed", err)
+	}
+	if err := g.Set(ctx, "other", []byte("o")); !errors.Is(err, ErrGroupClosed) {
+		t.Errorf("Set after Close = %v, want ErrGroupClosed", err)
+	}
+	if v, err := g.Get(ctx, "written"); err != nil || v.String() != "w" {
+		t.Errorf("cached Get after Close = %q, %v", v.String(), err)
+	}
+
+	close(release)
+	if err := <-loaded; err != nil {
+		t.Fatalf("in-flight load = %v", err)
+	}
+
+	if err := g.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := store.get("written"); !ok || v != "w" {
+		t.Fatalf("pending write was not flushed: %q, %v", v, ok)
+	}
+}
+
+func TestPoolRejoin(t *testing.T) {
+	var leaving, staying *HTTPPool
+	leavingSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { leaving.ServeHTTP(w, r) }))
+	defer leavingSrv.Close()
+	stayingSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { staying.ServeHTTP(w, r) }))
+	defer stayingSrv.Close()
+
+	// 没有主动健康检查，离开的节点只能通过 Join 重新加入
+	leaving = NewHTTPPool(leavingSrv.URL)
+	leaving.Set(leavingSrv.URL, stayingSrv.URL)
+	staying = NewHTTPPool(stayingSrv.URL)
+	defer close(staying.done)
+	staying.Set(leavingSrv.URL, stayingSrv.URL)
+
+	if err := leaving.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if s := peerStatus(staying, leavingSrv.URL); s.Healthy {
+		t.Fatalf("departed peer is still healthy: %+v", s)
+	}
+
+	// 节点以相同的地址重启，节点发现给出的列表不变
+	restarted := NewHTTPPool(leavingSrv.URL)
+	defer close(restarted.done)
+	restarted.Set(leavingSrv.URL, stayingSrv.URL)
+	leaving = restarted
+	restarted.Join(context.Background())
+
+	if s := peerStatus(staying, leavingSrv.URL); !s.Healthy {
+		t.Fatalf("restarted peer was not readmitted: %+v", s)
+	}
+
+	routed := false
+	for i := 0; i < 100 && !routed; i++ {
+		if g, ok := staying.pickPeer(fmt.Sprintf("key-%d", i)); ok && g.(*httpGetter).peer == leavingSrv.URL {
+			routed = true
+		}
+	}
+	if !routed {
+		t.Fatal("no key is routed to the restarted peer")
+	}
+}
@@ -0,0 +1,280 @@
+package ycache
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// 快照格式，整数均为大端序，长度与时间戳为varint：
+//
+//	magic    "YCSN"
+//	version  uint16
+//	group    uvarint长度 + 名称
+//	gen      uvarint，写入快照时Group的generation
+//	count    uvarint
+//	entries  count个 {
+//	           key:    uvarint长度 + 内容
+//	           value:  uvarint长度 + 内容
+//	           expire: varint纳秒时间戳
+//	           tags:   uvarint个数 + 每个标签的 uvarint长度 + 内容
+//	         }
+//	checksum uint32，之前所有字节的 CRC-32 (IEEE)
+const (
+	snapshotMagic   = "YCSN"
+	snapshotVersion = 3
+	maxSnapshotLen  = 1 << 30 // 单个key或value的最大长度
+)
+
+// ErrCorruptSnapshot 快照格式错误或校验和不一致
+var ErrCorruptSnapshot = errors.New("ycache: corrupt snapshot")
+
+// Snapshot 把缓存中的数据按从热到冷的顺序写入w
+// 只保存访问次数达到K次的数据，已过期或属于旧generation的数据不会写入
+func (g *Group) Snapshot(w io.Writer) error {
+	gen := g.Generation()
+	all, values := g.mainCache.hottest(0)
+
+	var keys []string
+	for i, key := range all {
+		if values[i].gen >= gen {
+			keys = append(keys, key)
+			values[len(keys)-1] = values[i]
+		}
+	}
+
+	crc := crc32.NewIEEE()
+	bw := bufio.NewWriter(io.MultiWriter(w, crc))
+
+	bw.WriteString(snapshotMagic)
+	binary.Write(bw, binary.BigEndian, uint16(snapshotVersion))
+	writeBytes(bw, []byte(g.name))
+	writeUvarint(bw, gen)
+	writeUvarint(bw, uint64(len(keys)))
+
+	for i, key := range keys {
+		writeBytes(bw, []byte(key))
+		writeBytes(bw, values[i].data)
+		writeVarint(bw, unixNano(values[i].expire))
+		writeUvarint(bw, uint64(len(values[i].tags)))
+		for _, tag := range values[i].tags {
+			writeBytes(bw, []byte(tag))
+		}
+	}
+
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+
+	return binary.Write(w, binary.BigEndian, crc.Sum32())
+}
+
+// Restore 从r读取 Snapshot 写入的数据并加入缓存
+// 校验通过后才会修改缓存，已过期的数据会被忽略
+func (g *Group) Restore(r io.Reader) error {
+	sr := &snapshotReader{r: bufio.NewReader(r), crc: crc32.NewIEEE()}
+
+	magic, err := sr.readN(len(snapshotMagic))
+	if err != nil {
+		return err
+	}
+	if string(magic) != snapshotMagic {
+		return ErrCorruptSnapshot
+	}
+
+	version, err := sr.readN(2)
+	if err != nil {
+		return err
+	}
+	if v := binary.BigEndian.Uint16(version); v != snapshotVersion {
+		return fmt.Errorf("ycache: unsupported snapshot version %d", v)
+	}
+
+	name, err := sr.readBytes()
+	if err != nil {
+		return err
+	}
+	if string(name) != g.name {
+		return fmt.Errorf("ycache: snapshot of group %q cannot be restored into %q", name, g.name)
+	}
+
+	gen, err := binary.ReadUvarint(sr)
+	if err != nil {
+		return sr.corrupt(err)
+	}
+
+	count, err := binary.ReadUvarint(sr)
+	if err != nil {
+		return sr.corrupt(err)
+	}
+
+	var keys []string
+	var values []ByteView
+	for i := uint64(0); i < count; i++ {
+		key, err := sr.readBytes()
+		if err != nil {
+			return err
+		}
+
+		value, err := sr.readBytes()
+		if err != nil {
+			return err
+		}
+
+		expire, err := binary.ReadVarint(sr)
+		if err != nil {
+			return sr.corrupt(err)
+		}
+
+		n, err := binary.ReadUvarint(sr)
+		if err != nil {
+			return sr.corrupt(err)
+		}
+		if n > maxSnapshotLen {
+			return ErrCorruptSnapshot
+		}
+
+		var tags []string
+		for j := uint64(0); j < n; j++ {
+			tag, err := sr.readBytes()
+			if err != nil {
+				return err
+			}
+			tags = append(tags, string(tag))
+		}
+
+		keys = append(keys, string(key))
+		values = append(values, ByteView{data: value, expire: fromUnixNano(expire), gen: gen, tags: tags})
+	}
+
+	var sum uint32
+	if err := binary.Read(sr.r, binary.BigEndian, &sum); err != nil {
+		return sr.corrupt(err)
+	}
+	if sum != sr.crc.Sum32() {
+		return ErrCorruptSnapshot
+	}
+
+	// 快照之后generation已经增加时，快照中的数据全部失效
+	g.observeGeneration(gen)
+	if gen < g.Generation() {
+		return nil
+	}
+
+	now := time.Now()
+	for i, key := range keys {
+		if !values[i].expired(now) {
+			g.mainCache.restore(key, values[i])
+		}
+	}
+
+	return nil
+}
+
+// SnapshotFile 把缓存中的数据写入文件，先写入临时文件再替换，避免留下不完整的快照
+// 每次写入使用不同的临时文件，同时进行的快照不会互相覆盖
+func (g *Group) SnapshotFile(path string) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+
+	if err := g.Snapshot(f); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+// RestoreFile 从 SnapshotFile 写入的文件中恢复缓存
+func (g *Group) RestoreFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return g.Restore(f)
+}
+
+func writeUvarint(w *bufio.Writer, v uint64) {
+	var buf [binary.MaxVarintLen64]byte
+	w.Write(buf[:binary.PutUvarint(buf[:], v)])
+}
+
+func writeVarint(w *bufio.Writer, v int64) {
+	var buf [binary.MaxVarintLen64]byte
+	w.Write(buf[:binary.PutVarint(buf[:], v)])
+}
+
+func writeBytes(w *bufio.Writer, b []byte) {
+	writeUvarint(w, uint64(len(b)))
+	w.Write(b)
+}
+
+// snapshotReader 读取快照并计算已读取内容的校验和
+type snapshotReader struct {
+	r   *bufio.Reader
+	crc hash.Hash32
+}
+
+func (s *snapshotReader) ReadByte() (byte, error) {
+	b, err := s.r.ReadByte()
+	if err == nil {
+		s.crc.Write([]byte{b})
+	}
+	return b, err
+}
+
+func (s *snapshotReader) readN(n int) ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := io.CopyN(&buf, s.r, int64(n)); err != nil {
+		return nil, s.corrupt(err)
+	}
+
+	s.crc.Write(buf.Bytes())
+	return buf.Bytes(), nil
+}
+
+func (s *snapshotReader) readBytes() ([]byte, error) {
+	n, err := binary.ReadUvarint(s)
+	if err != nil {
+		return nil, s.corrupt(err)
+	}
+	if n > maxSnapshotLen {
+		return nil, ErrCorruptSnapshot
+	}
+
+	return s.readN(int(n))
+}
+
+// corrupt 快照提前结束时返回 ErrCorruptSnapshot，其他读取错误原样返回
+func (s *snapshotReader) corrupt(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return ErrCorruptSnapshot
+	}
+	return err
+}
@@ -0,0 +1,170 @@
+package ycache
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newSnapshotGroup(name string) *Group {
+	return NewGroup(name, 2<<10, GetterFunc(func(ctx context.Context, key string) ([]byte, error) {
+		return []byte("origin"), nil
+	}))
+}
+
+func TestSnapshotRestore(t *testing.T) {
+	src := newSnapshotGroup("snapshot")
+	expire := time.Now().Add(time.Hour).Round(0)
+	warm(src, "forever", "1")
+	src.populateCache("ttl", ByteView{data: []byte("2"), expire: expire})
+	for i := 0; i < 3; i++ {
+		src.mainCache.get("ttl", 0)
+	}
+	src.populateCache("expired", ByteView{data: []byte("3"), expire: time.Now().Add(time.Millisecond)})
+	for i := 0; i < 3; i++ {
+		src.mainCache.get("expired", 0)
+	}
+
+	var buf bytes.Buffer
+	time.Sleep(2 * time.Millisecond)
+	if err := src.Snapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	// 同名的Group在重启后恢复数据
+	dst := newSnapshotGroup("snapshot")
+	if err := dst.Restore(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if v, ok := dst.peek("forever"); !ok || v.String() != "1" || !v.Expire().IsZero() {
+		t.Fatalf("forever = %q, %v, %v", v.String(), v.Expire(), ok)
+	}
+
+	if v, ok := dst.peek("ttl"); !ok || v.String() != "2" || !v.Expire().Equal(expire) {
+		t.Fatalf("ttl = %q, %v, %v; want expire %v", v.String(), v.Expire(), ok, expire)
+	}
+
+	if _, ok := dst.peek("expired"); ok {
+		t.Fatal("expired entry was restored")
+	}
+}
+
+func TestRestoreCorrupt(t *testing.T) {
+	g := newSnapshotGroup("snapshot-corrupt")
+	warm(g, "key", "value")
+
+	var buf bytes.Buffer
+	if err := g.Snapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	flipped := append([]byte(nil), data...)
+	flipped[len(flipped)-6] ^= 0xff
+
+	for name, b := range map[string][]byte{
+		"flipped":   flipped,
+		"truncated": data[:len(data)-1],
+		"empty":     nil,
+	} {
+		dst := newSnapshotGroup("snapshot-corrupt-" + name)
+		if err := dst.Restore(bytes.NewReader(b)); err == nil {
+			t.Fatalf("%s: Restore succeeded", name)
+		}
+
+		if _, ok := dst.peek("key"); ok {
+			t.Fatalf("%s: corrupt snapshot was partially restored", name)
+		}
+	}
+
+	// 快照只能恢复到同名的Group
+	if err := newSnapshotGroup("other").Restore(bytes.NewReader(data)); err == nil {
+		t.Fatal("snapshot restored into another group")
+	}
+}
+
+func TestSnapshotFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "names.snap")
+
+	g := newSnapshotGroup("snapshot-file")
+	warm(g, "key", "value")
+	if err := g.SnapshotFile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := newSnapshotGroup("snapshot-file")
+	if err := dst.RestoreFile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	if v, ok := dst.peek("key"); !ok || v.String() != "value" {
+		t.Fatalf("key = %q, %v", v.String(), ok)
+	}
+}
+
+func TestSnapshotAfterRestore(t *testing.T) {
+	src := newSnapshotGroup("snapshot-again")
+	warm(src, "a", "1")
+	warm(src, "b", "2")
+
+	var buf bytes.Buffer
+	if err := src.Snapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := newSnapshotGroup("snapshot-again")
+	if err := dst.Restore(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	// 恢复后没有再被访问的数据同样出现在下一次快照中
+	keys, _ := dst.mainCache.hottest(0)
+	sort.Strings(keys)
+	if strings.Join(keys, ",") != "a,b" {
+		t.Fatalf("keys in the next snapshot = %v, want a and b", keys)
+	}
+}
+
+func TestSnapshotFileConcurrent(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "concurrent.snap")
+
+	g := newSnapshotGroup("snapshot-concurrent")
+	for i := 0; i < 100; i++ {
+		warm(g, fmt.Sprintf("key-%d", i), strings.Repeat("v", 10))
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- g.SnapshotFile(path)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dst := newSnapshotGroup("snapshot-concurrent")
+	if err := dst.RestoreFile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	if files, _ := filepath.Glob(filepath.Join(dir, "*.tmp")); len(files) != 0 {
+		t.Fatalf("temporary files were left behind: %v", files)
+	}
+}
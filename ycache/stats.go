@@ -0,0 +1,47 @@
+package ycache
+
+import (
+	"strconv"
+	"sync/atomic"
+)
+
+// Stats Group的统计信息
+type Stats struct {
+	Gets           AtomicInt // 所有 Get 请求，包括来自其他节点的请求
+	CacheHits      AtomicInt // 本地缓存命中
+	Loads          AtomicInt // 缓存未命中后的加载 (gets - cacheHits)
+	LoadsDeduped   AtomicInt // 合并并发请求之后实际执行的加载
+	PeerLoads      AtomicInt // 从远程节点加载成功
+	PeerErrors     AtomicInt // 从远程节点加载失败
+	LocalLoads     AtomicInt // 回源加载成功
+	LocalLoadErrs  AtomicInt // 回源加载失败
+	ServerRequests AtomicInt // 来自其他节点的请求
+}
+
+// CacheStats 本地缓存的统计信息
+type CacheStats struct {
+	Items     int64 `json:"items"`     // 内存中的key数，包括访问次数不足K次的key
+	Evictions int64 `json:"evictions"` // 从内存中淘汰的key数
+}
+
+// AtomicInt 可以原子地读写的int64
+type AtomicInt int64
+
+// Add 原子地增加n
+func (i *AtomicInt) Add(n int64) {
+	atomic.AddInt64((*int64)(i), n)
+}
+
+// Get 原子地读取
+func (i *AtomicInt) Get() int64 {
+	return atomic.LoadInt64((*int64)(i))
+}
+
+func (i *AtomicInt) String() string {
+	return strconv.FormatInt(i.Get(), 10)
+}
+
+// CacheStats 返回本地缓存的统计信息
+func (g *Group) CacheStats() CacheStats {
+	return g.mainCache.stats()
+}
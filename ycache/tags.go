@@ -0,0 +1,107 @@
+package ycache
+
+import (
+	pb "7days/ycache/ycachepb"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Entry Getter 加载得到的数据及其标签与过期时间
+type Entry struct {
+	Value []byte
+	Tags  []string // 数据的标签，InvalidateTag 会删除带有该标签的所有数据
+
+	// Expire 过期时间，零值表示永不过期。
+	// 不晚于当前时间时数据只返回给调用方，不放入缓存。
+	Expire time.Time
+}
+
+// EntryGetter 可选接口，Getter 实现该接口时可以为加载的数据设置标签
+type EntryGetter interface {
+	GetEntry(ctx context.Context, key string) (Entry, error)
+}
+
+// EntryGetterFunc 用以实现 Getter 与 EntryGetter 的方法
+type EntryGetterFunc func(ctx context.Context, key string) (Entry, error)
+
+func (f EntryGetterFunc) Get(ctx context.Context, key string) ([]byte, error) {
+	e, err := f(ctx, key)
+	return e.Value, err
+}
+
+func (f EntryGetterFunc) GetEntry(ctx context.Context, key string) (Entry, error) {
+	return f(ctx, key)
+}
+
+// getEntry 从回调函数中加载数据及其标签
+func (g *Group) getEntry(ctx context.Context, key string) (Entry, error) {
+	if e, ok := g.getter.(EntryGetter); ok {
+		return e.GetEntry(ctx, key)
+	}
+
+	value, err := g.getter.Get(ctx, key)
+	return Entry{Value: value}, err
+}
+
+// InvalidateTag 删除所有节点上带有tag的数据，返回删除的数量
+// 通知失败的节点上的数据不会被删除，返回的错误中包含失败的节点数
+func (g *Group) InvalidateTag(ctx context.Context, tag string) (int64, error) {
+	removed := g.invalidateTagLocally(tag)
+
+	lister, ok := g.peers.(PeerLister)
+	if !ok {
+		return removed, nil
+	}
+
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		failed int
+		last   error
+	)
+
+	peers := lister.ListPeers()
+	for _, peer := range peers {
+		inv, ok := peer.(TagInvalidator)
+		if !ok {
+			continue
+		}
+
+		wg.Add(1)
+		go func(inv TagInvalidator) {
+			defer wg.Done()
+
+			resp := &pb.InvalidateResponse{}
+			err := inv.InvalidateTag(ctx, &pb.InvalidateRequest{Group: g.name, Tag: tag}, resp)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				failed++
+				last = err
+				return
+			}
+			removed += resp.GetRemoved()
+		}(inv)
+	}
+	wg.Wait()
+
+	if failed > 0 {
+		return removed, fmt.Errorf("failed to notify %d of %d peers: %v", failed, len(peers), last)
+	}
+
+	return removed, nil
+}
+
+// invalidateTagLocally 删除本节点上带有tag的数据
+func (g *Group) invalidateTagLocally(tag string) int64 {
+	keys := g.mainCache.removeTag(tag)
+	for _, key := range keys {
+		g.publish(Event{Type: EventRemove, Key: key, Tag: tag})
+	}
+	g.publish(Event{Type: EventTag, Tag: tag})
+
+	return int64(len(keys))
+}
@@ -0,0 +1,158 @@
+package ycache
+
+import (
+	pb "7days/ycache/ycachepb"
+	"bytes"
+	"context"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// rowGetter 以"row1:"开头的key都由第一行数据派生，带有标签 row1
+func rowGetter(loads *int32) EntryGetterFunc {
+	return func(ctx context.Context, key string) (Entry, error) {
+		atomic.AddInt32(loads, 1)
+		row := strings.SplitN(key, ":", 2)[0]
+		return Entry{Value: []byte(key), Tags: []string{row}}, nil
+	}
+}
+
+func TestInvalidateTag(t *testing.T) {
+	var loads int32
+	g := NewGroup("tags", 2<<10, rowGetter(&loads))
+
+	ctx := context.Background()
+	for _, key := range []string{"row1:a", "row1:b", "row2:a"} {
+		g.Get(ctx, key)
+	}
+
+	removed, err := g.InvalidateTag(ctx, "row1")
+	if err != nil || removed != 2 {
+		t.Fatalf("InvalidateTag = %d, %v; want 2", removed, err)
+	}
+
+	// 带有标签的数据重新加载，其他数据仍然命中缓存
+	for _, key := range []string{"row1:a", "row1:b", "row2:a"} {
+		if v, err := g.Get(ctx, key); err != nil || v.String() != key {
+			t.Fatalf("Get(%s) = %q, %v", key, v.String(), err)
+		}
+	}
+
+	if loads != 5 {
+		t.Fatalf("loaded %d times, want 5", loads)
+	}
+
+	// 索引中已经没有被删除的key
+	if removed, _ := g.InvalidateTag(ctx, "row1"); removed != 2 {
+		t.Fatalf("second InvalidateTag removed %d, want 2", removed)
+	}
+}
+
+func TestInvalidateTagDuringLoad(t *testing.T) {
+	var loads int32
+	loading, release := make(chan struct{}), make(chan struct{})
+	g := NewGroup("tags-race", 2<<10, EntryGetterFunc(func(ctx context.Context, key string) (Entry, error) {
+		if atomic.AddInt32(&loads, 1) == 1 {
+			close(loading)
+			<-release
+		}
+		return Entry{Value: []byte("v"), Tags: []string{"row"}}, nil
+	}))
+
+	done := make(chan struct{})
+	go func() {
+		g.Get(context.Background(), "key")
+		close(done)
+	}()
+
+	// 加载期间删除标签，加载得到的旧数据不能进入缓存
+	<-loading
+	g.InvalidateTag(context.Background(), "row")
+	close(release)
+	<-done
+
+	g.Get(context.Background(), "key")
+	if loads != 2 {
+		t.Fatalf("loaded %d times, want 2", loads)
+	}
+}
+
+// fakeInvalidator 记录收到的标签
+type fakeInvalidator struct {
+	fakePeer
+	tags []string
+}
+
+func (f *fakeInvalidator) InvalidateTag(ctx context.Context, in *pb.InvalidateRequest, out *pb.InvalidateResponse) error {
+	f.tags = append(f.tags, in.GetTag())
+	out.Removed = 3
+	return nil
+}
+
+func TestInvalidateTagBroadcast(t *testing.T) {
+	var loads int32
+	g := NewGroup("tags-broadcast", 2<<10, rowGetter(&loads))
+
+	peer := &fakeInvalidator{}
+	g.RegisterPeers(&listPicker{peers: []PeerGetter{peer}})
+	g.Get(context.Background(), "row1:a")
+
+	removed, err := g.InvalidateTag(context.Background(), "row1")
+	if err != nil || removed != 4 {
+		t.Fatalf("InvalidateTag = %d, %v; want 4", removed, err)
+	}
+
+	if len(peer.tags) != 1 || peer.tags[0] != "row1" {
+		t.Fatalf("peer received %v", peer.tags)
+	}
+}
+
+func TestHTTPInvalidateTag(t *testing.T) {
+	var loads int32
+	g := NewGroup("tags-http", 2<<10, rowGetter(&loads))
+	g.Get(context.Background(), "row1:a")
+
+	p := NewHTTPPool("http://self")
+	srv := httptest.NewServer(p)
+	defer srv.Close()
+
+	out := &pb.InvalidateResponse{}
+	inv := p.Getter(srv.URL).(TagInvalidator)
+	if err := inv.InvalidateTag(context.Background(), &pb.InvalidateRequest{Group: "tags-http", Tag: "row1"}, out); err != nil {
+		t.Fatal(err)
+	}
+
+	if out.Removed != 1 {
+		t.Fatalf("removed %d, want 1", out.Removed)
+	}
+
+	if _, ok := g.peek("row1:a"); ok {
+		t.Fatal("invalidated key is still cached")
+	}
+}
+
+func TestSnapshotKeepsTags(t *testing.T) {
+	var loads int32
+	src := NewGroup("tags-snapshot", 2<<10, rowGetter(&loads))
+	warm(src, "key", "value")
+	src.populateCache("tagged", ByteView{data: []byte("v"), tags: []string{"row1"}})
+	for i := 0; i < 3; i++ {
+		src.mainCache.get("tagged", 0)
+	}
+
+	var buf bytes.Buffer
+	if err := src.Snapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := NewGroup("tags-snapshot", 2<<10, rowGetter(&loads))
+	if err := dst.Restore(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if removed, _ := dst.InvalidateTag(context.Background(), "row1"); removed != 1 {
+		t.Fatalf("restored entry lost its tags, removed %d", removed)
+	}
+}
@@ -0,0 +1,130 @@
+// Package tcpserver 实现文本协议前端（memcache、resp）共用的TCP监听与连接管理
+package tcpserver
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+)
+
+// Server 接受连接并交给 handler 处理，记录所有监听与连接以便 Close 时一并关闭
+type Server struct {
+	conns int64 // 当前连接数，通过原子操作读写
+	total int64 // 累计连接数
+
+	handler   func(conn net.Conn)
+	closedErr error
+
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	clients   map[net.Conn]struct{}
+	closed    bool
+}
+
+// New 创建服务端，每个连接在单独的goroutine中交给 handler 处理，handler 返回后连接被关闭
+// Server 关闭后 Serve 返回 closedErr
+func New(handler func(conn net.Conn), closedErr error) *Server {
+	return &Server{
+		handler:   handler,
+		closedErr: closedErr,
+		listeners: make(map[net.Listener]struct{}),
+		clients:   make(map[net.Conn]struct{}),
+	}
+}
+
+// ListenAndServe 监听TCP地址addr并处理连接
+func (s *Server) ListenAndServe(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	return s.Serve(ln)
+}
+
+// Serve 接受ln上的连接并处理，直到 Close 被调用
+func (s *Server) Serve(ln net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		ln.Close()
+		return s.closedErr
+	}
+	s.listeners[ln] = struct{}{}
+	s.mu.Unlock()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			delete(s.listeners, ln)
+			s.mu.Unlock()
+
+			if closed {
+				return s.closedErr
+			}
+			return err
+		}
+
+		if !s.track(conn) {
+			conn.Close()
+			return s.closedErr
+		}
+
+		go func() {
+			defer s.untrack(conn)
+			defer conn.Close()
+			s.handler(conn)
+		}()
+	}
+}
+
+// Close 关闭所有监听与连接
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	for ln := range s.listeners {
+		ln.Close()
+	}
+	for conn := range s.clients {
+		conn.Close()
+	}
+
+	return nil
+}
+
+// Conns 返回当前连接数
+func (s *Server) Conns() int64 {
+	return atomic.LoadInt64(&s.conns)
+}
+
+// Total 返回累计连接数
+func (s *Server) Total() int64 {
+	return atomic.LoadInt64(&s.total)
+}
+
+// track 记录新的连接，Server 已关闭时返回false
+func (s *Server) track(conn net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return false
+	}
+
+	s.clients[conn] = struct{}{}
+	atomic.AddInt64(&s.conns, 1)
+	atomic.AddInt64(&s.total, 1)
+	return true
+}
+
+func (s *Server) untrack(conn net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.clients, conn)
+	atomic.AddInt64(&s.conns, -1)
+}
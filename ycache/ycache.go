@@ -1,14 +1,58 @@
 package ycache
 
 import (
+	"7days/ycache/circuit"
+	"7days/ycache/disk"
 	"7days/ycache/singleflight"
 	pb "7days/ycache/ycachepb"
 	"context"
 	"errors"
 	"log"
+	"sort"
 	"sync"
 )
 
+// ErrNotFound Getter 在key不存在时返回该错误（或包装了该错误的错误），
+// 使调用方能区分key不存在与加载失败，且其他节点不会再次回源
+var ErrNotFound = errors.New("ycache: key not found")
+
+// Source 数据的来源
+type Source int
+
+const (
+	// SourceCache 本地缓存（包括磁盘）
+	SourceCache Source = iota
+	// SourcePeer 负责该key的远程节点
+	SourcePeer
+	// SourceLoad 本节点回源加载
+	SourceLoad
+)
+
+func (s Source) String() string {
+	switch s {
+	case SourceCache:
+		return "cache"
+	case SourcePeer:
+		return "peer"
+	case SourceLoad:
+		return "load"
+	}
+
+	return "unknown"
+}
+
+// CacheStatus 返回HTTP前端 X-Cache 响应头的值：HIT 本地缓存，PEER 其他节点，MISS 回源加载
+func (s Source) CacheStatus() string {
+	switch s {
+	case SourceCache:
+		return "HIT"
+	case SourcePeer:
+		return "PEER"
+	}
+
+	return "MISS"
+}
+
 // Getter 从key中加载数据
 // 作为Group未命中数据时的回调函数
 type Getter interface {
@@ -24,6 +68,11 @@ func (f GetterFunc) Get(ctx context.Context, key string) ([]byte, error) {
 
 // Group 每个group都是cache的命名空间，并加载相关数据
 type Group struct {
+	generation uint64 // 放在最前面以保证原子操作的对齐，见 generation.go
+
+	// Stats 统计信息，同样需要64位对齐
+	Stats Stats
+
 	name      string
 	getter    Getter
 	mainCache cache
@@ -31,6 +80,18 @@ type Group struct {
 
 	// use singleflight.Group to make sure that eache key is only fetched once
 	loader *singleflight.Group
+
+	writer *writer // 写入后端存储，为nil时 Set 只更新缓存
+
+	events *eventLog // 数据变化的事件，见 events.go
+
+	retryMu  sync.Mutex
+	retry    RetryPolicy
+	breakers map[PeerGetter]*circuit.Breaker // 每个节点的熔断器
+
+	closeMu sync.Mutex
+	closed  bool           // 关闭后不再开始新的加载，见 shutdown.go
+	loading sync.WaitGroup // 进行中的加载
 }
 
 var (
@@ -52,6 +113,8 @@ func NewGroup(name string, cacheBytes int, getter Getter) *Group {
 		getter:    getter,
 		mainCache: cache{cacheBytes: cacheBytes},
 		loader:    &singleflight.Group{},
+		retry:     RetryPolicy{}.withDefaults(),
+		events:    newEventLog(defaultEventBuffer),
 	}
 
 	groups[name] = g
@@ -67,15 +130,43 @@ func GetGroup(name string) *Group {
 	return g
 }
 
+// GroupNames 返回所有Group的名称，按字母顺序排列
+func GroupNames() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Name 返回Group的名称
+func (g *Group) Name() string {
+	return g.name
+}
+
 func (g *Group) Get(ctx context.Context, key string) (ByteView, error) {
+	value, _, err := g.GetWithSource(ctx, key)
+	return value, err
+}
+
+// GetWithSource 与 Get 相同，同时返回数据的来源
+func (g *Group) GetWithSource(ctx context.Context, key string) (ByteView, Source, error) {
 	if key == "" {
-		return ByteView{}, errors.New("key is requeired")
+		return ByteView{}, SourceCache, errors.New("key is requeired")
 	}
 
+	g.Stats.Gets.Add(1)
+
 	// 缓存中获取
-	if value, hit := g.mainCache.get(key); hit {
+	if value, hit := g.mainCache.get(key, g.Generation()); hit {
 		log.Println("[ycache] mainCache.get hit")
-		return value, nil
+		g.Stats.CacheHits.Add(1)
+		return value, SourceCache, nil
 	}
 
 	// 本地加载数据
@@ -91,45 +182,123 @@ func (g *Group) RegisterPeers(peers PeerPicker) {
 	g.peers = peers
 }
 
+// SetDiskStore 设置磁盘存储作为第二层缓存
+// 从内存中淘汰的数据写入磁盘，内存未命中时先查询磁盘，之后才查询远程节点或回源
+func (g *Group) SetDiskStore(store *disk.Store) {
+	g.mainCache.setDisk(store)
+}
+
+// loadResult 合并的并发请求共享的加载结果
+type loadResult struct {
+	value  ByteView
+	source Source
+}
+
 // 加载数据
-func (g *Group) load(ctx context.Context, key string) (value ByteView, err error) {
+func (g *Group) load(ctx context.Context, key string) (ByteView, Source, error) {
+	// 加载开始前的generation，加载期间generation增加时结果不会被当作新的数据
+	gen := g.Generation()
+	g.Stats.Loads.Add(1)
+
+	if !g.startLoad() {
+		return ByteView{}, SourceLoad, ErrGroupClosed
+	}
+	defer g.loading.Done()
+
 	// each key is only fetched once (either locally or remotely)
 	// regardless of the number of concurrent callers.
-	view, err := g.loader.Do(key, func() (interface{}, error) {
+	res, err := g.loader.Do(key, func() (interface{}, error) {
+		g.Stats.LoadsDeduped.Add(1)
+
 		if g.peers != nil {
-			// 如果有远程节点。从远程节点中加载数据
-			if peer, ok := g.peers.PickPeer(key); ok {
-				if value, err = g.getFromPeer(ctx, peer, key); err == nil {
-					return value, nil
+			// 如果有远程节点。从远程节点中加载数据，失败时按重试策略尝试其他副本
+			if peers := g.pickPeers(key, g.retryPolicy()); len(peers) > 0 {
+				value, err := g.getFromPeers(ctx, peers, key)
+				if err == nil {
+					g.Stats.PeerLoads.Add(1)
+					return loadResult{value, SourcePeer}, nil
 				}
 
+				// 负责该key的节点已经回源，key确实不存在
+				if errors.Is(err, ErrNotFound) {
+					return nil, err
+				}
+
+				g.Stats.PeerErrors.Add(1)
 				log.Println("[YCache] Failed to get from peer", err)
 			}
+
+			// 迁移期间先查询旧的负责节点，避免回源
+			if value, ok := g.getFromFallback(ctx, key, gen); ok {
+				return loadResult{value, SourcePeer}, nil
+			}
 		}
 
-		return g.getLocally(ctx, key)
+		if t, ok := g.peers.(loadTracker); ok {
+			defer t.trackLocal()()
+		}
+
+		value, err := g.getLocally(ctx, key, gen)
+		if err != nil {
+			return nil, err
+		}
+		return loadResult{value, SourceLoad}, nil
 	})
 
-	if err == nil {
-		return view.(ByteView), err
+	if err != nil {
+		return ByteView{}, SourceLoad, err
 	}
 
-	return
+	r := res.(loadResult)
+	return r.value, r.source, nil
 }
 
 // 从回调函数中加入数据
-func (g *Group) getLocally(ctx context.Context, key string) (ByteView, error) {
-	bytes, err := g.getter.Get(ctx, key)
+func (g *Group) getLocally(ctx context.Context, key string, gen uint64) (ByteView, error) {
+	token := g.mainCache.startLoad(key)
+	entry, err := g.getEntry(ctx, key)
 	if err != nil {
+		g.Stats.LocalLoadErrs.Add(1)
 		return ByteView{}, err
 	}
+	g.Stats.LocalLoads.Add(1)
 
-	value := ByteView{data: cloneBytes(bytes)}
-	g.populateCache(key, value)
+	value := ByteView{data: cloneBytes(entry.Value), expire: entry.Expire, gen: gen, tags: entry.Tags}
+	g.mainCache.addLoaded(key, value, token)
 
 	return value, nil
 }
 
+// getFromFallback 查询key在迁移前的负责节点的缓存
+func (g *Group) getFromFallback(ctx context.Context, key string, gen uint64) (ByteView, bool) {
+	f, ok := g.peers.(FallbackPicker)
+	if !ok {
+		return ByteView{}, false
+	}
+
+	peer, ok := f.PickFallback(key)
+	if !ok {
+		return ByteView{}, false
+	}
+
+	token := g.mainCache.startLoad(key)
+	resp := &pb.Response{}
+	if err := peer.Peek(ctx, &pb.Request{Group: g.name, Key: key, Generation: gen}, resp); err != nil {
+		return ByteView{}, false
+	}
+	g.observeGeneration(resp.GetGeneration())
+
+	value := ByteView{data: resp.Value, expire: fromUnixNano(resp.GetExpire()), gen: gen, tags: resp.Tags}
+	g.mainCache.addLoaded(key, value, token)
+
+	return value, true
+}
+
+// peek 只查询本地缓存
+func (g *Group) peek(key string) (ByteView, bool) {
+	return g.mainCache.get(key, g.Generation())
+}
+
 // 把数据插入至缓存中
 func (g *Group) populateCache(key string, value ByteView) {
 	g.mainCache.add(key, value)
@@ -137,8 +306,9 @@ func (g *Group) populateCache(key string, value ByteView) {
 
 func (g *Group) getFromPeer(ctx context.Context, peer PeerGetter, key string) (ByteView, error) {
 	req := &pb.Request{
-		Group: g.name,
-		Key:   key,
+		Group:      g.name,
+		Key:        key,
+		Generation: g.Generation(),
 	}
 	resp := &pb.Response{}
 	err := peer.Get(ctx, req, resp)
@@ -146,5 +316,7 @@ func (g *Group) getFromPeer(ctx context.Context, peer PeerGetter, key string) (B
 		return ByteView{}, err
 	}
 
-	return ByteView{data: resp.Value}, nil
+	g.observeGeneration(resp.GetGeneration())
+
+	return ByteView{data: resp.Value, expire: fromUnixNano(resp.GetExpire()), tags: resp.Tags}, nil
 }
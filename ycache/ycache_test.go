@@ -1,6 +1,7 @@
 package ycache
 
 import (
+	"7days/ycache/disk"
 	"context"
 	"fmt"
 	"log"
@@ -57,3 +58,104 @@ func TestGet(t *testing.T) {
 		t.Fatalf("the value of unknow should be empty, but %s got", view)
 	}
 }
+
+func TestDiskTier(t *testing.T) {
+	store, err := disk.Open(t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	loads := 0
+	g := NewGroup("disk-tier", 2, GetterFunc(func(ctx context.Context, key string) ([]byte, error) {
+		loads++
+		return []byte("origin"), nil
+	}))
+	g.SetDiskStore(store)
+
+	// 内存中只能保存两个key，第三个key使最早的数据被淘汰到磁盘
+	keys := []string{"a", "b", "c"}
+	for _, key := range keys {
+		warm(g, key, "value-"+key)
+	}
+
+	if store.Stats().Keys == 0 {
+		t.Fatal("no entry was evicted to disk")
+	}
+
+	for _, key := range keys {
+		if v, err := g.Get(context.Background(), key); err != nil || v.String() != "value-"+key {
+			t.Fatalf("%s = %q, %v", key, v.String(), err)
+		}
+	}
+
+	if loads != 0 {
+		t.Fatalf("origin loaded %d times, want 0", loads)
+	}
+}
+
+func TestDiskTierStale(t *testing.T) {
+	store, err := disk.Open(t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	c := &cache{cacheBytes: 1}
+	c.setDisk(store)
+
+	// 淘汰到磁盘后更新的值，不会被磁盘中旧的副本覆盖
+	warmCache(c, "a", "old")
+	warmCache(c, "b", "b")
+	if store.Stats().Keys != 1 {
+		t.Fatalf("%d keys on disk, want 1", store.Stats().Keys)
+	}
+
+	c.set("a", ByteView{data: []byte("new")})
+	if _, _, ok := store.Get(diskKey("a", 0)); ok {
+		t.Fatal("stale copy is still on disk after set")
+	}
+
+	warmCache(c, "b", "b")
+	if v, ok := c.get("a", 0); !ok || v.String() != "new" {
+		t.Fatalf("a = %q, %v; want new", v.String(), ok)
+	}
+
+	c.remove("a", 0)
+	warmCache(c, "b", "b")
+	if v, ok := c.get("a", 0); ok {
+		t.Fatalf("removed key returned %q", v.String())
+	}
+}
+
+// warmCache 写入缓存并访问足够多次，使key进入LRU-K的缓存表
+func warmCache(c *cache, key, value string) {
+	c.add(key, ByteView{data: []byte(value)})
+	for i := 0; i < 3; i++ {
+		c.get(key, 0)
+	}
+}
+
+func TestStats(t *testing.T) {
+	g := NewGroup("stats", 2<<10, GetterFunc(func(ctx context.Context, key string) ([]byte, error) {
+		if key == "missing" {
+			return nil, fmt.Errorf("%s not exist", key)
+		}
+		return []byte(key), nil
+	}))
+
+	ctx := context.Background()
+	g.Get(ctx, "a")
+	g.Get(ctx, "a")
+	g.Get(ctx, "missing")
+
+	st := &g.Stats
+	if st.Gets.Get() != 3 || st.CacheHits.Get() != 1 || st.Loads.Get() != 2 || st.LocalLoads.Get() != 1 || st.LocalLoadErrs.Get() != 1 {
+		t.Fatalf("stats = gets %v, hits %v, loads %v, local %v, errs %v",
+			&st.Gets, &st.CacheHits, &st.Loads, &st.LocalLoads, &st.LocalLoadErrs)
+	}
+
+	if cs := g.CacheStats(); cs.Items != 1 {
+		t.Fatalf("cache stats = %+v", cs)
+	}
+}
@@ -27,6 +27,7 @@ const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto package
 type Request struct {
 	Group                string   `protobuf:"bytes,1,opt,name=group,proto3" json:"group"`
 	Key                  string   `protobuf:"bytes,2,opt,name=key,proto3" json:"key"`
+	Generation           uint64   `protobuf:"varint,3,opt,name=generation,proto3" json:"generation"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -71,8 +72,18 @@ func (m *Request) GetKey() string {
 	return ""
 }
 
+func (m *Request) GetGeneration() uint64 {
+	if m != nil {
+		return m.Generation
+	}
+	return 0
+}
+
 type Response struct {
 	Value                []byte   `protobuf:"bytes,1,opt,name=value,proto3" json:"value"`
+	Generation           uint64   `protobuf:"varint,2,opt,name=generation,proto3" json:"generation"`
+	Tags                 []string `protobuf:"bytes,3,rep,name=tags,proto3" json:"tags"`
+	Expire               int64    `protobuf:"varint,4,opt,name=expire,proto3" json:"expire"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -110,25 +121,604 @@ func (m *Response) GetValue() []byte {
 	return nil
 }
 
+func (m *Response) GetGeneration() uint64 {
+	if m != nil {
+		return m.Generation
+	}
+	return 0
+}
+
+func (m *Response) GetTags() []string {
+	if m != nil {
+		return m.Tags
+	}
+	return nil
+}
+
+func (m *Response) GetExpire() int64 {
+	if m != nil {
+		return m.Expire
+	}
+	return 0
+}
+
+type Entry struct {
+	Key                  string   `protobuf:"bytes,1,opt,name=key,proto3" json:"key"`
+	Value                []byte   `protobuf:"bytes,2,opt,name=value,proto3" json:"value"`
+	Expire               int64    `protobuf:"varint,3,opt,name=expire,proto3" json:"expire"`
+	Generation           uint64   `protobuf:"varint,4,opt,name=generation,proto3" json:"generation"`
+	Tags                 []string `protobuf:"bytes,5,rep,name=tags,proto3" json:"tags"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Entry) Reset()         { *m = Entry{} }
+func (m *Entry) String() string { return proto.CompactTextString(m) }
+func (*Entry) ProtoMessage()    {}
+func (*Entry) Descriptor() ([]byte, []int) {
+	return fileDescriptor_e80e4645a956fb15, []int{2}
+}
+
+func (m *Entry) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Entry.Unmarshal(m, b)
+}
+func (m *Entry) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Entry.Marshal(b, m, deterministic)
+}
+func (m *Entry) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Entry.Merge(m, src)
+}
+func (m *Entry) XXX_Size() int {
+	return xxx_messageInfo_Entry.Size(m)
+}
+func (m *Entry) XXX_DiscardUnknown() {
+	xxx_messageInfo_Entry.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Entry proto.InternalMessageInfo
+
+func (m *Entry) GetKey() string {
+	if m != nil {
+		return m.Key
+	}
+	return ""
+}
+
+func (m *Entry) GetValue() []byte {
+	if m != nil {
+		return m.Value
+	}
+	return nil
+}
+
+func (m *Entry) GetExpire() int64 {
+	if m != nil {
+		return m.Expire
+	}
+	return 0
+}
+
+func (m *Entry) GetGeneration() uint64 {
+	if m != nil {
+		return m.Generation
+	}
+	return 0
+}
+
+func (m *Entry) GetTags() []string {
+	if m != nil {
+		return m.Tags
+	}
+	return nil
+}
+
+type PushRequest struct {
+	Group                string   `protobuf:"bytes,1,opt,name=group,proto3" json:"group"`
+	Entries              []*Entry `protobuf:"bytes,2,rep,name=entries,proto3" json:"entries"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *PushRequest) Reset()         { *m = PushRequest{} }
+func (m *PushRequest) String() string { return proto.CompactTextString(m) }
+func (*PushRequest) ProtoMessage()    {}
+func (*PushRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_e80e4645a956fb15, []int{3}
+}
+
+func (m *PushRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_PushRequest.Unmarshal(m, b)
+}
+func (m *PushRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_PushRequest.Marshal(b, m, deterministic)
+}
+func (m *PushRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_PushRequest.Merge(m, src)
+}
+func (m *PushRequest) XXX_Size() int {
+	return xxx_messageInfo_PushRequest.Size(m)
+}
+func (m *PushRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_PushRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_PushRequest proto.InternalMessageInfo
+
+func (m *PushRequest) GetGroup() string {
+	if m != nil {
+		return m.Group
+	}
+	return ""
+}
+
+func (m *PushRequest) GetEntries() []*Entry {
+	if m != nil {
+		return m.Entries
+	}
+	return nil
+}
+
+type PushResponse struct {
+	Accepted             int64    `protobuf:"varint,1,opt,name=accepted,proto3" json:"accepted"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *PushResponse) Reset()         { *m = PushResponse{} }
+func (m *PushResponse) String() string { return proto.CompactTextString(m) }
+func (*PushResponse) ProtoMessage()    {}
+func (*PushResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_e80e4645a956fb15, []int{4}
+}
+
+func (m *PushResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_PushResponse.Unmarshal(m, b)
+}
+func (m *PushResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_PushResponse.Marshal(b, m, deterministic)
+}
+func (m *PushResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_PushResponse.Merge(m, src)
+}
+func (m *PushResponse) XXX_Size() int {
+	return xxx_messageInfo_PushResponse.Size(m)
+}
+func (m *PushResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_PushResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_PushResponse proto.InternalMessageInfo
+
+func (m *PushResponse) GetAccepted() int64 {
+	if m != nil {
+		return m.Accepted
+	}
+	return 0
+}
+
+type SetRequest struct {
+	Group                string   `protobuf:"bytes,1,opt,name=group,proto3" json:"group"`
+	Key                  string   `protobuf:"bytes,2,opt,name=key,proto3" json:"key"`
+	Value                []byte   `protobuf:"bytes,3,opt,name=value,proto3" json:"value"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *SetRequest) Reset()         { *m = SetRequest{} }
+func (m *SetRequest) String() string { return proto.CompactTextString(m) }
+func (*SetRequest) ProtoMessage()    {}
+func (*SetRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_e80e4645a956fb15, []int{5}
+}
+
+func (m *SetRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SetRequest.Unmarshal(m, b)
+}
+func (m *SetRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SetRequest.Marshal(b, m, deterministic)
+}
+func (m *SetRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SetRequest.Merge(m, src)
+}
+func (m *SetRequest) XXX_Size() int {
+	return xxx_messageInfo_SetRequest.Size(m)
+}
+func (m *SetRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_SetRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SetRequest proto.InternalMessageInfo
+
+func (m *SetRequest) GetGroup() string {
+	if m != nil {
+		return m.Group
+	}
+	return ""
+}
+
+func (m *SetRequest) GetKey() string {
+	if m != nil {
+		return m.Key
+	}
+	return ""
+}
+
+func (m *SetRequest) GetValue() []byte {
+	if m != nil {
+		return m.Value
+	}
+	return nil
+}
+
+type SetResponse struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *SetResponse) Reset()         { *m = SetResponse{} }
+func (m *SetResponse) String() string { return proto.CompactTextString(m) }
+func (*SetResponse) ProtoMessage()    {}
+func (*SetResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_e80e4645a956fb15, []int{6}
+}
+
+func (m *SetResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SetResponse.Unmarshal(m, b)
+}
+func (m *SetResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SetResponse.Marshal(b, m, deterministic)
+}
+func (m *SetResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SetResponse.Merge(m, src)
+}
+func (m *SetResponse) XXX_Size() int {
+	return xxx_messageInfo_SetResponse.Size(m)
+}
+func (m *SetResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_SetResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SetResponse proto.InternalMessageInfo
+
+type GenerationRequest struct {
+	Group                string   `protobuf:"bytes,1,opt,name=group,proto3" json:"group"`
+	Generation           uint64   `protobuf:"varint,2,opt,name=generation,proto3" json:"generation"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *GenerationRequest) Reset()         { *m = GenerationRequest{} }
+func (m *GenerationRequest) String() string { return proto.CompactTextString(m) }
+func (*GenerationRequest) ProtoMessage()    {}
+func (*GenerationRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_e80e4645a956fb15, []int{7}
+}
+
+func (m *GenerationRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GenerationRequest.Unmarshal(m, b)
+}
+func (m *GenerationRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GenerationRequest.Marshal(b, m, deterministic)
+}
+func (m *GenerationRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GenerationRequest.Merge(m, src)
+}
+func (m *GenerationRequest) XXX_Size() int {
+	return xxx_messageInfo_GenerationRequest.Size(m)
+}
+func (m *GenerationRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_GenerationRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_GenerationRequest proto.InternalMessageInfo
+
+func (m *GenerationRequest) GetGroup() string {
+	if m != nil {
+		return m.Group
+	}
+	return ""
+}
+
+func (m *GenerationRequest) GetGeneration() uint64 {
+	if m != nil {
+		return m.Generation
+	}
+	return 0
+}
+
+type GenerationResponse struct {
+	Generation           uint64   `protobuf:"varint,1,opt,name=generation,proto3" json:"generation"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *GenerationResponse) Reset()         { *m = GenerationResponse{} }
+func (m *GenerationResponse) String() string { return proto.CompactTextString(m) }
+func (*GenerationResponse) ProtoMessage()    {}
+func (*GenerationResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_e80e4645a956fb15, []int{8}
+}
+
+func (m *GenerationResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GenerationResponse.Unmarshal(m, b)
+}
+func (m *GenerationResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GenerationResponse.Marshal(b, m, deterministic)
+}
+func (m *GenerationResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GenerationResponse.Merge(m, src)
+}
+func (m *GenerationResponse) XXX_Size() int {
+	return xxx_messageInfo_GenerationResponse.Size(m)
+}
+func (m *GenerationResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_GenerationResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_GenerationResponse proto.InternalMessageInfo
+
+func (m *GenerationResponse) GetGeneration() uint64 {
+	if m != nil {
+		return m.Generation
+	}
+	return 0
+}
+
+type InvalidateRequest struct {
+	Group                string   `protobuf:"bytes,1,opt,name=group,proto3" json:"group"`
+	Tag                  string   `protobuf:"bytes,2,opt,name=tag,proto3" json:"tag"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *InvalidateRequest) Reset()         { *m = InvalidateRequest{} }
+func (m *InvalidateRequest) String() string { return proto.CompactTextString(m) }
+func (*InvalidateRequest) ProtoMessage()    {}
+func (*InvalidateRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_e80e4645a956fb15, []int{9}
+}
+
+func (m *InvalidateRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_InvalidateRequest.Unmarshal(m, b)
+}
+func (m *InvalidateRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_InvalidateRequest.Marshal(b, m, deterministic)
+}
+func (m *InvalidateRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_InvalidateRequest.Merge(m, src)
+}
+func (m *InvalidateRequest) XXX_Size() int {
+	return xxx_messageInfo_InvalidateRequest.Size(m)
+}
+func (m *InvalidateRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_InvalidateRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_InvalidateRequest proto.InternalMessageInfo
+
+func (m *InvalidateRequest) GetGroup() string {
+	if m != nil {
+		return m.Group
+	}
+	return ""
+}
+
+func (m *InvalidateRequest) GetTag() string {
+	if m != nil {
+		return m.Tag
+	}
+	return ""
+}
+
+type InvalidateResponse struct {
+	Removed              int64    `protobuf:"varint,1,opt,name=removed,proto3" json:"removed"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *InvalidateResponse) Reset()         { *m = InvalidateResponse{} }
+func (m *InvalidateResponse) String() string { return proto.CompactTextString(m) }
+func (*InvalidateResponse) ProtoMessage()    {}
+func (*InvalidateResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_e80e4645a956fb15, []int{10}
+}
+
+func (m *InvalidateResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_InvalidateResponse.Unmarshal(m, b)
+}
+func (m *InvalidateResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_InvalidateResponse.Marshal(b, m, deterministic)
+}
+func (m *InvalidateResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_InvalidateResponse.Merge(m, src)
+}
+func (m *InvalidateResponse) XXX_Size() int {
+	return xxx_messageInfo_InvalidateResponse.Size(m)
+}
+func (m *InvalidateResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_InvalidateResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_InvalidateResponse proto.InternalMessageInfo
+
+func (m *InvalidateResponse) GetRemoved() int64 {
+	if m != nil {
+		return m.Removed
+	}
+	return 0
+}
+
+type RemoveResponse struct {
+	Removed              bool     `protobuf:"varint,1,opt,name=removed,proto3" json:"removed"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *RemoveResponse) Reset()         { *m = RemoveResponse{} }
+func (m *RemoveResponse) String() string { return proto.CompactTextString(m) }
+func (*RemoveResponse) ProtoMessage()    {}
+func (*RemoveResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_e80e4645a956fb15, []int{11}
+}
+
+func (m *RemoveResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_RemoveResponse.Unmarshal(m, b)
+}
+func (m *RemoveResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_RemoveResponse.Marshal(b, m, deterministic)
+}
+func (m *RemoveResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_RemoveResponse.Merge(m, src)
+}
+func (m *RemoveResponse) XXX_Size() int {
+	return xxx_messageInfo_RemoveResponse.Size(m)
+}
+func (m *RemoveResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_RemoveResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_RemoveResponse proto.InternalMessageInfo
+
+func (m *RemoveResponse) GetRemoved() bool {
+	if m != nil {
+		return m.Removed
+	}
+	return false
+}
+
+type LeaveRequest struct {
+	Peer                 string   `protobuf:"bytes,1,opt,name=peer,proto3" json:"peer"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *LeaveRequest) Reset()         { *m = LeaveRequest{} }
+func (m *LeaveRequest) String() string { return proto.CompactTextString(m) }
+func (*LeaveRequest) ProtoMessage()    {}
+func (*LeaveRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_e80e4645a956fb15, []int{12}
+}
+
+func (m *LeaveRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_LeaveRequest.Unmarshal(m, b)
+}
+func (m *LeaveRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_LeaveRequest.Marshal(b, m, deterministic)
+}
+func (m *LeaveRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_LeaveRequest.Merge(m, src)
+}
+func (m *LeaveRequest) XXX_Size() int {
+	return xxx_messageInfo_LeaveRequest.Size(m)
+}
+func (m *LeaveRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_LeaveRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_LeaveRequest proto.InternalMessageInfo
+
+func (m *LeaveRequest) GetPeer() string {
+	if m != nil {
+		return m.Peer
+	}
+	return ""
+}
+
+type LeaveResponse struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *LeaveResponse) Reset()         { *m = LeaveResponse{} }
+func (m *LeaveResponse) String() string { return proto.CompactTextString(m) }
+func (*LeaveResponse) ProtoMessage()    {}
+func (*LeaveResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_e80e4645a956fb15, []int{13}
+}
+
+func (m *LeaveResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_LeaveResponse.Unmarshal(m, b)
+}
+func (m *LeaveResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_LeaveResponse.Marshal(b, m, deterministic)
+}
+func (m *LeaveResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_LeaveResponse.Merge(m, src)
+}
+func (m *LeaveResponse) XXX_Size() int {
+	return xxx_messageInfo_LeaveResponse.Size(m)
+}
+func (m *LeaveResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_LeaveResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_LeaveResponse proto.InternalMessageInfo
+
 func init() {
 	proto.RegisterType((*Request)(nil), "ycachepb.Request")
 	proto.RegisterType((*Response)(nil), "ycachepb.Response")
+	proto.RegisterType((*Entry)(nil), "ycachepb.Entry")
+	proto.RegisterType((*PushRequest)(nil), "ycachepb.PushRequest")
+	proto.RegisterType((*PushResponse)(nil), "ycachepb.PushResponse")
+	proto.RegisterType((*SetRequest)(nil), "ycachepb.SetRequest")
+	proto.RegisterType((*SetResponse)(nil), "ycachepb.SetResponse")
+	proto.RegisterType((*GenerationRequest)(nil), "ycachepb.GenerationRequest")
+	proto.RegisterType((*GenerationResponse)(nil), "ycachepb.GenerationResponse")
+	proto.RegisterType((*InvalidateRequest)(nil), "ycachepb.InvalidateRequest")
+	proto.RegisterType((*InvalidateResponse)(nil), "ycachepb.InvalidateResponse")
+	proto.RegisterType((*RemoveResponse)(nil), "ycachepb.RemoveResponse")
+	proto.RegisterType((*LeaveRequest)(nil), "ycachepb.LeaveRequest")
+	proto.RegisterType((*LeaveResponse)(nil), "ycachepb.LeaveResponse")
 }
 
 func init() { proto.RegisterFile("ycache.proto", fileDescriptor_e80e4645a956fb15) }
 
 var fileDescriptor_e80e4645a956fb15 = []byte{
-	// 147 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xe2, 0xe2, 0xa9, 0x4c, 0x4e, 0x4c,
-	0xce, 0x48, 0xd5, 0x2b, 0x28, 0xca, 0x2f, 0xc9, 0x17, 0xe2, 0x80, 0xf0, 0x0a, 0x92, 0x94, 0x0c,
-	0xb9, 0xd8, 0x83, 0x52, 0x0b, 0x4b, 0x53, 0x8b, 0x4b, 0x84, 0x44, 0xb8, 0x58, 0xd3, 0x8b, 0xf2,
-	0x4b, 0x0b, 0x24, 0x18, 0x15, 0x18, 0x35, 0x38, 0x83, 0x20, 0x1c, 0x21, 0x01, 0x2e, 0xe6, 0xec,
-	0xd4, 0x4a, 0x09, 0x26, 0xb0, 0x18, 0x88, 0xa9, 0xa4, 0xc0, 0xc5, 0x11, 0x94, 0x5a, 0x5c, 0x90,
-	0x9f, 0x57, 0x9c, 0x0a, 0xd2, 0x53, 0x96, 0x98, 0x53, 0x9a, 0x0a, 0xd6, 0xc3, 0x13, 0x04, 0xe1,
-	0x18, 0x59, 0x71, 0x71, 0xb9, 0x83, 0x34, 0x3b, 0x83, 0x2c, 0x11, 0xd2, 0xe1, 0x62, 0x76, 0x4f,
-	0x2d, 0x11, 0x12, 0xd4, 0x83, 0x59, 0xaa, 0x07, 0xb5, 0x51, 0x4a, 0x08, 0x59, 0x08, 0x62, 0x62,
-	0x12, 0x1b, 0xd8, 0x85, 0xc6, 0x80, 0x00, 0x00, 0x00, 0xff, 0xff, 0x98, 0x7e, 0x9f, 0xd9, 0xb1,
-	0x00, 0x00, 0x00,
+	// 498 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x94, 0x54, 0xdf, 0x6f, 0xd3, 0x30,
+	0x10, 0x56, 0xea, 0xf4, 0xc7, 0xae, 0x2d, 0xa3, 0xd6, 0x36, 0xa2, 0x30, 0xa1, 0xc8, 0x4f, 0x61,
+	0x42, 0x7d, 0x28, 0x20, 0x21, 0xf1, 0x88, 0x50, 0xb5, 0x09, 0x21, 0x70, 0xf9, 0x07, 0xbc, 0xee,
+	0x94, 0x55, 0x94, 0x24, 0x24, 0x6e, 0x45, 0xc5, 0xff, 0xc4, 0xdf, 0x88, 0x62, 0x3b, 0xb1, 0x97,
+	0x76, 0x9b, 0xf6, 0xe6, 0xbb, 0xf3, 0x7d, 0xf7, 0xf9, 0xfb, 0x4e, 0x86, 0xd1, 0x6e, 0x29, 0x96,
+	0xb7, 0x38, 0xcd, 0x8b, 0x4c, 0x66, 0x74, 0xa0, 0xa3, 0xfc, 0x9a, 0x7d, 0x87, 0x3e, 0xc7, 0xdf,
+	0x1b, 0x2c, 0x25, 0x3d, 0x81, 0x6e, 0x52, 0x64, 0x9b, 0x3c, 0xf0, 0x22, 0x2f, 0x3e, 0xe2, 0x3a,
+	0xa0, 0xcf, 0x81, 0xfc, 0xc4, 0x5d, 0xd0, 0x51, 0xb9, 0xea, 0x48, 0x5f, 0x01, 0x24, 0x98, 0x62,
+	0x21, 0xe4, 0x2a, 0x4b, 0x03, 0x12, 0x79, 0xb1, 0xcf, 0x9d, 0x0c, 0x5b, 0xc3, 0x80, 0x63, 0x99,
+	0x67, 0x69, 0x89, 0x15, 0xe6, 0x56, 0xac, 0x37, 0xa8, 0x30, 0x47, 0x5c, 0x07, 0x2d, 0x84, 0x4e,
+	0x1b, 0x81, 0x52, 0xf0, 0xa5, 0x48, 0xca, 0x80, 0x44, 0x24, 0x3e, 0xe2, 0xea, 0x4c, 0xcf, 0xa0,
+	0x87, 0x7f, 0xf2, 0x55, 0x81, 0x81, 0x1f, 0x79, 0x31, 0xe1, 0x26, 0x62, 0x7f, 0xa1, 0xfb, 0x39,
+	0x95, 0xc5, 0xae, 0x26, 0xea, 0x59, 0xa2, 0xcd, 0xf0, 0x8e, 0x3b, 0xdc, 0x02, 0x11, 0x17, 0xa8,
+	0x45, 0xca, 0xbf, 0x97, 0x54, 0xd7, 0x92, 0x62, 0x5f, 0x61, 0xf8, 0x6d, 0x53, 0xde, 0x3e, 0xac,
+	0xe0, 0x6b, 0xe8, 0x63, 0x2a, 0x8b, 0x15, 0x96, 0x41, 0x27, 0x22, 0xf1, 0x70, 0x76, 0x3c, 0xad,
+	0xe5, 0x9f, 0x2a, 0xea, 0xbc, 0xae, 0xb3, 0x0b, 0x18, 0x69, 0x3c, 0x23, 0x5f, 0x08, 0x03, 0xb1,
+	0x5c, 0x62, 0x2e, 0xf1, 0x46, 0x61, 0x12, 0xde, 0xc4, 0xec, 0x0a, 0x60, 0x81, 0xf2, 0xa9, 0xe6,
+	0x35, 0x9a, 0x10, 0x47, 0x13, 0x36, 0x86, 0xa1, 0xc2, 0xd2, 0x63, 0xd9, 0x25, 0x4c, 0xe6, 0xcd,
+	0xc3, 0x1f, 0x9e, 0xf0, 0x88, 0x95, 0xec, 0x1d, 0x50, 0x17, 0xca, 0xbc, 0xeb, 0x6e, 0x97, 0xb7,
+	0xd7, 0xf5, 0x11, 0x26, 0x97, 0xe9, 0x56, 0xac, 0x57, 0x37, 0x42, 0xe2, 0xa3, 0x4f, 0x94, 0x22,
+	0xa9, 0x9f, 0x28, 0x45, 0xc2, 0xa6, 0x40, 0xdd, 0x66, 0x33, 0x32, 0x80, 0x7e, 0x81, 0xbf, 0xb2,
+	0x6d, 0xa3, 0x64, 0x1d, 0xb2, 0x0b, 0x78, 0xc6, 0xd5, 0xf1, 0xbe, 0xbb, 0x03, 0x7b, 0x97, 0xc1,
+	0xe8, 0x0b, 0x8a, 0x6d, 0xc3, 0x89, 0x82, 0x9f, 0x23, 0x16, 0x86, 0x92, 0x3a, 0xb3, 0x63, 0x18,
+	0x9b, 0x3b, 0x1a, 0x6e, 0xf6, 0x8f, 0x00, 0xcc, 0x2b, 0xb2, 0x9f, 0x2a, 0xd7, 0xe9, 0x1b, 0x20,
+	0x73, 0x94, 0x74, 0x62, 0xb7, 0xc0, 0xa0, 0x85, 0xd4, 0x4d, 0x19, 0x2e, 0xef, 0xc1, 0xaf, 0x56,
+	0x82, 0x9e, 0xda, 0x9a, 0xb3, 0x72, 0xe1, 0x59, 0x3b, 0x6d, 0xda, 0x66, 0x40, 0x16, 0x28, 0xe9,
+	0x89, 0x2d, 0xdb, 0x65, 0x09, 0x4f, 0x5b, 0x59, 0xd3, 0x73, 0x05, 0xe3, 0x05, 0x4a, 0x6b, 0x17,
+	0x7d, 0x69, 0xef, 0xed, 0xed, 0x43, 0x78, 0x7e, 0xb8, 0x68, 0xb1, 0xac, 0x09, 0x3f, 0x44, 0xe2,
+	0x62, 0xed, 0x59, 0x1b, 0x9e, 0x1f, 0x2e, 0x36, 0x12, 0xf4, 0xb4, 0x41, 0x87, 0x34, 0x0b, 0xdc,
+	0xd4, 0x1d, 0x17, 0x3f, 0x40, 0x57, 0xf9, 0x40, 0x1d, 0x8d, 0x5c, 0xf3, 0xc2, 0x17, 0x7b, 0x79,
+	0xdd, 0x79, 0xdd, 0x53, 0xbf, 0xe4, 0xdb, 0xff, 0x03, 0x00, 0x1c, 0xaf, 0x80, 0xf7, 0x35, 0x05,
+	0x00, 0x00,
 }
 
 // Reference imports to suppress errors if they are not otherwise used.
@@ -144,6 +734,12 @@ const _ = grpc.SupportPackageIsVersion4
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
 type GroupCacheClient interface {
 	Get(ctx context.Context, in *Request, opts ...grpc.CallOption) (*Response, error)
+	Push(ctx context.Context, in *PushRequest, opts ...grpc.CallOption) (*PushResponse, error)
+	Set(ctx context.Context, in *SetRequest, opts ...grpc.CallOption) (*SetResponse, error)
+	SetGeneration(ctx context.Context, in *GenerationRequest, opts ...grpc.CallOption) (*GenerationResponse, error)
+	InvalidateTag(ctx context.Context, in *InvalidateRequest, opts ...grpc.CallOption) (*InvalidateResponse, error)
+	Remove(ctx context.Context, in *Request, opts ...grpc.CallOption) (*RemoveResponse, error)
+	Leave(ctx context.Context, in *LeaveRequest, opts ...grpc.CallOption) (*LeaveResponse, error)
 }
 
 type groupCacheClient struct {
@@ -163,9 +759,69 @@ func (c *groupCacheClient) Get(ctx context.Context, in *Request, opts ...grpc.Ca
 	return out, nil
 }
 
+func (c *groupCacheClient) Push(ctx context.Context, in *PushRequest, opts ...grpc.CallOption) (*PushResponse, error) {
+	out := new(PushResponse)
+	err := c.cc.Invoke(ctx, "/ycachepb.GroupCache/Push", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *groupCacheClient) Set(ctx context.Context, in *SetRequest, opts ...grpc.CallOption) (*SetResponse, error) {
+	out := new(SetResponse)
+	err := c.cc.Invoke(ctx, "/ycachepb.GroupCache/Set", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *groupCacheClient) SetGeneration(ctx context.Context, in *GenerationRequest, opts ...grpc.CallOption) (*GenerationResponse, error) {
+	out := new(GenerationResponse)
+	err := c.cc.Invoke(ctx, "/ycachepb.GroupCache/SetGeneration", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *groupCacheClient) InvalidateTag(ctx context.Context, in *InvalidateRequest, opts ...grpc.CallOption) (*InvalidateResponse, error) {
+	out := new(InvalidateResponse)
+	err := c.cc.Invoke(ctx, "/ycachepb.GroupCache/InvalidateTag", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *groupCacheClient) Remove(ctx context.Context, in *Request, opts ...grpc.CallOption) (*RemoveResponse, error) {
+	out := new(RemoveResponse)
+	err := c.cc.Invoke(ctx, "/ycachepb.GroupCache/Remove", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *groupCacheClient) Leave(ctx context.Context, in *LeaveRequest, opts ...grpc.CallOption) (*LeaveResponse, error) {
+	out := new(LeaveResponse)
+	err := c.cc.Invoke(ctx, "/ycachepb.GroupCache/Leave", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // GroupCacheServer is the server API for GroupCache service.
 type GroupCacheServer interface {
 	Get(context.Context, *Request) (*Response, error)
+	Push(context.Context, *PushRequest) (*PushResponse, error)
+	Set(context.Context, *SetRequest) (*SetResponse, error)
+	SetGeneration(context.Context, *GenerationRequest) (*GenerationResponse, error)
+	InvalidateTag(context.Context, *InvalidateRequest) (*InvalidateResponse, error)
+	Remove(context.Context, *Request) (*RemoveResponse, error)
+	Leave(context.Context, *LeaveRequest) (*LeaveResponse, error)
 }
 
 // UnimplementedGroupCacheServer can be embedded to have forward compatible implementations.
@@ -175,6 +831,24 @@ type UnimplementedGroupCacheServer struct {
 func (*UnimplementedGroupCacheServer) Get(ctx context.Context, req *Request) (*Response, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Get not implemented")
 }
+func (*UnimplementedGroupCacheServer) Push(ctx context.Context, req *PushRequest) (*PushResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Push not implemented")
+}
+func (*UnimplementedGroupCacheServer) Set(ctx context.Context, req *SetRequest) (*SetResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Set not implemented")
+}
+func (*UnimplementedGroupCacheServer) SetGeneration(ctx context.Context, req *GenerationRequest) (*GenerationResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetGeneration not implemented")
+}
+func (*UnimplementedGroupCacheServer) InvalidateTag(ctx context.Context, req *InvalidateRequest) (*InvalidateResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method InvalidateTag not implemented")
+}
+func (*UnimplementedGroupCacheServer) Remove(ctx context.Context, req *Request) (*RemoveResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Remove not implemented")
+}
+func (*UnimplementedGroupCacheServer) Leave(ctx context.Context, req *LeaveRequest) (*LeaveResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Leave not implemented")
+}
 
 func RegisterGroupCacheServer(s *grpc.Server, srv GroupCacheServer) {
 	s.RegisterService(&_GroupCache_serviceDesc, srv)
@@ -198,6 +872,114 @@ func _GroupCache_Get_Handler(srv interface{}, ctx context.Context, dec func(inte
 	return interceptor(ctx, in, info, handler)
 }
 
+func _GroupCache_Push_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PushRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GroupCacheServer).Push(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/ycachepb.GroupCache/Push",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GroupCacheServer).Push(ctx, req.(*PushRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GroupCache_Set_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GroupCacheServer).Set(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/ycachepb.GroupCache/Set",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GroupCacheServer).Set(ctx, req.(*SetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GroupCache_SetGeneration_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GenerationRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GroupCacheServer).SetGeneration(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/ycachepb.GroupCache/SetGeneration",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GroupCacheServer).SetGeneration(ctx, req.(*GenerationRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GroupCache_InvalidateTag_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(InvalidateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GroupCacheServer).InvalidateTag(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/ycachepb.GroupCache/InvalidateTag",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GroupCacheServer).InvalidateTag(ctx, req.(*InvalidateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GroupCache_Remove_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Request)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GroupCacheServer).Remove(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/ycachepb.GroupCache/Remove",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GroupCacheServer).Remove(ctx, req.(*Request))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GroupCache_Leave_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(LeaveRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GroupCacheServer).Leave(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/ycachepb.GroupCache/Leave",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GroupCacheServer).Leave(ctx, req.(*LeaveRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 var _GroupCache_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "ycachepb.GroupCache",
 	HandlerType: (*GroupCacheServer)(nil),
@@ -206,6 +988,30 @@ var _GroupCache_serviceDesc = grpc.ServiceDesc{
 			MethodName: "Get",
 			Handler:    _GroupCache_Get_Handler,
 		},
+		{
+			MethodName: "Push",
+			Handler:    _GroupCache_Push_Handler,
+		},
+		{
+			MethodName: "Set",
+			Handler:    _GroupCache_Set_Handler,
+		},
+		{
+			MethodName: "SetGeneration",
+			Handler:    _GroupCache_SetGeneration_Handler,
+		},
+		{
+			MethodName: "InvalidateTag",
+			Handler:    _GroupCache_InvalidateTag_Handler,
+		},
+		{
+			MethodName: "Remove",
+			Handler:    _GroupCache_Remove_Handler,
+		},
+		{
+			MethodName: "Leave",
+			Handler:    _GroupCache_Leave_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "ycache.proto",